@@ -1,11 +1,138 @@
 package api
 
 import (
+	"context"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/promotion"
+	"github.com/findbed/app/schedule"
 	"github.com/gin-gonic/gin"
 )
 
-func APIRouter(engine *gin.Engine) {
+type Scheduler interface {
+	Search(context.Context, schedule.Query) (schedule.SearchResult, error)
+	BookWithCode(
+		context.Context,
+		schedule.TimeSlot,
+		domain.AccessSubject,
+		string,
+	) (schedule.Booking, error)
+	BookMany(
+		context.Context,
+		[]schedule.TimeSlot,
+		domain.AccessSubject,
+	) ([]schedule.Booking, error)
+	FindBooking(context.Context, schedule.LongID) (schedule.Booking, error)
+	Cancel(context.Context, schedule.LongID) error
+	Block(
+		context.Context,
+		schedule.TimeSlot,
+		string,
+		domain.AccessSubject,
+	) (schedule.Block, error)
+	FindBlock(context.Context, schedule.LongID) (schedule.Block, error)
+	Unblock(context.Context, schedule.LongID) error
+	Hold(context.Context, schedule.TimeSlot, time.Duration) (schedule.Hold, error)
+	Confirm(
+		context.Context,
+		string,
+		domain.AccessSubject,
+	) (schedule.Booking, error)
+	RegisterLot(context.Context, schedule.TimeSlot) error
+	Calendar(context.Context, schedule.Query) (schedule.Calendar, error)
+	SetAvailability(
+		context.Context,
+		schedule.TimeSlot,
+		schedule.AvailabilityRules,
+	) error
+	Facets(
+		context.Context,
+		schedule.Query,
+		schedule.Level,
+	) ([]schedule.Facet, error)
+}
+
+type Pricer interface {
+	SetRates(context.Context, schedule.LongID, pricing.Rates) error
+	SetCharges(context.Context, pricing.Location, []pricing.Rule) error
+	Quote(
+		context.Context,
+		schedule.LongID,
+		pricing.Location,
+		time.Time,
+		time.Time,
+		uint8,
+	) (pricing.Quote, error)
+	PriceCalendar(
+		context.Context,
+		schedule.Query,
+		string,
+	) (pricing.PriceCalendar, error)
+}
+
+type Promoter interface {
+	SetPromotion(context.Context, promotion.Promotion) error
+	Apply(context.Context, string, pricing.Quote) (pricing.Quote, error)
+}
+
+type handler struct {
+	scheduler     Scheduler
+	pricer        Pricer
+	promoter      Promoter
+	authenticator Authenticator
+	access        AccessController
+}
+
+type Option func(*handler)
+
+func WithScheduler(scheduler Scheduler) Option {
+	return func(h *handler) {
+		h.scheduler = scheduler
+	}
+}
+
+func WithPricer(pricer Pricer) Option {
+	return func(h *handler) {
+		h.pricer = pricer
+	}
+}
+
+func WithPromoter(promoter Promoter) Option {
+	return func(h *handler) {
+		h.promoter = promoter
+	}
+}
+
+func APIRouter(engine *gin.Engine, opts ...Option) {
+	h := &handler{}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
 	engine.GET("/api/list", list)
+
+	v1 := engine.Group("/api/v1", h.authenticate)
+	v1.GET("/search", h.search)
+	v1.GET("/search/facets", h.facets)
+	v1.POST("/bookings", h.book)
+	v1.POST("/bookings/batch", h.bookMany)
+	v1.DELETE("/bookings/:id", h.cancel)
+	v1.POST("/blocks", h.block)
+	v1.DELETE("/blocks/:id", h.unblock)
+	v1.POST("/holds", h.hold)
+	v1.POST("/holds/:token/confirm", h.confirm)
+	v1.POST("/lots", h.registerLot)
+	v1.GET("/lots/:id/calendar", h.calendar)
+	v1.PUT("/lots/:id/availability", h.setAvailability)
+	v1.PUT("/lots/:id/rates", h.setRates)
+	v1.GET("/lots/:id/price-calendar", h.lotPriceCalendar)
+	v1.GET("/price-calendar", h.regionPriceCalendar)
+	v1.PUT("/charges", h.setCharges)
+	v1.GET("/quote", h.quote)
+	v1.PUT("/promotions/:code", h.setPromotion)
 }
 
 func list(c *gin.Context) {
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/rbac"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+const bearerPrefix = "Bearer "
+
+type Authenticator interface {
+	Authenticate(context.Context, string) (domain.AccessSubject, error)
+}
+
+type AccessController interface {
+	Enforce(
+		context.Context,
+		domain.AccessDomain,
+		domain.AccessObject,
+		domain.AccessAction,
+	) (domain.IsAllowed, error)
+}
+
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(h *handler) {
+		h.authenticator = authenticator
+	}
+}
+
+func WithAccessController(access AccessController) Option {
+	return func(h *handler) {
+		h.access = access
+	}
+}
+
+// authenticate puts the subject of the bearer token into the context of
+// the request. Requests without a token stay anonymous, ones with
+// an invalid token are aborted.
+func (h *handler) authenticate(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		return
+	}
+
+	if !strings.HasPrefix(header, bearerPrefix) || h.authenticator == nil {
+		c.AbortWithStatusJSON(
+			http.StatusUnauthorized,
+			gin.H{"error": rbac.ErrInvalidToken.Error()},
+		)
+
+		return
+	}
+
+	subject, err := h.authenticator.Authenticate(
+		c.Request.Context(),
+		strings.TrimPrefix(header, bearerPrefix),
+	)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	ctx := rbac.WithSubject(c.Request.Context(), subject)
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// authSubject returns the subject the request is authenticated as.
+// Unauthenticated requests are aborted.
+func authSubject(c *gin.Context) (domain.AccessSubject, bool) {
+	subject := rbac.SubjectFromContext(c.Request.Context())
+	if subject == domain.AccessSubjectUnknowUser {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": domain.ErrUnknowUser.Error()})
+
+		return subject, false
+	}
+
+	return subject, true
+}
+
+// permit reports whether a policy allows the authenticated subject
+// the action on the object, owners and admins are granted by policies.
+// Other requests are aborted.
+func (h *handler) permit(
+	c *gin.Context,
+	dom domain.AccessDomain,
+	obj domain.AccessObject,
+	act domain.AccessAction,
+) bool {
+	if _, ok := authSubject(c); !ok {
+		return false
+	}
+
+	if h.access == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrAccessDenied.Error()})
+
+		return false
+	}
+
+	allowed, err := h.access.Enforce(c.Request.Context(), dom, obj, act)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+
+		return false
+	}
+
+	if allowed != domain.Allow {
+		c.JSON(http.StatusForbidden, gin.H{"error": domain.ErrAccessDenied.Error()})
+
+		return false
+	}
+
+	return true
+}
+
+// regionObject is the object of the region in policies of charges and
+// promotions. Zero is no object to the enforcer, so codes are shifted by
+// one and promotions of all regions, which have no region, are object 1.
+func regionObject(region schedule.CodeID) domain.AccessObject {
+	return (domain.AccessObject(region[0])<<8 | domain.AccessObject(region[1])) + 1
+}
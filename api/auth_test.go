@@ -0,0 +1,187 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/api"
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/rbac"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ownerID is the subject policies of fakeAccess allow everything.
+const ownerID = domain.AccessSubject(50)
+
+var tokens = rbac.NewTokens("secret")
+
+type fakeAccess struct{}
+
+func (fakeAccess) Enforce(
+	ctx context.Context,
+	dom domain.AccessDomain,
+	obj domain.AccessObject,
+	act domain.AccessAction,
+) (domain.IsAllowed, error) {
+	return domain.IsAllowed(rbac.SubjectFromContext(ctx) == ownerID), nil
+}
+
+// bearer signs requests with the token of the subject, requests of
+// the unknown user aren't signed.
+func bearer(subject domain.AccessSubject) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if subject == domain.AccessSubjectUnknowUser {
+			return
+		}
+
+		token, err := tokens.Sign(subject, time.Now().Add(time.Hour))
+		if err != nil {
+			panic(err)
+		}
+
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func Test_authenticate(t *testing.T) {
+	t.Run("bearer token is authenticated", func(t *testing.T) {
+		scheduler := &fakeScheduler{}
+		engine := newEngineAs(scheduler, domain.AccessSubject(41))
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings",
+			strings.NewReader(slotBody),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, domain.AccessSubject(41), scheduler.guest)
+	})
+
+	t.Run("invalid token is rejected", func(t *testing.T) {
+		scheduler := &fakeScheduler{}
+		engine := newEngineAs(scheduler, domain.AccessSubjectUnknowUser)
+
+		for _, header := range []string{"Bearer 41.0.x", "Basic 41"} {
+			req := httptest.NewRequest(
+				http.MethodGet,
+				"/api/v1/search?region=fi",
+				nil,
+			)
+			req.Header.Set("Authorization", header)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, header)
+		}
+	})
+
+	t.Run("anonymous requests are public", func(t *testing.T) {
+		scheduler := &fakeScheduler{}
+		engine := newEngineAs(scheduler, domain.AccessSubjectUnknowUser)
+
+		req := httptest.NewRequest(
+			http.MethodGet,
+			"/api/v1/search?region=fi&from=2023-01-01&to=2023-01-03",
+			nil,
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("tokens aren't accepted without an authenticator", func(t *testing.T) {
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.Use(bearer(guestID))
+		api.APIRouter(engine, api.WithScheduler(&fakeScheduler{}))
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings",
+			strings.NewReader(slotBody),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func Test_permit(t *testing.T) {
+	tests := map[string]struct {
+		subject  domain.AccessSubject
+		expected int
+	}{
+		"the guest or author": {subject: guestID, expected: http.StatusNoContent},
+		"the owner":           {subject: ownerID, expected: http.StatusNoContent},
+		"another subject": {
+			subject:  domain.AccessSubject(41),
+			expected: http.StatusForbidden,
+		},
+		"the unknown user": {
+			subject:  domain.AccessSubjectUnknowUser,
+			expected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			for _, url := range []string{"/api/v1/bookings/30", "/api/v1/blocks/30"} {
+				scheduler := &fakeScheduler{}
+				engine := newEngineAs(scheduler, tt.subject)
+
+				req := httptest.NewRequest(http.MethodDelete, url, nil)
+				rec := httptest.NewRecorder()
+				engine.ServeHTTP(rec, req)
+
+				assert.Equal(t, tt.expected, rec.Code, url)
+
+				if tt.expected == http.StatusNoContent {
+					assert.Equal(t, schedule.LongID(30), scheduler.booking, url)
+				} else {
+					assert.Zero(t, scheduler.booking, url)
+				}
+			}
+		})
+	}
+
+	t.Run("managing lots and prices needs a policy", func(t *testing.T) {
+		requests := []struct {
+			method string
+			url    string
+			body   string
+		}{
+			{http.MethodPost, "/api/v1/lots", `{"housing_id":10,"lot_id":20,"region":"fi"}`},
+			{http.MethodPost, "/api/v1/blocks", slotBody},
+			{http.MethodPut, "/api/v1/lots/20/availability", `{"region":"fi"}`},
+			{http.MethodPut, "/api/v1/lots/20/rates", `{}`},
+			{http.MethodPut, "/api/v1/charges?region=FI", `{"rules": []}`},
+			{http.MethodPut, "/api/v1/promotions/SUMMER", `{"kind": "percent"}`},
+		}
+
+		for _, r := range requests {
+			scheduler := &fakeScheduler{}
+			engine := newEngineAs(scheduler, guestID)
+
+			req := httptest.NewRequest(r.method, r.url, strings.NewReader(r.body))
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusForbidden, rec.Code, r.url)
+			assert.Zero(t, scheduler.slot.LotID, r.url)
+		}
+	})
+}
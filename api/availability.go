@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+type availabilityRequest struct {
+	timeSlotRequest
+
+	schedule.AvailabilityRules
+}
+
+func (h *handler) setAvailability(c *gin.Context) {
+	lot, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a number"})
+
+		return
+	}
+
+	var req availabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	req.LotID = lot
+
+	if !h.permit(
+		c,
+		domain.AccessDomainLot,
+		domain.AccessObject(lot),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	slot, err := request2timeSlot(req.timeSlotRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	err = h.scheduler.SetAvailability(
+		c.Request.Context(),
+		slot,
+		req.AvailabilityRules,
+	)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
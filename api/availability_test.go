@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SetAvailability(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngineAs(scheduler, ownerID)
+
+	body := `{
+		"housing_id": 10,
+		"region": "fi",
+		"weekdays": [6, 0],
+		"seasons": [{"from": {"month": 5, "day": 1}, "to": {"month": 9, "day": 30}}],
+		"exceptions": [{
+			"from": "2023-06-24T00:00:00Z",
+			"to": "2023-06-25T00:00:00Z",
+			"open": false
+		}]
+	}`
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/v1/lots/20/availability",
+		strings.NewReader(body),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, schedule.LongID(20), scheduler.slot.LotID)
+	assert.Equal(t, schedule.CodeID{'f', 'i'}, scheduler.slot.Region)
+	assert.Equal(t, schedule.CodeID{}, scheduler.slot.NodeID)
+
+	expected := schedule.AvailabilityRules{
+		Weekdays: []time.Weekday{time.Saturday, time.Sunday},
+		Seasons: []schedule.Season{{
+			From: schedule.MonthDay{Month: time.May, Day: 1},
+			To:   schedule.MonthDay{Month: time.September, Day: 30},
+		}},
+		Exceptions: []schedule.Exception{{
+			From: time.Date(2023, time.June, 24, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2023, time.June, 25, 0, 0, 0, 0, time.UTC),
+		}},
+	}
+	assert.Equal(t, expected, scheduler.rules)
+}
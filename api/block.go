@@ -0,0 +1,133 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+type blockRequest struct {
+	timeSlotRequest
+
+	Reason string `json:"reason"`
+}
+
+type blockResponse struct {
+	ID       uint64 `json:"id"`
+	Status   string `json:"status"`
+	AuthorID uint64 `json:"author_id"`
+	Reason   string `json:"reason"`
+
+	Slot timeSlotResponse `json:"slot"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var blockStatuses = map[schedule.BlockStatus]string{
+	schedule.BlockStatusActive:  "active",
+	schedule.BlockStatusRemoved: "removed",
+}
+
+func (h *handler) block(c *gin.Context) {
+	author, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	var req blockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	slot, err := request2timeSlot(req.timeSlotRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if !h.permit(
+		c,
+		domain.AccessDomainLot,
+		domain.AccessObject(slot.LotID),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	block, err := h.scheduler.Block(
+		c.Request.Context(),
+		slot,
+		req.Reason,
+		author,
+	)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": block2response(block)})
+}
+
+// unblock removes the block of the author, others need a policy
+// of the lot.
+func (h *handler) unblock(c *gin.Context) {
+	subject, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a number"})
+
+		return
+	}
+
+	block, err := h.scheduler.FindBlock(c.Request.Context(), schedule.LongID(id))
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	if block.Author != subject && !h.permit(
+		c,
+		domain.AccessDomainLot,
+		domain.AccessObject(block.Slot.LotID),
+		domain.AccessActionRemove,
+	) {
+		return
+	}
+
+	err = h.scheduler.Unblock(c.Request.Context(), block.ID)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func block2response(block schedule.Block) blockResponse {
+	return blockResponse{
+		ID:       uint64(block.ID),
+		Status:   blockStatuses[block.Status],
+		AuthorID: uint64(block.Author),
+		Reason:   block.Reason,
+
+		Slot: timeSlot2response(block.Slot),
+
+		CreatedAt: block.CreatedAt,
+		UpdatedAt: block.UpdatedAt,
+	}
+}
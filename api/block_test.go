@@ -0,0 +1,58 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Block(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngineAs(scheduler, ownerID)
+
+	body := strings.Replace(
+		slotBody,
+		`"lot_id": 20`,
+		`"lot_id": 20, "reason": "renovation"`,
+		1,
+	)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/blocks",
+		strings.NewReader(body),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, schedule.LongID(20), scheduler.slot.LotID)
+	assert.Equal(t, ownerID, scheduler.guest)
+	assert.Equal(t, "renovation", scheduler.reason)
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &resp)
+	require.NoError(t, err)
+	assert.Equal(t, "active", resp.Data["status"])
+	assert.Equal(t, "renovation", resp.Data["reason"])
+}
+
+func Test_Unblock(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/blocks/30", nil)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, schedule.LongID(30), scheduler.booking)
+}
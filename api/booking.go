@@ -0,0 +1,286 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+type timeSlotRequest struct {
+	NodeID    string `json:"node_id"`
+	HousingID uint64 `json:"housing_id"`
+	LotID     uint64 `json:"lot_id"`
+
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+
+	Region      string `json:"region"`
+	Area        uint16 `json:"area"`
+	Locality    uint16 `json:"locality"`
+	Sublocality uint16 `json:"sublocality"`
+}
+
+type bookingRequest struct {
+	timeSlotRequest
+
+	PromoCode string `json:"promo_code"`
+}
+
+type batchBookingRequest struct {
+	Slots []timeSlotRequest `json:"slots"`
+}
+
+type bookingResponse struct {
+	ID      uint64 `json:"id"`
+	Status  string `json:"status"`
+	GuestID uint64 `json:"guest_id"`
+
+	Slot timeSlotResponse `json:"slot"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var bookingStatuses = map[schedule.BookingStatus]string{
+	schedule.BookingStatusConfirmed: "confirmed",
+	schedule.BookingStatusCancelled: "cancelled",
+	schedule.BookingStatusHeld:      "held",
+	schedule.BookingStatusExpired:   "expired",
+}
+
+func (h *handler) book(c *gin.Context) {
+	guest, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	var req bookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	slot, err := request2timeSlot(req.timeSlotRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	booking, err := h.scheduler.BookWithCode(
+		c.Request.Context(),
+		slot,
+		guest,
+		req.PromoCode,
+	)
+	if err != nil {
+		abortWithPromotionError(c, err, abortWithSchedulerError)
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": booking2response(booking)})
+}
+
+func (h *handler) bookMany(c *gin.Context) {
+	guest, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	var req batchBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	if len(req.Slots) == 0 || len(req.Slots) > maxLimit {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("slots: must contain 1 to %d items", maxLimit),
+		})
+
+		return
+	}
+
+	slots := make([]schedule.TimeSlot, len(req.Slots))
+	for idx, slotReq := range req.Slots {
+		slot, err := request2timeSlot(slotReq)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":      fmt.Sprintf("slots[%d].%s", idx, err),
+				"slot_index": idx,
+			})
+
+			return
+		}
+
+		slots[idx] = slot
+	}
+
+	bookings, err := h.scheduler.BookMany(
+		c.Request.Context(),
+		slots,
+		guest,
+	)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	result := make([]bookingResponse, len(bookings))
+	for idx, booking := range bookings {
+		result[idx] = booking2response(booking)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": result})
+}
+
+// cancel cancels the booking of the guest, others need a policy
+// of the lot.
+func (h *handler) cancel(c *gin.Context) {
+	subject, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a number"})
+
+		return
+	}
+
+	booking, err := h.scheduler.FindBooking(c.Request.Context(), schedule.LongID(id))
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	if booking.Guest != subject && !h.permit(
+		c,
+		domain.AccessDomainLot,
+		domain.AccessObject(booking.Slot.LotID),
+		domain.AccessActionRemove,
+	) {
+		return
+	}
+
+	err = h.scheduler.Cancel(c.Request.Context(), booking.ID)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) registerLot(c *gin.Context) {
+	var req timeSlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	if !h.permit(
+		c,
+		domain.AccessDomainHousing,
+		domain.AccessObject(req.HousingID),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	slot, err := request2timeSlot(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if err := h.scheduler.RegisterLot(c.Request.Context(), slot); err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": timeSlot2response(slot)})
+}
+
+func request2timeSlot(req timeSlotRequest) (schedule.TimeSlot, error) {
+	slot := schedule.TimeSlot{
+		HousingID: schedule.LongID(req.HousingID),
+		LotID:     schedule.LongID(req.LotID),
+
+		StartAt: req.StartAt,
+		EndAt:   req.EndAt,
+
+		Area:        schedule.ID(req.Area),
+		Locality:    schedule.ID(req.Locality),
+		Sublocality: schedule.ID(req.Sublocality),
+	}
+
+	var err error
+	if slot.Region, err = parseCodeID(req.Region); err != nil {
+		return slot, fmt.Errorf("region: %w", err)
+	}
+
+	// The scheduler finds the node by the region unless it is set.
+	if req.NodeID != "" {
+		if slot.NodeID, err = parseCodeID(req.NodeID); err != nil {
+			return slot, fmt.Errorf("node_id: %w", err)
+		}
+	}
+
+	return slot, nil
+}
+
+func booking2response(booking schedule.Booking) bookingResponse {
+	return bookingResponse{
+		ID:      uint64(booking.ID),
+		Status:  bookingStatuses[booking.Status],
+		GuestID: uint64(booking.Guest),
+
+		Slot: timeSlot2response(booking.Slot),
+
+		CreatedAt: booking.CreatedAt,
+		UpdatedAt: booking.UpdatedAt,
+	}
+}
+
+func abortWithSchedulerError(c *gin.Context, err error) {
+	body := gin.H{"error": err.Error()}
+
+	// The failed slot of a batch is reported by its index in the request.
+	var slotErr *schedule.SlotError
+	if errors.As(err, &slotErr) {
+		body["slot_index"] = slotErr.Index
+	}
+
+	switch {
+	case errors.Is(err, schedule.ErrUnavailable):
+		c.JSON(http.StatusConflict, body)
+	case errors.Is(err, schedule.ErrNotFound):
+		c.JSON(http.StatusNotFound, body)
+	case errors.Is(err, schedule.ErrExpired):
+		c.JSON(http.StatusGone, body)
+	case errors.Is(err, schedule.ErrInvalidSlot),
+		errors.Is(err, schedule.ErrInvalidQuery),
+		errors.Is(err, schedule.ErrInvalidRules),
+		errors.Is(err, schedule.ErrOutOfHorizon):
+		c.JSON(http.StatusUnprocessableEntity, body)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
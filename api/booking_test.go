@@ -0,0 +1,287 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/promotion"
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slotBody = `{
+	"housing_id": 10,
+	"lot_id": 20,
+	"region": "fi",
+	"area": 1,
+	"locality": 2,
+	"sublocality": 3,
+	"start_at": "2023-01-01T14:00:00Z",
+	"end_at": "2023-01-03T12:00:00Z"
+}`
+
+func Test_Book(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/bookings",
+		strings.NewReader(slotBody),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// The node is left to the scheduler to find by the region.
+	expected := schedule.TimeSlot{
+		HousingID:   10,
+		LotID:       20,
+		StartAt:     time.Date(2023, time.January, 1, 14, 0, 0, 0, time.UTC),
+		EndAt:       time.Date(2023, time.January, 3, 12, 0, 0, 0, time.UTC),
+		Region:      schedule.CodeID{'f', 'i'},
+		Area:        1,
+		Locality:    2,
+		Sublocality: 3,
+	}
+	assert.Equal(t, expected, scheduler.slot)
+	assert.Equal(t, guestID, scheduler.guest)
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), body.Data["id"])
+	assert.Equal(t, "confirmed", body.Data["status"])
+	assert.Empty(t, scheduler.code)
+}
+
+func Test_Book_promo_code(t *testing.T) {
+	cases := map[error]int{
+		nil:                        http.StatusCreated,
+		promotion.ErrExhausted:     http.StatusConflict,
+		promotion.ErrNotFound:      http.StatusNotFound,
+		promotion.ErrNotApplicable: http.StatusUnprocessableEntity,
+	}
+
+	body := strings.Replace(slotBody, "{", `{"promo_code": "SUMMER",`, 1)
+
+	for promoErr, code := range cases {
+		scheduler := &fakeScheduler{}
+		if promoErr != nil {
+			scheduler.err = fmt.Errorf("wrapped, %w", promoErr)
+		}
+
+		engine := newEngine(scheduler)
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings",
+			strings.NewReader(body),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, code, rec.Code, promoErr)
+		assert.Equal(t, "SUMMER", scheduler.code)
+	}
+}
+
+func Test_Book_scheduler_errors(t *testing.T) {
+	cases := map[error]int{
+		schedule.ErrUnavailable:  http.StatusConflict,
+		schedule.ErrNotFound:     http.StatusNotFound,
+		schedule.ErrInvalidSlot:  http.StatusUnprocessableEntity,
+		fmt.Errorf("db is down"): http.StatusInternalServerError,
+	}
+
+	for schedErr, code := range cases {
+		scheduler := &fakeScheduler{err: fmt.Errorf("wrapped, %w", schedErr)}
+		engine := newEngine(scheduler)
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings",
+			strings.NewReader(slotBody),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, code, rec.Code, schedErr.Error())
+	}
+}
+
+func Test_Book_malformed_body(t *testing.T) {
+	engine := newEngine(&fakeScheduler{})
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/bookings",
+		strings.NewReader(`{"region": 1}`),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func Test_BookMany(t *testing.T) {
+	body := `{"slots": [` + slotBody + `,` +
+		strings.Replace(slotBody, `"lot_id": 20`, `"lot_id": 21`, 1) + `]}`
+
+	t.Run("all slots are booked", func(t *testing.T) {
+		scheduler := &fakeScheduler{}
+		engine := newEngine(scheduler)
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings/batch",
+			strings.NewReader(body),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		require.Len(t, scheduler.slots, 2)
+		assert.Equal(t, schedule.LongID(21), scheduler.slots[1].LotID)
+		assert.Equal(t, guestID, scheduler.guest)
+
+		var resp struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		err := json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Len(t, resp.Data, 2)
+	})
+
+	t.Run("conflicting slot is reported", func(t *testing.T) {
+		scheduler := &fakeScheduler{
+			err: fmt.Errorf("wrapped, %w", &schedule.SlotError{
+				Index: 1,
+				Err:   schedule.ErrUnavailable,
+			}),
+		}
+		engine := newEngine(scheduler)
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings/batch",
+			strings.NewReader(body),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+
+		var resp map[string]interface{}
+		err := json.Unmarshal(rec.Body.Bytes(), &resp)
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), resp["slot_index"])
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		engine := newEngine(&fakeScheduler{})
+
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/api/v1/bookings/batch",
+			strings.NewReader(`{"slots": []}`),
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_Cancel(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/bookings/30", nil)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, schedule.LongID(30), scheduler.booking)
+}
+
+func Test_RegisterLot(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngineAs(scheduler, ownerID)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/lots",
+		strings.NewReader(`{"housing_id":10,"lot_id":20,"region":"fi"}`),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, schedule.LongID(20), scheduler.slot.LotID)
+}
+
+func Test_Hold(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/holds",
+		strings.NewReader(slotBody),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 15*time.Minute, scheduler.ttl)
+
+	req = httptest.NewRequest(
+		http.MethodPost,
+		"/api/v1/holds/token/confirm",
+		nil,
+	)
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "token", scheduler.token)
+	assert.Equal(t, guestID, scheduler.guest)
+}
+
+func Test_unauthenticated(t *testing.T) {
+	requests := map[string]string{
+		"/api/v1/bookings":            slotBody,
+		"/api/v1/bookings/batch":      `{"slots": [` + slotBody + `]}`,
+		"/api/v1/blocks":              slotBody,
+		"/api/v1/holds":               slotBody,
+		"/api/v1/holds/token/confirm": "",
+	}
+
+	for url, body := range requests {
+		url, body := url, body
+
+		t.Run(url, func(t *testing.T) {
+			scheduler := &fakeScheduler{}
+			engine := newEngineAs(scheduler, domain.AccessSubjectUnknowUser)
+
+			req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Zero(t, scheduler.guest)
+			assert.Zero(t, scheduler.slot.LotID)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+const maxCalendarDays = 366
+
+type calendarResponse struct {
+	LotID uint64   `json:"lot_id"`
+	From  string   `json:"from"`
+	Days  []string `json:"days"`
+}
+
+var dayStatuses = map[schedule.DayStatus]string{
+	schedule.DayStatusFree:    "free",
+	schedule.DayStatusPartial: "partial",
+	schedule.DayStatusBooked:  "booked",
+	schedule.DayStatusBlocked: "blocked",
+	schedule.DayStatusClosed:  "closed",
+}
+
+func (h *handler) calendar(c *gin.Context) {
+	query, err := parseCalendarQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	calendar, err := h.scheduler.Calendar(c.Request.Context(), query)
+	if errors.Is(err, schedule.ErrOutOfHorizon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": calendar2response(calendar)})
+}
+
+func parseCalendarQuery(c *gin.Context) (schedule.Query, error) {
+	var (
+		query schedule.Query
+		err   error
+	)
+
+	lot, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || lot == 0 {
+		return query, fmt.Errorf("id must be a number, %w", ErrInvalidParam)
+	}
+
+	query.LotID = schedule.LongID(lot)
+
+	if query.Region, query.NodeID, err = parseRegion(c); err != nil {
+		return query, err
+	}
+
+	if query.From, query.To, err = parseRange(c); err != nil {
+		return query, err
+	}
+
+	if query.To.Sub(query.From) > maxCalendarDays*24*time.Hour {
+		return query, fmt.Errorf(
+			"range must not exceed %d days, %w", maxCalendarDays, ErrInvalidParam,
+		)
+	}
+
+	return query, nil
+}
+
+func calendar2response(calendar schedule.Calendar) calendarResponse {
+	days := make([]string, len(calendar.Days))
+	for idx, status := range calendar.Days {
+		days[idx] = dayStatuses[status]
+	}
+
+	return calendarResponse{
+		LotID: uint64(calendar.LotID),
+		From:  calendar.From.Format(dateLayout),
+		Days:  days,
+	}
+}
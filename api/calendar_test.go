@@ -0,0 +1,63 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Calendar(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/lots/20/calendar?region=fi&from=2023-01-01&to=2023-01-04",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, schedule.LongID(20), scheduler.query.LotID)
+	assert.Equal(t, schedule.CodeID{'f', 'i'}, scheduler.query.Region)
+	assert.Equal(t, schedule.CodeID{}, scheduler.query.NodeID)
+
+	var body struct {
+		Data struct {
+			LotID uint64   `json:"lot_id"`
+			From  string   `json:"from"`
+			Days  []string `json:"days"`
+		} `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(20), body.Data.LotID)
+	assert.Equal(t, "2023-01-01", body.Data.From)
+	assert.Equal(t, []string{"free", "partial", "booked"}, body.Data.Days)
+}
+
+func Test_Calendar_invalid_params(t *testing.T) {
+	urls := []string{
+		"/api/v1/lots/lot/calendar?region=fi&from=2023-01-01&to=2023-01-04",
+		"/api/v1/lots/20/calendar?from=2023-01-01&to=2023-01-04",
+		"/api/v1/lots/20/calendar?region=fi&from=2023-01-04&to=2023-01-01",
+		"/api/v1/lots/20/calendar?region=fi&from=2023-01-01&to=2025-01-01",
+	}
+
+	for _, url := range urls {
+		engine := newEngine(&fakeScheduler{})
+
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+type facetResponse struct {
+	ID       uint16 `json:"id"`
+	Area     uint16 `json:"area,omitempty"`
+	Locality uint16 `json:"locality,omitempty"`
+	Count    uint64 `json:"count"`
+}
+
+var facetLevels = map[string]schedule.Level{
+	"area":        schedule.LevelArea,
+	"locality":    schedule.LevelLocality,
+	"sublocality": schedule.LevelSublocality,
+}
+
+func (h *handler) facets(c *gin.Context) {
+	query, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	level, ok := facetLevels[c.Query("by")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf(
+				"by: must be area, locality or sublocality, %s", ErrInvalidParam,
+			),
+		})
+
+		return
+	}
+
+	facets, err := h.scheduler.Facets(c.Request.Context(), query, level)
+	if errors.Is(err, schedule.ErrOutOfHorizon) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	data := make([]facetResponse, len(facets))
+	for idx, facet := range facets {
+		data[idx] = facetResponse{
+			ID:       uint16(facet.ID),
+			Area:     uint16(facet.Area),
+			Locality: uint16(facet.Locality),
+			Count:    facet.Count,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
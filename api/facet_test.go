@@ -0,0 +1,39 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Facets(t *testing.T) {
+	scheduler := &fakeScheduler{}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search/facets?region=fi&area=1&by=locality&from=2023-01-01&to=2023-01-04",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, schedule.LevelLocality, scheduler.level)
+	assert.Equal(t, schedule.ID(1), scheduler.query.Area)
+	assert.JSONEq(t, `{"data":[{"id":1,"area":1,"count":23}]}`, rec.Body.String())
+
+	req = httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search/facets?region=fi&by=street&from=2023-01-01&to=2023-01-04",
+		nil,
+	)
+	rec = httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultHoldTTL = 15 * time.Minute
+	maxHoldTTL     = time.Hour
+)
+
+type holdRequest struct {
+	timeSlotRequest
+
+	// TTL is in seconds.
+	TTL uint64 `json:"ttl"`
+}
+
+type holdResponse struct {
+	Token     string           `json:"token"`
+	BookingID uint64           `json:"booking_id"`
+	Slot      timeSlotResponse `json:"slot"`
+	ExpiresAt time.Time        `json:"expires_at"`
+}
+
+func (h *handler) hold(c *gin.Context) {
+	if _, ok := authSubject(c); !ok {
+		return
+	}
+
+	var req holdRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	slot, err := request2timeSlot(req.timeSlotRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	ttl := defaultHoldTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+
+	if ttl > maxHoldTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl is too long"})
+
+		return
+	}
+
+	hold, err := h.scheduler.Hold(c.Request.Context(), slot, ttl)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": holdResponse{
+		Token:     hold.Token,
+		BookingID: uint64(hold.BookingID),
+		Slot:      timeSlot2response(hold.Slot),
+		ExpiresAt: hold.ExpiresAt,
+	}})
+}
+
+func (h *handler) confirm(c *gin.Context) {
+	guest, ok := authSubject(c)
+	if !ok {
+		return
+	}
+
+	booking, err := h.scheduler.Confirm(
+		c.Request.Context(),
+		c.Param("token"),
+		guest,
+	)
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": booking2response(booking)})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+type dayPriceResponse struct {
+	Date  string           `json:"date"`
+	Price *currency.Amount `json:"price"`
+	LotID uint64           `json:"lot_id,omitempty"`
+	Lots  int              `json:"lots"`
+}
+
+type priceCalendarResponse struct {
+	From string             `json:"from"`
+	Days []dayPriceResponse `json:"days"`
+}
+
+func (h *handler) lotPriceCalendar(c *gin.Context) {
+	query, err := parseCalendarQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	h.priceCalendar(c, query)
+}
+
+func (h *handler) regionPriceCalendar(c *gin.Context) {
+	var (
+		query schedule.Query
+		err   error
+	)
+
+	// All nodes of the region are looked at unless the node is set.
+	if query.Region, query.NodeID, err = parseRegion(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	for param, val := range map[string]*schedule.ID{
+		"area":        &query.Area,
+		"locality":    &query.Locality,
+		"sublocality": &query.Sublocality,
+	} {
+		if *val, err = parseID(c.Query(param)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + ": " + err.Error()})
+
+			return
+		}
+	}
+
+	if query.From, query.To, err = parseRange(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if query.To.Sub(query.From) > maxCalendarDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf(
+				"range must not exceed %d days, %s", maxCalendarDays, ErrInvalidParam,
+			),
+		})
+
+		return
+	}
+
+	h.priceCalendar(c, query)
+}
+
+func (h *handler) priceCalendar(c *gin.Context, query schedule.Query) {
+	calendar, err := h.pricer.PriceCalendar(
+		c.Request.Context(),
+		query,
+		c.Query("currency"),
+	)
+
+	switch {
+	case errors.Is(err, schedule.ErrInvalidQuery),
+		errors.Is(err, schedule.ErrOutOfHorizon):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		abortWithPricingError(c, err)
+	default:
+		c.JSON(http.StatusOK, gin.H{"data": priceCalendar2response(calendar)})
+	}
+}
+
+func priceCalendar2response(calendar pricing.PriceCalendar) priceCalendarResponse {
+	days := make([]dayPriceResponse, len(calendar.Days))
+	for idx, day := range calendar.Days {
+		days[idx] = dayPriceResponse{
+			Date:  day.Date.Format(dateLayout),
+			Price: day.Price,
+			LotID: uint64(day.LotID),
+			Lots:  day.Lots,
+		}
+	}
+
+	return priceCalendarResponse{
+		From: calendar.From.Format(dateLayout),
+		Days: days,
+	}
+}
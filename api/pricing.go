@@ -0,0 +1,284 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/l10n"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+type nightResponse struct {
+	Date       string          `json:"date"`
+	Nightly    currency.Amount `json:"nightly"`
+	Weekend    currency.Amount `json:"weekend"`
+	ExtraGuest currency.Amount `json:"extra_guest"`
+	Total      currency.Amount `json:"total"`
+}
+
+type chargeResponse struct {
+	Name   string             `json:"name"`
+	Label  string             `json:"label"`
+	Kind   pricing.ChargeKind `json:"kind"`
+	Amount currency.Amount    `json:"amount"`
+}
+
+type discountResponse struct {
+	Code   string          `json:"code"`
+	Amount currency.Amount `json:"amount"`
+}
+
+type quoteResponse struct {
+	LotID    uint64            `json:"lot_id"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Guests   uint8             `json:"guests"`
+	Nights   []nightResponse   `json:"nights"`
+	Subtotal currency.Amount   `json:"subtotal"`
+	Charges  []chargeResponse  `json:"charges"`
+	Discount *discountResponse `json:"discount,omitempty"`
+	Total    currency.Amount   `json:"total"`
+}
+
+type chargesRequest struct {
+	Rules []pricing.Rule `json:"rules"`
+}
+
+func (h *handler) setRates(c *gin.Context) {
+	lot, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "id must be a number"})
+
+		return
+	}
+
+	if !h.permit(
+		c,
+		domain.AccessDomainLot,
+		domain.AccessObject(lot),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	var rates pricing.Rates
+	if err := c.ShouldBindJSON(&rates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	err = h.pricer.SetRates(c.Request.Context(), schedule.LongID(lot), rates)
+	if err != nil {
+		abortWithPricingError(c, err)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) setCharges(c *gin.Context) {
+	location, err := parseLocation(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if !h.permit(
+		c,
+		domain.AccessDomainCharge,
+		regionObject(location.Region),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	var req chargesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	err = h.pricer.SetCharges(c.Request.Context(), location, req.Rules)
+	if err != nil {
+		abortWithPricingError(c, err)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *handler) quote(c *gin.Context) {
+	lot, err := parseUint(c.Query("lot_id"), 64)
+	if err != nil || lot == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("lot_id: must be a number, %s", ErrInvalidParam),
+		})
+
+		return
+	}
+
+	from, to, err := parseRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	guests, err := parseUint(c.DefaultQuery("guests", "1"), 8)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "guests: " + err.Error()})
+
+		return
+	}
+
+	// Taxes and fees of the location are charged if the region is set.
+	var location pricing.Location
+	if c.Query("region") != "" {
+		if location, err = parseLocation(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+			return
+		}
+	}
+
+	quote, err := h.pricer.Quote(
+		c.Request.Context(),
+		schedule.LongID(lot),
+		location,
+		from,
+		to,
+		uint8(guests),
+	)
+	if err != nil {
+		abortWithPricingError(c, err)
+
+		return
+	}
+
+	if code := c.Query("promo"); code != "" {
+		if h.promoter == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("promo: is not accepted, %s", ErrInvalidParam),
+			})
+
+			return
+		}
+
+		if quote, err = h.promoter.Apply(c.Request.Context(), code, quote); err != nil {
+			abortWithPromotionError(c, err, abortWithPricingError)
+
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": quote2response(quote, printer(c))})
+}
+
+func parseLocation(c *gin.Context) (pricing.Location, error) {
+	var (
+		location pricing.Location
+		err      error
+	)
+
+	if location.Region, err = parseCodeID(c.Query("region")); err != nil {
+		return location, fmt.Errorf("region: %w", err)
+	}
+
+	if location.Area, err = parseID(c.Query("area")); err != nil {
+		return location, fmt.Errorf("area: %w", err)
+	}
+
+	if location.Locality, err = parseID(c.Query("locality")); err != nil {
+		return location, fmt.Errorf("locality: %w", err)
+	}
+
+	return location, nil
+}
+
+// printer translates labels to the language of the lng parameter
+// or of the Accept-Language header.
+func printer(c *gin.Context) *message.Printer {
+	lngTags, _, _ := language.ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+
+	if lng, err := language.Parse(c.Query("lng")); err == nil {
+		lngTags = append([]language.Tag{lng}, lngTags...)
+	}
+
+	lngTag, _, _ := language.NewMatcher(lngTags).Match()
+	if lngTag.IsRoot() {
+		lngTag = language.English
+	}
+
+	return message.NewPrinter(lngTag)
+}
+
+func quote2response(quote pricing.Quote, prt *message.Printer) quoteResponse {
+	nights := make([]nightResponse, len(quote.Nights))
+	for idx, night := range quote.Nights {
+		nights[idx] = nightResponse{
+			Date:       night.Date.Format(dateLayout),
+			Nightly:    night.Nightly,
+			Weekend:    night.Weekend,
+			ExtraGuest: night.ExtraGuest,
+			Total:      night.Total,
+		}
+	}
+
+	charges := make([]chargeResponse, len(quote.Charges))
+	for idx, charge := range quote.Charges {
+		charges[idx] = chargeResponse{
+			Name:   charge.Name,
+			Label:  l10n.Label(prt, charge.Name),
+			Kind:   charge.Kind,
+			Amount: charge.Amount,
+		}
+	}
+
+	var discount *discountResponse
+	if quote.Discount != nil {
+		discount = &discountResponse{
+			Code:   quote.Discount.Code,
+			Amount: quote.Discount.Amount,
+		}
+	}
+
+	return quoteResponse{
+		LotID:    uint64(quote.LotID),
+		From:     quote.From,
+		To:       quote.To,
+		Guests:   quote.Guests,
+		Nights:   nights,
+		Subtotal: quote.Subtotal,
+		Charges:  charges,
+		Discount: discount,
+		Total:    quote.Total,
+	}
+}
+
+func abortWithPricingError(c *gin.Context, err error) {
+	body := gin.H{"error": err.Error()}
+
+	switch {
+	case errors.Is(err, pricing.ErrNotFound):
+		c.JSON(http.StatusNotFound, body)
+	case errors.Is(err, pricing.ErrInvalidRates),
+		errors.Is(err, pricing.ErrInvalidQuote):
+		c.JSON(http.StatusUnprocessableEntity, body)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal error"})
+	}
+}
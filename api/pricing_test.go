@@ -0,0 +1,508 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/api"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/promotion"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePricer struct {
+	lotID    schedule.LongID
+	rates    pricing.Rates
+	location pricing.Location
+	rules    []pricing.Rule
+	from     time.Time
+	to       time.Time
+	guests   uint8
+	query    schedule.Query
+	currency string
+	err      error
+}
+
+func (f *fakePricer) SetRates(
+	ctx context.Context,
+	lotID schedule.LongID,
+	rates pricing.Rates,
+) error {
+	f.lotID = lotID
+	f.rates = rates
+
+	return f.err
+}
+
+func (f *fakePricer) SetCharges(
+	ctx context.Context,
+	location pricing.Location,
+	rules []pricing.Rule,
+) error {
+	f.location = location
+	f.rules = rules
+
+	return f.err
+}
+
+func (f *fakePricer) Quote(
+	ctx context.Context,
+	lotID schedule.LongID,
+	location pricing.Location,
+	from time.Time,
+	to time.Time,
+	guests uint8,
+) (pricing.Quote, error) {
+	f.lotID = lotID
+	f.location = location
+	f.from = from
+	f.to = to
+	f.guests = guests
+
+	price, _ := currency.NewAmount("120.50", "EUR")
+	zero, _ := currency.NewAmount("0", "EUR")
+	tax, _ := currency.NewAmount("6", "EUR")
+	total, _ := currency.NewAmount("126.50", "EUR")
+
+	quote := pricing.Quote{
+		LotID:  lotID,
+		From:   from,
+		To:     to,
+		Guests: guests,
+		Nights: []pricing.Night{{
+			Date:       from,
+			Nightly:    price,
+			Weekend:    zero,
+			ExtraGuest: zero,
+			Total:      price,
+		}},
+		Subtotal: price,
+		Charges: []pricing.Charge{{
+			Name:   "tourist_tax",
+			Kind:   pricing.ChargePerPerson,
+			Amount: tax,
+		}},
+		Total: total,
+	}
+
+	return quote, f.err
+}
+
+func (f *fakePricer) PriceCalendar(
+	ctx context.Context,
+	query schedule.Query,
+	currencyCode string,
+) (pricing.PriceCalendar, error) {
+	f.query = query
+	f.currency = currencyCode
+
+	price, _ := currency.NewAmount("80", "EUR")
+
+	calendar := pricing.PriceCalendar{
+		From: query.From,
+		Days: []pricing.DayPrice{
+			{Date: query.From, Price: &price, LotID: 20, Lots: 3},
+			{Date: query.From.AddDate(0, 0, 1)},
+		},
+	}
+
+	return calendar, f.err
+}
+
+type fakePromoter struct {
+	promo promotion.Promotion
+	code  string
+	err   error
+}
+
+func (f *fakePromoter) SetPromotion(
+	ctx context.Context,
+	promo promotion.Promotion,
+) error {
+	f.promo = promo
+
+	return f.err
+}
+
+func (f *fakePromoter) Apply(
+	ctx context.Context,
+	code string,
+	quote pricing.Quote,
+) (pricing.Quote, error) {
+	f.code = code
+
+	discount, _ := currency.NewAmount("20", "EUR")
+	total, _ := quote.Total.Sub(discount)
+
+	quote.Discount = &pricing.Discount{Code: code, Amount: discount}
+	quote.Total = total
+
+	return quote, f.err
+}
+
+func newPricingEngine(pricer *fakePricer) *gin.Engine {
+	return newPromotionEngine(pricer, &fakePromoter{})
+}
+
+func newPromotionEngine(pricer *fakePricer, promoter *fakePromoter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(bearer(ownerID))
+	api.APIRouter(
+		engine,
+		api.WithPricer(pricer),
+		api.WithPromoter(promoter),
+		api.WithAuthenticator(tokens),
+		api.WithAccessController(fakeAccess{}),
+	)
+
+	return engine
+}
+
+func Test_SetRates(t *testing.T) {
+	pricer := &fakePricer{}
+	engine := newPricingEngine(pricer)
+
+	body := `{
+		"nightly": {"number": "100", "currency": "EUR"},
+		"weekend": {"number": "20", "currency": "EUR"},
+		"guests": 2
+	}`
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/v1/lots/20/rates",
+		strings.NewReader(body),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, schedule.LongID(20), pricer.lotID)
+	assert.Equal(t, "100 EUR", pricer.rates.Nightly.String())
+	require.NotNil(t, pricer.rates.Weekend)
+	assert.Equal(t, "20 EUR", pricer.rates.Weekend.String())
+	assert.Nil(t, pricer.rates.ExtraGuest)
+	assert.Equal(t, uint8(2), pricer.rates.Guests)
+}
+
+func Test_SetCharges(t *testing.T) {
+	pricer := &fakePricer{}
+	engine := newPricingEngine(pricer)
+
+	body := `{"rules": [
+		{"name": "vat", "kind": "percent", "percent": "10"},
+		{
+			"name": "tourist_tax",
+			"kind": "per_person",
+			"amount": {"number": "2", "currency": "EUR"}
+		}
+	]}`
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/v1/charges?region=FI&area=1",
+		strings.NewReader(body),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, pricing.Location{
+		Region: schedule.CodeID{'F', 'I'},
+		Area:   1,
+	}, pricer.location)
+	require.Len(t, pricer.rules, 2)
+	assert.Equal(t, pricing.ChargePercent, pricer.rules[0].Kind)
+	require.NotNil(t, pricer.rules[1].Amount)
+	assert.Equal(t, "2 EUR", pricer.rules[1].Amount.String())
+}
+
+func Test_Quote(t *testing.T) {
+	pricer := &fakePricer{}
+	engine := newPricingEngine(pricer)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/quote?lot_id=20&from=2023-07-01&to=2023-07-02&guests=3"+
+			"&region=FI&area=1&locality=2",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, schedule.LongID(20), pricer.lotID)
+	assert.Equal(t, uint8(3), pricer.guests)
+	assert.Equal(t, pricing.Location{
+		Region:   schedule.CodeID{'F', 'I'},
+		Area:     1,
+		Locality: 2,
+	}, pricer.location)
+	assert.JSONEq(t, `{"data": {
+		"lot_id": 20,
+		"from": "2023-07-01T00:00:00Z",
+		"to": "2023-07-02T00:00:00Z",
+		"guests": 3,
+		"nights": [{
+			"date": "2023-07-01",
+			"nightly": {"number": "120.50", "currency": "EUR"},
+			"weekend": {"number": "0", "currency": "EUR"},
+			"extra_guest": {"number": "0", "currency": "EUR"},
+			"total": {"number": "120.50", "currency": "EUR"}
+		}],
+		"subtotal": {"number": "120.50", "currency": "EUR"},
+		"charges": [{
+			"name": "tourist_tax",
+			"label": "tourist_tax",
+			"kind": "per_person",
+			"amount": {"number": "6", "currency": "EUR"}
+		}],
+		"total": {"number": "126.50", "currency": "EUR"}
+	}}`, rec.Body.String())
+}
+
+func Test_Quote_errors(t *testing.T) {
+	cases := map[string]struct {
+		params string
+		err    error
+		code   int
+	}{
+		"without lot": {
+			"from=2023-07-01&to=2023-07-02", nil, http.StatusBadRequest,
+		},
+		"without dates": {
+			"lot_id=20", nil, http.StatusBadRequest,
+		},
+		"invalid region": {
+			"lot_id=20&from=2023-07-01&to=2023-07-02&region=FIN",
+			nil,
+			http.StatusBadRequest,
+		},
+		"too many guests": {
+			"lot_id=20&from=2023-07-01&to=2023-07-02&guests=300",
+			nil,
+			http.StatusBadRequest,
+		},
+		"lot without rates": {
+			"lot_id=20&from=2023-07-01&to=2023-07-02",
+			pricing.ErrNotFound,
+			http.StatusNotFound,
+		},
+		"invalid quote": {
+			"lot_id=20&from=2023-07-01&to=2023-07-02",
+			pricing.ErrInvalidQuote,
+			http.StatusUnprocessableEntity,
+		},
+	}
+
+	for name, tc := range cases {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			pricer := &fakePricer{}
+			if tc.err != nil {
+				pricer.err = fmt.Errorf("wrapped, %w", tc.err)
+			}
+
+			engine := newPricingEngine(pricer)
+
+			req := httptest.NewRequest(
+				http.MethodGet,
+				"/api/v1/quote?"+tc.params,
+				nil,
+			)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.code, rec.Code)
+		})
+	}
+}
+
+func Test_Quote_promo(t *testing.T) {
+	pricer := &fakePricer{}
+	promoter := &fakePromoter{}
+	engine := newPromotionEngine(pricer, promoter)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/quote?lot_id=20&from=2023-07-01&to=2023-07-02&promo=SUMMER",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "SUMMER", promoter.code)
+
+	var body struct {
+		Data struct {
+			Discount struct {
+				Code   string          `json:"code"`
+				Amount currency.Amount `json:"amount"`
+			} `json:"discount"`
+			Total currency.Amount `json:"total"`
+		} `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	require.NoError(t, err)
+	assert.Equal(t, "SUMMER", body.Data.Discount.Code)
+	assert.Equal(t, "20 EUR", body.Data.Discount.Amount.String())
+	assert.Equal(t, "106.50 EUR", body.Data.Total.String())
+
+	t.Run("code is not applicable", func(t *testing.T) {
+		promoter := &fakePromoter{err: promotion.ErrNotApplicable}
+		engine := newPromotionEngine(pricer, promoter)
+
+		req := httptest.NewRequest(
+			http.MethodGet,
+			"/api/v1/quote?lot_id=20&from=2023-07-01&to=2023-07-02&promo=SUMMER",
+			nil,
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
+
+func Test_SetPromotion(t *testing.T) {
+	promoter := &fakePromoter{}
+	engine := newPromotionEngine(&fakePricer{}, promoter)
+
+	body := `{
+		"kind": "amount",
+		"amount": {"number": "25", "currency": "EUR"},
+		"ends_at": "2023-09-01T00:00:00Z",
+		"region": "FI",
+		"min_nights": 3,
+		"max_redemptions": 100
+	}`
+
+	req := httptest.NewRequest(
+		http.MethodPut,
+		"/api/v1/promotions/SUMMER",
+		strings.NewReader(body),
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "SUMMER", promoter.promo.Code)
+	assert.Equal(t, promotion.KindAmount, promoter.promo.Kind)
+	require.NotNil(t, promoter.promo.Amount)
+	assert.Equal(t, "25 EUR", promoter.promo.Amount.String())
+	assert.Equal(t, schedule.CodeID{'F', 'I'}, promoter.promo.Region)
+	assert.Equal(t, uint16(3), promoter.promo.MinNights)
+	assert.Equal(t, uint32(100), promoter.promo.MaxRedemptions)
+	assert.True(t, promoter.promo.StartsAt.IsZero())
+}
+
+func Test_PriceCalendar(t *testing.T) {
+	pricer := &fakePricer{}
+	engine := newPricingEngine(pricer)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/price-calendar?region=FI&area=1&from=2023-07-01&to=2023-07-03"+
+			"&currency=USD",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, schedule.CodeID{'F', 'I'}, pricer.query.Region)
+	assert.Equal(t, schedule.CodeID{}, pricer.query.NodeID)
+	assert.Equal(t, schedule.ID(1), pricer.query.Area)
+	assert.Equal(t, "USD", pricer.currency)
+	assert.JSONEq(t, `{"data": {
+		"from": "2023-07-01",
+		"days": [
+			{
+				"date": "2023-07-01",
+				"price": {"number": "80", "currency": "EUR"},
+				"lot_id": 20,
+				"lots": 3
+			},
+			{"date": "2023-07-02", "price": null, "lots": 0}
+		]
+	}}`, rec.Body.String())
+
+	t.Run("of a lot", func(t *testing.T) {
+		pricer := &fakePricer{}
+		engine := newPricingEngine(pricer)
+
+		req := httptest.NewRequest(
+			http.MethodGet,
+			"/api/v1/lots/20/price-calendar?region=FI&from=2023-07-01&to=2023-07-03",
+			nil,
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, schedule.LongID(20), pricer.query.LotID)
+		assert.Equal(t, schedule.CodeID{'F', 'I'}, pricer.query.Region)
+		assert.Equal(t, schedule.CodeID{}, pricer.query.NodeID)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := map[string]struct {
+			url  string
+			err  error
+			code int
+		}{
+			"without region": {
+				"/api/v1/price-calendar?from=2023-07-01&to=2023-07-03",
+				nil,
+				http.StatusBadRequest,
+			},
+			"too long range": {
+				"/api/v1/price-calendar?region=FI&from=2023-01-01&to=2024-07-03",
+				nil,
+				http.StatusBadRequest,
+			},
+			"out of horizon": {
+				"/api/v1/price-calendar?region=FI&from=2023-07-01&to=2023-07-03",
+				schedule.ErrOutOfHorizon,
+				http.StatusBadRequest,
+			},
+			"unknown currency": {
+				"/api/v1/price-calendar?region=FI&from=2023-07-01&to=2023-07-03",
+				pricing.ErrInvalidQuote,
+				http.StatusUnprocessableEntity,
+			},
+		}
+
+		for name, tc := range cases {
+			tc := tc
+
+			t.Run(name, func(t *testing.T) {
+				pricer := &fakePricer{}
+				if tc.err != nil {
+					pricer.err = fmt.Errorf("wrapped, %w", tc.err)
+				}
+
+				engine := newPricingEngine(pricer)
+
+				req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+				rec := httptest.NewRecorder()
+				engine.ServeHTTP(rec, req)
+
+				assert.Equal(t, tc.code, rec.Code)
+			})
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/promotion"
+	"github.com/gin-gonic/gin"
+)
+
+type promotionRequest struct {
+	Kind           promotion.Kind   `json:"kind"`
+	Percent        string           `json:"percent"`
+	Amount         *currency.Amount `json:"amount"`
+	StartsAt       time.Time        `json:"starts_at"`
+	EndsAt         time.Time        `json:"ends_at"`
+	Region         string           `json:"region"`
+	MinNights      uint16           `json:"min_nights"`
+	MaxRedemptions uint32           `json:"max_redemptions"`
+}
+
+func (h *handler) setPromotion(c *gin.Context) {
+	var req promotionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse body"})
+
+		return
+	}
+
+	promo := promotion.Promotion{
+		Code:           c.Param("code"),
+		Kind:           req.Kind,
+		Percent:        req.Percent,
+		Amount:         req.Amount,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		MinNights:      req.MinNights,
+		MaxRedemptions: req.MaxRedemptions,
+	}
+
+	if req.Region != "" {
+		region, err := parseCodeID(req.Region)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "region: " + err.Error()})
+
+			return
+		}
+
+		promo.Region = region
+	}
+
+	if !h.permit(
+		c,
+		domain.AccessDomainPromotion,
+		regionObject(promo.Region),
+		domain.AccessActionWrite,
+	) {
+		return
+	}
+
+	if err := h.promoter.SetPromotion(c.Request.Context(), promo); err != nil {
+		abortWithPromotionError(c, err, abortWithPricingError)
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// abortWithPromotionError responds to errors of promo codes, others
+// are passed to the fallback.
+func abortWithPromotionError(
+	c *gin.Context,
+	err error,
+	fallback func(*gin.Context, error),
+) {
+	body := gin.H{"error": err.Error()}
+
+	switch {
+	case errors.Is(err, promotion.ErrNotFound):
+		c.JSON(http.StatusNotFound, body)
+	case errors.Is(err, promotion.ErrExhausted):
+		c.JSON(http.StatusConflict, body)
+	case errors.Is(err, promotion.ErrInvalidPromotion),
+		errors.Is(err, promotion.ErrNotApplicable):
+		c.JSON(http.StatusUnprocessableEntity, body)
+	default:
+		fallback(c, err)
+	}
+}
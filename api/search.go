@@ -0,0 +1,290 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxLimit    = 100
+	maxFlexDays = 14
+	dateLayout  = "2006-01-02"
+)
+
+var ErrInvalidParam = errors.New("invalid parameter")
+
+var searchSorts = map[string]schedule.Sort{
+	"":         schedule.SortByLot,
+	"lot":      schedule.SortByLot,
+	"earliest": schedule.SortByEarliest,
+	"tightest": schedule.SortByTightest,
+}
+
+type timeSlotResponse struct {
+	NodeID    string `json:"node_id"`
+	HousingID uint64 `json:"housing_id"`
+	LotID     uint64 `json:"lot_id"`
+
+	StartAt time.Time `json:"start_at"`
+	EndAt   time.Time `json:"end_at"`
+
+	Region      string `json:"region"`
+	Area        uint16 `json:"area"`
+	Locality    uint16 `json:"locality"`
+	Sublocality uint16 `json:"sublocality"`
+}
+
+type alternativeResponse struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Shift int       `json:"shift"`
+	Lots  int       `json:"lots"`
+}
+
+func (h *handler) search(c *gin.Context) {
+	query, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	result, err := h.scheduler.Search(c.Request.Context(), query)
+	if errors.Is(err, schedule.ErrOutOfHorizon) ||
+		errors.Is(err, schedule.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+
+		return
+	}
+
+	if err != nil {
+		abortWithSchedulerError(c, err)
+
+		return
+	}
+
+	data := make([]timeSlotResponse, len(result.Slots))
+	for idx, slot := range result.Slots {
+		data[idx] = timeSlot2response(slot)
+	}
+
+	resp := gin.H{"data": data, "partial": result.Partial}
+
+	if result.NextCursor != "" {
+		resp["next_cursor"] = result.NextCursor
+	}
+
+	if len(result.Alternatives) > 0 {
+		alternatives := make([]alternativeResponse, len(result.Alternatives))
+		for idx, alt := range result.Alternatives {
+			alternatives[idx] = alternativeResponse{
+				From:  alt.From,
+				To:    alt.To,
+				Shift: alt.Shift,
+				Lots:  alt.Lots,
+			}
+		}
+
+		resp["alternatives"] = alternatives
+	}
+
+	if result.Partial {
+		nodes := make([]string, len(result.FailedNodes))
+		for idx, node := range result.FailedNodes {
+			nodes[idx] = string(node[:])
+		}
+
+		resp["failed_nodes"] = nodes
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func parseSearchQuery(c *gin.Context) (schedule.Query, error) {
+	var (
+		query schedule.Query
+		err   error
+	)
+
+	if query.Region, err = parseCodeID(c.Query("region")); err != nil {
+		return query, fmt.Errorf("region: %w", err)
+	}
+
+	// All nodes of the region are searched unless the node is set.
+	if node := c.Query("node"); node != "" {
+		if query.NodeID, err = parseCodeID(node); err != nil {
+			return query, fmt.Errorf("node: %w", err)
+		}
+	}
+
+	if query.Area, err = parseID(c.Query("area")); err != nil {
+		return query, fmt.Errorf("area: %w", err)
+	}
+
+	if query.Locality, err = parseID(c.Query("locality")); err != nil {
+		return query, fmt.Errorf("locality: %w", err)
+	}
+
+	if query.Sublocality, err = parseID(c.Query("sublocality")); err != nil {
+		return query, fmt.Errorf("sublocality: %w", err)
+	}
+
+	if query.From, query.To, err = parseRange(c); err != nil {
+		return query, err
+	}
+
+	if query.Limit, err = parseUint(c.Query("limit"), 64); err != nil {
+		return query, fmt.Errorf("limit: %w", err)
+	}
+
+	if query.Limit > maxLimit {
+		return query, fmt.Errorf(
+			"limit must not exceed %d, %w", maxLimit, ErrInvalidParam,
+		)
+	}
+
+	if query.Offset, err = parseUint(c.Query("offset"), 64); err != nil {
+		return query, fmt.Errorf("offset: %w", err)
+	}
+
+	// The cursor is opaque, it is validated by the scheduler.
+	query.Cursor = c.Query("cursor")
+
+	sort, ok := searchSorts[c.Query("sort")]
+	if !ok {
+		return query, fmt.Errorf(
+			"sort: must be lot, earliest or tightest, %w", ErrInvalidParam,
+		)
+	}
+
+	query.Sort = sort
+
+	flex, err := parseUint(c.Query("flex"), 8)
+	if err != nil {
+		return query, fmt.Errorf("flex: %w", err)
+	}
+
+	if flex > maxFlexDays {
+		return query, fmt.Errorf(
+			"flex must not exceed %d, %w", maxFlexDays, ErrInvalidParam,
+		)
+	}
+
+	query.FlexDays = int(flex)
+
+	// With nights the range is a window the stay may be anywhere in.
+	nights, err := parseUint(c.Query("nights"), 16)
+	if err != nil {
+		return query, fmt.Errorf("nights: %w", err)
+	}
+
+	query.Stay = time.Duration(nights) * 24 * time.Hour
+
+	return query, nil
+}
+
+// parseRegion returns the region and the node of the query. The node
+// is empty unless it is set, the scheduler finds it by the region then.
+func parseRegion(c *gin.Context) (schedule.CodeID, schedule.CodeID, error) {
+	var node schedule.CodeID
+
+	region, err := parseCodeID(c.Query("region"))
+	if err != nil {
+		return region, node, fmt.Errorf("region: %w", err)
+	}
+
+	if val := c.Query("node"); val != "" {
+		if node, err = parseCodeID(val); err != nil {
+			return region, node, fmt.Errorf("node: %w", err)
+		}
+	}
+
+	return region, node, nil
+}
+
+func parseRange(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseTime(c.Query("from"))
+	if err != nil {
+		return from, from, fmt.Errorf("from: %w", err)
+	}
+
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		return from, to, fmt.Errorf("to: %w", err)
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to, %w", ErrInvalidParam)
+	}
+
+	return from, to, nil
+}
+
+func parseCodeID(val string) (schedule.CodeID, error) {
+	code := schedule.CodeID{}
+	if len(val) != len(code) {
+		return code, fmt.Errorf("must be two characters, %w", ErrInvalidParam)
+	}
+
+	copy(code[:], val)
+
+	return code, nil
+}
+
+func parseID(val string) (schedule.ID, error) {
+	num, err := parseUint(val, 16)
+
+	return schedule.ID(num), err
+}
+
+func parseUint(val string, bitSize int) (uint64, error) {
+	if val == "" {
+		return 0, nil
+	}
+
+	num, err := strconv.ParseUint(val, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Errorf("must be a number, %w", ErrInvalidParam)
+	}
+
+	return num, nil
+}
+
+func parseTime(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, fmt.Errorf("is required, %w", ErrInvalidParam)
+	}
+
+	if point, err := time.Parse(time.RFC3339, val); err == nil {
+		return point, nil
+	}
+
+	point, err := time.Parse(dateLayout, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be a date, %w", ErrInvalidParam)
+	}
+
+	return point, nil
+}
+
+func timeSlot2response(slot schedule.TimeSlot) timeSlotResponse {
+	return timeSlotResponse{
+		NodeID:    string(slot.NodeID[:]),
+		HousingID: uint64(slot.HousingID),
+		LotID:     uint64(slot.LotID),
+
+		StartAt: slot.StartAt,
+		EndAt:   slot.EndAt,
+
+		Region:      string(slot.Region[:]),
+		Area:        uint16(slot.Area),
+		Locality:    uint16(slot.Locality),
+		Sublocality: uint16(slot.Sublocality),
+	}
+}
@@ -0,0 +1,474 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/api"
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScheduler struct {
+	query   schedule.Query
+	level   schedule.Level
+	slot    schedule.TimeSlot
+	slots   []schedule.TimeSlot
+	failed  []schedule.CodeID
+	cursor  string
+	alts    []schedule.Alternative
+	guest   domain.AccessSubject
+	code    string
+	booking schedule.LongID
+	ttl     time.Duration
+	token   string
+	reason  string
+	rules   schedule.AvailabilityRules
+	err     error
+}
+
+func (f *fakeScheduler) Search(
+	ctx context.Context,
+	query schedule.Query,
+) (schedule.SearchResult, error) {
+	f.query = query
+
+	result := schedule.SearchResult{
+		Slots:       f.slots,
+		Partial:     len(f.failed) > 0,
+		FailedNodes: f.failed,
+		NextCursor:  f.cursor,
+
+		Alternatives: f.alts,
+	}
+
+	return result, f.err
+}
+
+func (f *fakeScheduler) BookWithCode(
+	ctx context.Context,
+	slot schedule.TimeSlot,
+	guest domain.AccessSubject,
+	code string,
+) (schedule.Booking, error) {
+	f.slot = slot
+	f.guest = guest
+	f.code = code
+
+	booking := schedule.Booking{
+		ID:     1,
+		Status: schedule.BookingStatusConfirmed,
+		Guest:  guest,
+		Slot:   slot,
+	}
+
+	return booking, f.err
+}
+
+func (f *fakeScheduler) BookMany(
+	ctx context.Context,
+	slots []schedule.TimeSlot,
+	guest domain.AccessSubject,
+) ([]schedule.Booking, error) {
+	f.slots = slots
+	f.guest = guest
+
+	bookings := make([]schedule.Booking, len(slots))
+	for idx, slot := range slots {
+		bookings[idx] = schedule.Booking{
+			ID:     schedule.LongID(idx + 1),
+			Status: schedule.BookingStatusConfirmed,
+			Guest:  guest,
+			Slot:   slot,
+		}
+	}
+
+	return bookings, f.err
+}
+
+// FindBooking returns a booking of guestID in the lot 20.
+func (f *fakeScheduler) FindBooking(
+	ctx context.Context,
+	id schedule.LongID,
+) (schedule.Booking, error) {
+	booking := schedule.Booking{
+		ID:     id,
+		Status: schedule.BookingStatusConfirmed,
+		Guest:  guestID,
+		Slot:   schedule.TimeSlot{HousingID: 10, LotID: 20},
+	}
+
+	return booking, f.err
+}
+
+func (f *fakeScheduler) Cancel(ctx context.Context, id schedule.LongID) error {
+	f.booking = id
+
+	return f.err
+}
+
+func (f *fakeScheduler) Block(
+	ctx context.Context,
+	slot schedule.TimeSlot,
+	reason string,
+	author domain.AccessSubject,
+) (schedule.Block, error) {
+	f.slot = slot
+	f.reason = reason
+	f.guest = author
+
+	block := schedule.Block{
+		ID:     1,
+		Status: schedule.BlockStatusActive,
+		Author: author,
+		Reason: reason,
+		Slot:   slot,
+	}
+
+	return block, f.err
+}
+
+// FindBlock returns a block of guestID in the lot 20.
+func (f *fakeScheduler) FindBlock(
+	ctx context.Context,
+	id schedule.LongID,
+) (schedule.Block, error) {
+	block := schedule.Block{
+		ID:     id,
+		Status: schedule.BlockStatusActive,
+		Author: guestID,
+		Slot:   schedule.TimeSlot{HousingID: 10, LotID: 20},
+	}
+
+	return block, f.err
+}
+
+func (f *fakeScheduler) Unblock(ctx context.Context, id schedule.LongID) error {
+	f.booking = id
+
+	return f.err
+}
+
+func (f *fakeScheduler) Hold(
+	ctx context.Context,
+	slot schedule.TimeSlot,
+	ttl time.Duration,
+) (schedule.Hold, error) {
+	f.slot = slot
+	f.ttl = ttl
+
+	hold := schedule.Hold{
+		Token:     "token",
+		BookingID: 1,
+		Slot:      slot,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	return hold, f.err
+}
+
+func (f *fakeScheduler) Confirm(
+	ctx context.Context,
+	token string,
+	guest domain.AccessSubject,
+) (schedule.Booking, error) {
+	f.token = token
+	f.guest = guest
+
+	booking := schedule.Booking{
+		ID:     1,
+		Status: schedule.BookingStatusConfirmed,
+		Guest:  guest,
+	}
+
+	return booking, f.err
+}
+
+func (f *fakeScheduler) RegisterLot(
+	ctx context.Context,
+	slot schedule.TimeSlot,
+) error {
+	f.slot = slot
+
+	return f.err
+}
+
+func (f *fakeScheduler) Calendar(
+	ctx context.Context,
+	query schedule.Query,
+) (schedule.Calendar, error) {
+	f.query = query
+
+	calendar := schedule.Calendar{
+		LotID: query.LotID,
+		From:  query.From,
+		Days: []schedule.DayStatus{
+			schedule.DayStatusFree,
+			schedule.DayStatusPartial,
+			schedule.DayStatusBooked,
+		},
+	}
+
+	return calendar, f.err
+}
+
+func (f *fakeScheduler) Facets(
+	ctx context.Context,
+	query schedule.Query,
+	level schedule.Level,
+) ([]schedule.Facet, error) {
+	f.query = query
+	f.level = level
+
+	return []schedule.Facet{{ID: 1, Area: 1, Count: 23}}, f.err
+}
+
+func (f *fakeScheduler) SetAvailability(
+	ctx context.Context,
+	slot schedule.TimeSlot,
+	rules schedule.AvailabilityRules,
+) error {
+	f.slot = slot
+	f.rules = rules
+
+	return f.err
+}
+
+// guestID is the subject requests of the engine are authenticated as.
+const guestID = domain.AccessSubject(40)
+
+func newEngine(scheduler *fakeScheduler) *gin.Engine {
+	return newEngineAs(scheduler, guestID)
+}
+
+// newEngineAs makes an engine authenticating requests as the subject,
+// requests of the unknown user aren't authenticated.
+func newEngineAs(
+	scheduler *fakeScheduler,
+	subject domain.AccessSubject,
+) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(bearer(subject))
+	api.APIRouter(
+		engine,
+		api.WithScheduler(scheduler),
+		api.WithAuthenticator(tokens),
+		api.WithAccessController(fakeAccess{}),
+	)
+
+	return engine
+}
+
+func Test_Search(t *testing.T) {
+	scheduler := &fakeScheduler{
+		slots: []schedule.TimeSlot{
+			{
+				NodeID:      schedule.CodeID{'f', 'i'},
+				HousingID:   10,
+				LotID:       20,
+				StartAt:     time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+				EndAt:       time.Date(2029, time.June, 23, 15, 0, 0, 0, time.UTC),
+				Region:      schedule.CodeID{'f', 'i'},
+				Area:        1,
+				Locality:    2,
+				Sublocality: 3,
+			},
+		},
+	}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search?region=fi&area=1&locality=2&sublocality=3"+
+			"&from=2023-01-01&to=2023-01-03T12:00:00Z&limit=10&offset=20",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	expected := schedule.Query{
+		Region:      schedule.CodeID{'f', 'i'},
+		Area:        1,
+		Locality:    2,
+		Sublocality: 3,
+		From:        time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:          time.Date(2023, time.January, 3, 12, 0, 0, 0, time.UTC),
+		Limit:       10,
+		Offset:      20,
+	}
+	assert.Equal(t, expected, scheduler.query)
+
+	var body struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	err := json.Unmarshal(rec.Body.Bytes(), &body)
+	require.NoError(t, err)
+	require.Len(t, body.Data, 1)
+	assert.Equal(t, "fi", body.Data[0]["region"])
+	assert.Equal(t, float64(20), body.Data[0]["lot_id"])
+	assert.Equal(t, "fi", body.Data[0]["node_id"])
+	assert.Equal(t, "2022-01-01T00:00:00Z", body.Data[0]["start_at"])
+	assert.Equal(t, "2029-06-23T15:00:00Z", body.Data[0]["end_at"])
+}
+
+func Test_Search_partial(t *testing.T) {
+	scheduler := &fakeScheduler{
+		slots:  []schedule.TimeSlot{},
+		failed: []schedule.CodeID{{'r', '2'}},
+	}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search?region=ru&node=r1&from=2023-01-01&to=2023-01-03",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, schedule.CodeID{'r', '1'}, scheduler.query.NodeID)
+	assert.JSONEq(
+		t,
+		`{"data":[],"partial":true,"failed_nodes":["r2"]}`,
+		rec.Body.String(),
+	)
+}
+
+func Test_Search_cursor(t *testing.T) {
+	scheduler := &fakeScheduler{
+		slots:  []schedule.TimeSlot{},
+		cursor: "next",
+	}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search?region=fi&from=2023-01-01&to=2023-01-03&cursor=prev"+
+			"&sort=tightest",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "prev", scheduler.query.Cursor)
+	assert.Equal(t, schedule.SortByTightest, scheduler.query.Sort)
+	assert.JSONEq(
+		t,
+		`{"data":[],"partial":false,"next_cursor":"next"}`,
+		rec.Body.String(),
+	)
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		scheduler := &fakeScheduler{err: schedule.ErrInvalidCursor}
+		engine := newEngine(scheduler)
+
+		req := httptest.NewRequest(
+			http.MethodGet,
+			"/api/v1/search?region=fi&from=2023-01-01&to=2023-01-03&cursor=x",
+			nil,
+		)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func Test_Search_flexible(t *testing.T) {
+	scheduler := &fakeScheduler{
+		slots: []schedule.TimeSlot{},
+		alts: []schedule.Alternative{
+			{
+				From:  time.Date(2023, time.January, 4, 0, 0, 0, 0, time.UTC),
+				To:    time.Date(2023, time.January, 6, 0, 0, 0, 0, time.UTC),
+				Shift: 3,
+				Lots:  2,
+			},
+		},
+	}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search?region=fi&from=2023-01-01&to=2023-01-03&flex=3",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 3, scheduler.query.FlexDays)
+	assert.JSONEq(
+		t,
+		`{"data":[],"partial":false,"alternatives":[{
+			"from":"2023-01-04T00:00:00Z",
+			"to":"2023-01-06T00:00:00Z",
+			"shift":3,
+			"lots":2
+		}]}`,
+		rec.Body.String(),
+	)
+}
+
+func Test_Search_stay(t *testing.T) {
+	scheduler := &fakeScheduler{slots: []schedule.TimeSlot{}}
+	engine := newEngine(scheduler)
+
+	req := httptest.NewRequest(
+		http.MethodGet,
+		"/api/v1/search?region=fi&from=2023-07-01&to=2023-08-01&nights=3",
+		nil,
+	)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 72*time.Hour, scheduler.query.Stay)
+}
+
+func Test_Search_invalid_params(t *testing.T) {
+	engine := newEngine(&fakeScheduler{})
+
+	cases := map[string]string{
+		"without region":   "from=2023-01-01&to=2023-01-03",
+		"long region":      "region=fin&from=2023-01-01&to=2023-01-03",
+		"wrong area":       "region=fi&area=x&from=2023-01-01&to=2023-01-03",
+		"area overflow":    "region=fi&area=70000&from=2023-01-01&to=2023-01-03",
+		"without from":     "region=fi&to=2023-01-03",
+		"wrong to":         "region=fi&from=2023-01-01&to=tomorrow",
+		"from after to":    "region=fi&from=2023-01-03&to=2023-01-01",
+		"limit is too big": "region=fi&from=2023-01-01&to=2023-01-03&limit=1000",
+		"negative offset":  "region=fi&from=2023-01-01&to=2023-01-03&offset=-1",
+		"unknown sort":     "region=fi&from=2023-01-01&to=2023-01-03&sort=price",
+		"flex is too big":  "region=fi&from=2023-01-01&to=2023-01-03&flex=15",
+		"wrong nights":     "region=fi&from=2023-07-01&to=2023-08-01&nights=x",
+	}
+
+	for name, params := range cases {
+		params := params
+
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				http.MethodGet,
+				"/api/v1/search?"+params,
+				nil,
+			)
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
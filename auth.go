@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/findbed/app/rbac"
+	"github.com/imega/daemon"
+)
+
+// tokensWatcher loads the secret bearer tokens of the API are signed
+// with from APP_AUTH_SECRET, tokens are issued by the account service
+// sharing it.
+func tokensWatcher(tokens *rbac.Tokens) daemon.WatcherConfigFunc {
+	return func() daemon.WatcherConfig {
+		return daemon.WatcherConfig{
+			Prefix:  appName,
+			MainKey: "auth",
+			Keys:    []string{"secret"},
+			ApplyFunc: func(conf, reset map[string]string) {
+				if val, ok := conf[appName+"/auth/secret"]; ok {
+					tokens.SetSecret(val)
+				}
+			},
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/findbed/app/exchange"
+	exchangedb "github.com/findbed/app/exchange/mysqldb"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/migration"
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/imega/daemon/configuring/env"
+	"github.com/imega/daemon/logging"
+	"github.com/imega/daemon/mysql"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+type command func(ctx context.Context, db isql.DB, args []string) error
+
+// commands are run instead of the daemon if the first argument names one.
+// Changes of free intervals made by a command aren't told to running
+// daemons, their cached price calendars of the changed regions stay
+// stale for up to five minutes, until the calendars expire.
+var commands = map[string]command{
+	"widen-horizon":         widenHorizon,
+	"migrate":               migrate,
+	"refresh-availability":  refreshAvailability,
+	"check-integrity":       checkIntegrity,
+	"import-exchange-rates": importExchangeRates,
+}
+
+func runCommand(logger logging.Logger, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%s, %w", name, errUnknownCommand)
+	}
+
+	mysqlConn := mysql.New(appName, appName, logger)
+	defer mysqlConn.ShutdownFunc()
+
+	confReader := env.Once(
+		mysqlConn.WatcherConfigFuncs[0],
+		mysqlConn.WatcherConfigFuncs[1],
+	)
+	if err := confReader.Read(); err != nil {
+		return fmt.Errorf("failed to read config, %w", err)
+	}
+
+	return cmd(context.Background(), mysqlConn, args)
+}
+
+// widenHorizon rewrites timeslot tables of the given nodes
+// created with 16-bit hour offsets.
+func widenHorizon(ctx context.Context, db isql.DB, args []string) error {
+	scheduler := schedule.New(firstDay, mysqldb.New(db))
+
+	for _, node := range args {
+		nodeID := schedule.CodeID{}
+		copy(nodeID[:], node)
+
+		if err := scheduler.MigrateHorizon(ctx, nodeID); err != nil {
+			return fmt.Errorf("failed to migrate node %s, %w", node, err)
+		}
+	}
+
+	return nil
+}
+
+// migrate applies pending migrations of the shared tables and
+// of timeslot tables of the given nodes.
+func migrate(ctx context.Context, db isql.DB, args []string) error {
+	if err := migration.New(db).Up(ctx, args...); err != nil {
+		return fmt.Errorf("failed to migrate, %w", err)
+	}
+
+	return nil
+}
+
+// refreshAvailability materialises availability rules of lots of
+// the given nodes again, it is meant to be run daily.
+func refreshAvailability(ctx context.Context, db isql.DB, args []string) error {
+	scheduler := schedule.New(firstDay, mysqldb.New(db))
+
+	for _, node := range args {
+		nodeID := schedule.CodeID{}
+		copy(nodeID[:], node)
+
+		if _, err := scheduler.RefreshAvailability(ctx, nodeID); err != nil {
+			return fmt.Errorf("failed to refresh node %s, %w", node, err)
+		}
+	}
+
+	return nil
+}
+
+// checkIntegrity reports broken free intervals of the given nodes,
+// with --fix they are rewritten as merged ones.
+func checkIntegrity(ctx context.Context, db isql.DB, args []string) error {
+	flags := flag.NewFlagSet("check-integrity", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "rewrite free intervals of broken lots")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("failed to parse flags, %w", err)
+	}
+
+	scheduler := schedule.New(firstDay, mysqldb.New(db))
+
+	check := scheduler.CheckIntegrity
+	if *fix {
+		check = scheduler.RepairIntegrity
+	}
+
+	for _, node := range flags.Args() {
+		nodeID := schedule.CodeID{}
+		copy(nodeID[:], node)
+
+		report, err := check(ctx, nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to check node %s, %w", node, err)
+		}
+
+		for _, issue := range report.Issues {
+			ids := make([]string, len(issue.IDs))
+			for idx, id := range issue.IDs {
+				ids[idx] = fmt.Sprint(id)
+			}
+
+			fmt.Fprintf(
+				os.Stdout,
+				"%s lot=%d ids=%s %s %s - %s\n",
+				node,
+				issue.LotID,
+				strings.Join(ids, ","),
+				issue.Kind,
+				issue.StartAt.Format(time.RFC3339),
+				issue.EndAt.Format(time.RFC3339),
+			)
+		}
+
+		fmt.Fprintf(
+			os.Stdout,
+			"%s lots=%d issues=%d fixed=%d\n",
+			node,
+			report.Lots,
+			len(report.Issues),
+			report.Fixed,
+		)
+	}
+
+	return nil
+}
+
+// importExchangeRates replaces exchange rates by the JSON table
+// of the given file.
+func importExchangeRates(ctx context.Context, db isql.DB, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("file is required, %w", exchange.ErrInvalidRates)
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s, %w", args[0], err)
+	}
+	defer file.Close()
+
+	table, err := exchange.ReadTable(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s, %w", args[0], err)
+	}
+
+	if err := exchange.New(exchangedb.New(db)).Import(ctx, table); err != nil {
+		return fmt.Errorf("failed to import rates, %w", err)
+	}
+
+	return nil
+}
@@ -54,9 +54,10 @@ const (
 )
 
 var (
-	ErrUnknowUser  = errors.New("unknown user")
-	ErrUserExists  = errors.New("user exists")
-	ErrGroupExists = errors.New("group exists")
+	ErrUnknowUser   = errors.New("unknown user")
+	ErrUserExists   = errors.New("user exists")
+	ErrGroupExists  = errors.New("group exists")
+	ErrAccessDenied = errors.New("access denied")
 )
 
 type AccessSubject LongID
@@ -89,4 +90,6 @@ const (
 	AccessDomainDwelling
 	AccessDomainLot
 	AccessDomainUser
+	AccessDomainCharge
+	AccessDomainPromotion
 )
@@ -0,0 +1,230 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/exchange/mysqldb"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrInvalidRates    = errors.New("invalid exchange rates")
+)
+
+// Table is exchange rates, Rates are units of a currency for one
+// unit of Base.
+type Table struct {
+	Base  string            `json:"base"`
+	Rates map[string]string `json:"rates"`
+}
+
+func (table Table) validate() error {
+	if !currency.IsValid(table.Base) {
+		return fmt.Errorf("base %q, %w", table.Base, ErrInvalidRates)
+	}
+
+	for code, rate := range table.Rates {
+		amount, err := currency.NewAmount(rate, code)
+		if err != nil {
+			return fmt.Errorf("rate of %q, %s, %w", code, err, ErrInvalidRates)
+		}
+
+		if amount.IsNegative() || amount.IsZero() {
+			return fmt.Errorf("rate of %q must be positive, %w", code, ErrInvalidRates)
+		}
+	}
+
+	return nil
+}
+
+// ReadTable decodes a JSON table like {"base":"EUR","rates":{"RUB":"60.5"}}.
+func ReadTable(r io.Reader) (Table, error) {
+	var table Table
+	if err := json.NewDecoder(r).Decode(&table); err != nil {
+		return Table{}, fmt.Errorf("failed to decode rates, %s, %w", err, ErrInvalidRates)
+	}
+
+	if err := table.validate(); err != nil {
+		return Table{}, err
+	}
+
+	return table, nil
+}
+
+// Converter converts amounts between currencies by the last loaded
+// table of exchange rates.
+type Converter struct {
+	connector *mysqldb.Connector
+
+	mu    sync.RWMutex
+	table Table
+}
+
+func New(conn *mysqldb.Connector) *Converter {
+	return &Converter{connector: conn}
+}
+
+// Set replaces exchange rates in memory.
+func (unit *Converter) Set(table Table) error {
+	if err := table.validate(); err != nil {
+		return err
+	}
+
+	rates := make(map[string]string, len(table.Rates))
+	for code, rate := range table.Rates {
+		rates[code] = rate
+	}
+
+	unit.mu.Lock()
+	unit.table = Table{Base: table.Base, Rates: rates}
+	unit.mu.Unlock()
+
+	return nil
+}
+
+// Import stores exchange rates and puts them in use.
+func (unit *Converter) Import(ctx context.Context, table Table) error {
+	if err := table.validate(); err != nil {
+		return err
+	}
+
+	updatedAt := time.Now().Unix()
+	recs := make([]mysqldb.RateRecord, 0, len(table.Rates))
+
+	for code, rate := range table.Rates {
+		recs = append(recs, mysqldb.RateRecord{
+			Currency:  code,
+			Base:      table.Base,
+			Rate:      rate,
+			UpdatedAt: updatedAt,
+		})
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	txw.Error(mysqldb.SetRates(ctx, txw, recs))
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to import rates, %w", err)
+	}
+
+	return unit.Set(table)
+}
+
+// Load puts stored exchange rates in use.
+func (unit *Converter) Load(ctx context.Context) error {
+	recs, err := unit.connector.ListRates(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list rates, %w", err)
+	}
+
+	if len(recs) == 0 {
+		return nil
+	}
+
+	table := Table{
+		Base:  recs[0].Base,
+		Rates: make(map[string]string, len(recs)),
+	}
+
+	for _, rec := range recs {
+		if rec.Base != table.Base {
+			return fmt.Errorf("rates of %s and %s, %w", rec.Base, table.Base, ErrInvalidRates)
+		}
+
+		table.Rates[rec.Currency] = rec.Rate
+	}
+
+	return unit.Set(table)
+}
+
+// RunRefresher reloads stored exchange rates every interval until
+// the context is done.
+func (unit *Converter) RunRefresher(
+	ctx context.Context,
+	interval time.Duration,
+	onError func(error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := unit.Load(ctx); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Convert returns the amount in the currency, rounded to its digits.
+func (unit *Converter) Convert(
+	amount currency.Amount,
+	currencyCode string,
+) (currency.Amount, error) {
+	if amount.CurrencyCode() == currencyCode {
+		return amount, nil
+	}
+
+	unit.mu.RLock()
+	from, okFrom := unit.table.rate(amount.CurrencyCode())
+	to, okTo := unit.table.rate(currencyCode)
+	unit.mu.RUnlock()
+
+	if !okFrom {
+		return currency.Amount{}, fmt.Errorf("%s, %w", amount.CurrencyCode(), ErrUnknownCurrency)
+	}
+
+	if !okTo {
+		return currency.Amount{}, fmt.Errorf("%s, %w", currencyCode, ErrUnknownCurrency)
+	}
+
+	base, err := amount.Div(from)
+	if err != nil {
+		return currency.Amount{}, fmt.Errorf("failed to divide, %w", err)
+	}
+
+	result, err := base.Convert(currencyCode, to)
+	if err != nil {
+		return currency.Amount{}, fmt.Errorf("failed to convert, %w", err)
+	}
+
+	return result.Round(), nil
+}
+
+func (table Table) rate(code string) (string, bool) {
+	if code != "" && code == table.Base {
+		return "1", true
+	}
+
+	rate, ok := table.Rates[code]
+
+	return rate, ok
+}
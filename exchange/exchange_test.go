@@ -0,0 +1,125 @@
+package exchange_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/exchange"
+	"github.com/findbed/app/exchange/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConnector(t *testing.T) (*mysqldb.Connector, func() error) {
+	t.Helper()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	return mysqldb.New(curDB), close
+}
+
+func amount(t *testing.T, number, code string) currency.Amount {
+	t.Helper()
+
+	val, err := currency.NewAmount(number, code)
+	require.NoError(t, err)
+
+	return val
+}
+
+func Test_Convert(t *testing.T) {
+	conn, close := newConnector(t)
+	defer close()
+
+	ctx := context.Background()
+
+	table, err := exchange.ReadTable(strings.NewReader(
+		`{"base":"EUR","rates":{"RUB":"100","USD":"1.25"}}`,
+	))
+	require.NoError(t, err)
+
+	err = exchange.New(conn).Import(ctx, table)
+	require.NoError(t, err)
+
+	converter := exchange.New(conn)
+	err = converter.Load(ctx)
+	require.NoError(t, err)
+
+	t.Run("from a currency to the base", func(t *testing.T) {
+		actual, err := converter.Convert(amount(t, "1500", "RUB"), "EUR")
+		require.NoError(t, err)
+		assert.Equal(t, "15.00 EUR", actual.String())
+	})
+
+	t.Run("from the base to a currency", func(t *testing.T) {
+		actual, err := converter.Convert(amount(t, "10", "EUR"), "USD")
+		require.NoError(t, err)
+		assert.Equal(t, "12.50 USD", actual.String())
+	})
+
+	t.Run("across the base", func(t *testing.T) {
+		actual, err := converter.Convert(amount(t, "1000", "RUB"), "USD")
+		require.NoError(t, err)
+		assert.Equal(t, "12.50 USD", actual.String())
+	})
+
+	t.Run("same currency", func(t *testing.T) {
+		actual, err := converter.Convert(amount(t, "10.5", "JPY"), "JPY")
+		require.NoError(t, err)
+		assert.Equal(t, "10.5 JPY", actual.String())
+	})
+
+	t.Run("unknown currency", func(t *testing.T) {
+		_, err := converter.Convert(amount(t, "10", "EUR"), "GBP")
+		assert.ErrorIs(t, err, exchange.ErrUnknownCurrency)
+	})
+
+	t.Run("import replaces rates", func(t *testing.T) {
+		err := exchange.New(conn).Import(ctx, exchange.Table{
+			Base:  "USD",
+			Rates: map[string]string{"GBP": "0.8"},
+		})
+		require.NoError(t, err)
+
+		err = converter.Load(ctx)
+		require.NoError(t, err)
+
+		actual, err := converter.Convert(amount(t, "8", "GBP"), "USD")
+		require.NoError(t, err)
+		assert.Equal(t, "10.00 USD", actual.String())
+
+		_, err = converter.Convert(amount(t, "10", "EUR"), "USD")
+		assert.ErrorIs(t, err, exchange.ErrUnknownCurrency)
+	})
+}
+
+func Test_ReadTable(t *testing.T) {
+	for name, input := range map[string]string{
+		"malformed":     `{"base":`,
+		"unknown base":  `{"base":"XYZ","rates":{"USD":"1"}}`,
+		"unknown code":  `{"base":"EUR","rates":{"XYZ":"1"}}`,
+		"zero rate":     `{"base":"EUR","rates":{"USD":"0"}}`,
+		"negative rate": `{"base":"EUR","rates":{"USD":"-1.2"}}`,
+	} {
+		input := input
+
+		t.Run(name, func(t *testing.T) {
+			_, err := exchange.ReadTable(strings.NewReader(input))
+			assert.ErrorIs(t, err, exchange.ErrInvalidRates)
+		})
+	}
+}
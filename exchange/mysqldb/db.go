@@ -0,0 +1,125 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/txwrapper"
+)
+
+type Connector struct {
+	db isql.DB
+}
+
+func New(db isql.DB) *Connector {
+	return &Connector{db: db}
+}
+
+// RateRecord is Rate units of Currency for one unit of Base.
+type RateRecord struct {
+	Currency  string
+	Base      string
+	Rate      string
+	UpdatedAt int64
+}
+
+func (conn *Connector) Transaction(
+	ctx context.Context,
+) (*txwrapper.TxWrapper, error) {
+	wrapper := txwrapper.New(conn.db)
+	if err := wrapper.StartTx(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to start tx, %w", err)
+	}
+
+	return wrapper, nil
+}
+
+// SetRates replaces all exchange rates.
+func SetRates(ctx context.Context, stmt isql.ContextStatement, recs []RateRecord) error {
+	query, args, err := squirrel.Delete("exchange_rates").ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete records, %w", err)
+	}
+
+	query = `insert into exchange_rates(
+		currency,
+		base,
+		rate,
+		updated_at)values(?,?,?,?)`
+
+	for _, rec := range recs {
+		_, err := stmt.ExecContext(
+			ctx,
+			query,
+			rec.Currency,
+			rec.Base,
+			rec.Rate,
+			rec.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ListRates returns all exchange rates.
+func (conn *Connector) ListRates(ctx context.Context) ([]RateRecord, error) {
+	query, args, err := squirrel.Select(
+		"currency",
+		"base",
+		"rate",
+		"updated_at").
+		From("exchange_rates").
+		OrderBy("currency").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query, %w", err)
+	}
+	defer rows.Close()
+
+	var result []RateRecord
+
+	for rows.Next() {
+		var rec RateRecord
+
+		err := rows.Scan(&rec.Currency, &rec.Base, &rec.Rate, &rec.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows, %w", err)
+	}
+
+	return result, nil
+}
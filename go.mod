@@ -7,6 +7,8 @@ require (
 	github.com/Masterminds/squirrel v1.5.3
 	github.com/bojanz/currency v1.0.6
 	github.com/brianvoe/gofakeit/v6 v6.19.0
+	github.com/casbin/casbin/v2 v2.60.0
+	github.com/cockroachdb/apd/v3 v3.1.1
 	github.com/cenkalti/backoff/v4 v4.1.3
 	github.com/foolin/goview v0.3.0
 	github.com/gin-gonic/gin v1.8.1
@@ -23,8 +25,6 @@ require (
 
 require (
 	github.com/Knetic/govaluate v3.0.1-0.20171022003610-9aa49832a739+incompatible // indirect
-	github.com/casbin/casbin/v2 v2.60.0 // indirect
-	github.com/cockroachdb/apd/v3 v3.1.1 // indirect
 	github.com/daaku/go.zipexe v1.0.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gin-contrib/sse v0.1.0 // indirect
@@ -62,6 +62,12 @@ func (l10n *L10N) GetPrinter(lang string) *message.Printer {
 	return message.NewPrinter(lngTag)
 }
 
+// Label translates the key without formatting it, a % of the key is
+// printed as it is.
+func Label(prt *message.Printer, key string) string {
+	return prt.Sprintf(strings.ReplaceAll(key, "%", "%%"))
+}
+
 func New(lang string, r io.ReadCloser) (*message.Printer, error) {
 	lngTag, err := language.Parse(lang)
 	if err != nil {
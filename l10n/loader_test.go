@@ -42,3 +42,11 @@ func TestXxx(t *testing.T) {
 	// actual := printer.Sprintf("test")
 	printer.Printf("title")
 }
+
+func TestLabel(t *testing.T) {
+	printer := message.NewPrinter(language.English)
+
+	actual := Label(printer, "tax 5% of %s")
+
+	assert.Equal(t, "tax 5% of %s", actual)
+}
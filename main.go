@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/findbed/app/api"
+	"github.com/findbed/app/exchange"
+	exchangedb "github.com/findbed/app/exchange/mysqldb"
+	"github.com/findbed/app/migration"
+	"github.com/findbed/app/pricing"
+	pricingdb "github.com/findbed/app/pricing/mysqldb"
+	"github.com/findbed/app/promotion"
+	promotiondb "github.com/findbed/app/promotion/mysqldb"
+	"github.com/findbed/app/rbac"
+	"github.com/findbed/app/retrier"
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
 	"github.com/findbed/app/web"
 	"github.com/gin-gonic/gin"
 	"github.com/imega/daemon"
 	"github.com/imega/daemon/configuring/env"
 	httpserver "github.com/imega/daemon/http-server"
 	"github.com/imega/daemon/logging/wrapzerolog"
+	"github.com/imega/daemon/mysql"
 	"github.com/rs/zerolog"
 )
 
@@ -46,19 +59,86 @@ import (
 
 const (
 	shutdownTimeout = 15 * time.Second
+	sweepInterval   = time.Minute
+	ratesInterval   = time.Hour
+	refreshInterval = 24 * time.Hour
+	nodeTimeout     = 2 * time.Second
+	retryInterval   = time.Minute
 
 	appName = "app"
 )
 
+// firstDay is the point from which hours of timeslots are counted.
+var firstDay = time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func main() {
 	logger := wrapzerolog.New(zerolog.New(os.Stderr).With().Logger())
 
+	if len(os.Args) > 1 {
+		if err := runCommand(logger, os.Args[1], os.Args[2:]); err != nil {
+			logger.Errorf("failed to run a command, %s", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	gin.SetMode(gin.ReleaseMode)
 	engine := gin.New()
 	engine.GET("/healthcheck", func(c *gin.Context) { c.Status(204) })
 
-	web.WebRouter(engine)
-	api.APIRouter(engine)
+	mysqlConn := mysql.New(appName, appName, logger)
+	registry := schedule.NewRegistry()
+	converter := exchange.New(exchangedb.New(mysqlConn))
+	promoter := promotion.New(
+		promotiondb.New(mysqlConn),
+		promotion.WithConverter(converter),
+	)
+
+	// The pricer caches price calendars which changes of free intervals
+	// invalidate.
+	var pricer *pricing.Pricer
+
+	scheduler := schedule.New(
+		firstDay,
+		mysqldb.New(mysqlConn),
+		schedule.WithRegistry(registry),
+		schedule.WithNodeTimeout(nodeTimeout),
+		schedule.WithRedeemer(promoter),
+		schedule.WithOnChange(func(slot schedule.TimeSlot) {
+			pricer.InvalidateCalendar(slot)
+		}),
+	)
+
+	pricer = pricing.New(
+		pricingdb.New(mysqlConn),
+		pricing.WithConverter(converter),
+		pricing.WithAvailability(scheduler),
+	)
+
+	web.WebRouter(
+		engine,
+		web.WithConverter(converter),
+		web.WithPricer(pricer),
+	)
+	tokens := rbac.NewTokens("")
+	access := rbac.New(
+		rbac.WithDB(mysqlConn),
+		rbac.WithLogger(logger),
+		// Policies are loaded until the database is reachable.
+		rbac.WithRetrier(retrier.NewDefaultRetrier(retrier.Config{
+			BackoffMaxInterval: retryInterval,
+		})),
+	)
+
+	api.APIRouter(
+		engine,
+		api.WithScheduler(scheduler),
+		api.WithPricer(pricer),
+		api.WithPromoter(promoter),
+		api.WithAuthenticator(tokens),
+		api.WithAccessController(access),
+	)
 
 	httpSrv := httpserver.New(
 		appName,
@@ -67,7 +147,11 @@ func main() {
 	)
 
 	confReader := env.Once(
+		mysqlConn.WatcherConfigFuncs[0],
+		mysqlConn.WatcherConfigFuncs[1],
 		httpSrv.WatcherConfigFunc,
+		registryWatcher(registry, logger),
+		tokensWatcher(tokens),
 	)
 
 	app, err := daemon.New(logger, confReader)
@@ -76,6 +160,46 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Regions missing from the registry are stored on their own nodes,
+	// timeslot tables of those are migrated too.
+	codes, err := scheduler.Nodes(context.Background())
+	if err != nil {
+		logger.Errorf("failed to get nodes, %s", err)
+		os.Exit(1)
+	}
+
+	nodes := []string{}
+	for _, node := range codes {
+		nodes = append(nodes, string(node[:]))
+	}
+
+	err = migration.New(mysqlConn).Up(context.Background(), nodes...)
+	if err != nil {
+		logger.Errorf("failed to migrate, %s", err)
+		os.Exit(1)
+	}
+
+	if err := converter.Load(context.Background()); err != nil {
+		logger.Errorf("failed to load exchange rates, %s", err)
+	}
+
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	go scheduler.RunSweeper(sweeperCtx, sweepInterval, func(err error) {
+		logger.Errorf("failed to release expired holds, %s", err)
+	})
+	go converter.RunRefresher(sweeperCtx, ratesInterval, func(err error) {
+		logger.Errorf("failed to refresh exchange rates, %s", err)
+	})
+	go scheduler.RunRefresher(sweeperCtx, refreshInterval, func(err error) {
+		logger.Errorf("failed to refresh availability, %s", err)
+	})
+
+	app.RegisterHealthCheckFunc(mysqlConn.HealthCheckFunc)
+	app.RegisterShutdownFunc(
+		daemon.ShutdownFunc(stopSweeper),
+		mysqlConn.ShutdownFunc,
+	)
+
 	logger.Infof("%s is started", appName)
 
 	if err := app.Run(shutdownTimeout); err != nil {
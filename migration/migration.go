@@ -0,0 +1,262 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/txwrapper"
+	"github.com/go-sql-driver/mysql"
+)
+
+var ErrInvalidNode = errors.New("invalid node")
+
+// Codes of MySQL errors of the objects created twice.
+const (
+	errTableExists     = 1050
+	errDuplicateColumn = 1060
+	errDuplicateKey    = 1061
+)
+
+type Dialect uint8
+
+const (
+	MySQL Dialect = iota + 1
+	SQLite
+)
+
+// Migration upgrades a table or a set of tables to the version.
+type Migration struct {
+	Version uint32
+	Name    string
+
+	// Statements returns the DDL of the dialect for the table.
+	Statements func(dialect Dialect, table string) []string
+}
+
+// Scope is a versioned set of tables. The version of every scope is
+// kept separately, so a new node table is migrated from the start.
+type Scope struct {
+	Name       string
+	Table      string
+	Migrations []Migration
+}
+
+// Statements returns the DDL of all migrations of the scope.
+func (s Scope) Statements(dialect Dialect) []string {
+	result := []string{}
+	for _, migration := range s.Migrations {
+		result = append(result, migration.Statements(dialect, s.Table)...)
+	}
+
+	return result
+}
+
+// GlobalScope returns the tables shared by all nodes.
+func GlobalScope() Scope {
+	return Scope{Name: "global", Migrations: globalMigrations}
+}
+
+// TimeslotScope returns the timeslot table of the node.
+func TimeslotScope(node string) (Scope, error) {
+	if !validNode(node) {
+		return Scope{}, fmt.Errorf("%q, %w", node, ErrInvalidNode)
+	}
+
+	table := "timeslot_" + node
+
+	return Scope{Name: table, Table: table, Migrations: timeslotMigrations}, nil
+}
+
+type Migrator struct {
+	db      isql.DB
+	dialect Dialect
+}
+
+// New returns the migrator in the dialect of the driver of the db.
+func New(db isql.DB) *Migrator {
+	dialect := SQLite
+	if _, ok := db.Driver().(*mysql.MySQLDriver); ok {
+		dialect = MySQL
+	}
+
+	return &Migrator{db: db, dialect: dialect}
+}
+
+// Up applies pending migrations of the global scope and of the timeslot
+// tables of the nodes.
+func (m *Migrator) Up(ctx context.Context, nodes ...string) error {
+	scopes := []Scope{GlobalScope()}
+
+	for _, node := range nodes {
+		scope, err := TimeslotScope(node)
+		if err != nil {
+			return err
+		}
+
+		scopes = append(scopes, scope)
+	}
+
+	if err := m.createVersionTable(ctx); err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if err := m.apply(ctx, scope); err != nil {
+			return fmt.Errorf("failed to migrate %s, %w", scope.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Version returns the last applied version of the scope.
+func (m *Migrator) Version(ctx context.Context, scope string) (uint32, error) {
+	if err := m.createVersionTable(ctx); err != nil {
+		return 0, err
+	}
+
+	var version uint32
+
+	row := m.db.QueryRowContext(
+		ctx,
+		`select coalesce(max(version), 0) from schema_versions where scope = ?`,
+		scope,
+	)
+	if err := row.Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	return version, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, scope Scope) error {
+	current, err := m.Version(ctx, scope.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range scope.Migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		if err := m.applyOne(ctx, scope, migration); err != nil {
+			return fmt.Errorf(
+				"failed to apply %d %s, %w",
+				migration.Version,
+				migration.Name,
+				err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// applyOne runs the migration and records its version in one transaction.
+// MySQL commits DDL implicitly, so a statement of a migration interrupted
+// before its version is recorded may be already applied, see applied.
+func (m *Migrator) applyOne(
+	ctx context.Context,
+	scope Scope,
+	migration Migration,
+) error {
+	txw := txwrapper.New(m.db)
+	if err := txw.StartTx(ctx, nil); err != nil {
+		return fmt.Errorf("failed to start tx, %w", err)
+	}
+
+	for _, stmt := range migration.Statements(m.dialect, scope.Table) {
+		if _, err := txw.ExecContext(ctx, stmt); err != nil && !m.applied(err) {
+			txw.Error(fmt.Errorf("failed to execute query, %w", err))
+
+			break
+		}
+	}
+
+	_, err := txw.ExecContext(
+		ctx,
+		`insert into schema_versions(scope, version, name, applied_at)
+			values(?,?,?,?)`,
+		scope.Name,
+		migration.Version,
+		migration.Name,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		txw.Error(fmt.Errorf("failed to insert version, %w", err))
+	}
+
+	if err := txw.TransactionEnd(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// applied reports whether the statement failed because the object it
+// creates already exists. SQLite rolls DDL back with the transaction.
+func (m *Migrator) applied(err error) bool {
+	if m.dialect != MySQL {
+		return false
+	}
+
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return false
+	}
+
+	switch myErr.Number {
+	case errTableExists, errDuplicateColumn, errDuplicateKey:
+		return true
+	}
+
+	return false
+}
+
+func (m *Migrator) createVersionTable(ctx context.Context) error {
+	query := `create table if not exists schema_versions (
+		scope      varchar(64)  not null,
+		version    int unsigned not null,
+		name       varchar(255) not null,
+		applied_at bigint       not null,
+		primary key (scope, version)
+	)`
+
+	if _, err := m.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create version table, %w", err)
+	}
+
+	return nil
+}
+
+func validNode(node string) bool {
+	if len(node) != 2 {
+		return false
+	}
+
+	for _, r := range node {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,71 @@
+package migration_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/findbed/app/migration"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Up(t *testing.T) {
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	defer close()
+
+	ctx := context.Background()
+	migrator := migration.New(curDB)
+
+	err = migrator.Up(ctx, "fi")
+	require.NoError(t, err)
+
+	version, err := migrator.Version(ctx, "global")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(9), version)
+
+	version, err = migrator.Version(ctx, "timeslot_fi")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(3), version)
+
+	t.Run("applied migrations are skipped", func(t *testing.T) {
+		err := migrator.Up(ctx, "fi", "se")
+		require.NoError(t, err)
+
+		version, err := migrator.Version(ctx, "timeslot_se")
+		require.NoError(t, err)
+		assert.Equal(t, uint32(3), version)
+	})
+
+	t.Run("tables are created", func(t *testing.T) {
+		for _, table := range []string{
+			"timeslot_fi",
+			"timeslot_se",
+			"bookings",
+			"casbin_rules",
+			"blocks",
+			"availability_rules",
+			"rates",
+			"exchange_rates",
+			"charges",
+			"promotions",
+			"redemptions",
+		} {
+			_, err := curDB.ExecContext(ctx, "select count(*) from "+table)
+			assert.NoError(t, err, table)
+		}
+	})
+
+	t.Run("invalid node", func(t *testing.T) {
+		err := migrator.Up(ctx, "f;")
+		assert.ErrorIs(t, err, migration.ErrInvalidNode)
+	})
+}
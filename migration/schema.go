@@ -0,0 +1,454 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+// New migrations are appended to the end of the lists, applied
+// migrations are never changed.
+
+var globalMigrations = []Migration{
+	{Version: 1, Name: "create bookings", Statements: createBookings},
+	{Version: 2, Name: "create casbin_rules", Statements: createCasbinRules},
+	{Version: 3, Name: "create blocks", Statements: createBlocks},
+	{
+		Version:    4,
+		Name:       "create availability_rules",
+		Statements: createAvailabilityRules,
+	},
+	{Version: 5, Name: "create rates", Statements: createRates},
+	{
+		Version:    6,
+		Name:       "create exchange_rates",
+		Statements: createExchangeRates,
+	},
+	{Version: 7, Name: "create charges", Statements: createCharges},
+	{Version: 8, Name: "create promotions", Statements: createPromotions},
+	{
+		Version:    9,
+		Name:       "make casbin_rules values not null",
+		Statements: notNullCasbinRules,
+	},
+}
+
+var timeslotMigrations = []Migration{
+	{Version: 1, Name: "create timeslot", Statements: createTimeslot},
+	{Version: 2, Name: "add lot key", Statements: addTimeslotLotKey},
+	{Version: 3, Name: "add sort keys", Statements: addTimeslotSortKeys},
+}
+
+func createTimeslot(dialect Dialect, table string) []string {
+	if dialect == SQLite {
+		// Index names are global in SQLite.
+		return []string{
+			`CREATE TABLE IF NOT EXISTS ` + table + ` (
+				id          INTEGER    PRIMARY KEY AUTOINCREMENT,
+				region      VARCHAR(2)          NOT NULL,
+				area        INTEGER    UNSIGNED NOT NULL,
+				locality    INTEGER    UNSIGNED NOT NULL,
+				sublocality INTEGER    UNSIGNED NOT NULL,
+				housing_id  INTEGER    UNSIGNED NOT NULL,
+				lot_id      INTEGER    UNSIGNED NOT NULL,
+				start_at    INTEGER    UNSIGNED          DEFAULT 0,
+				end_at      INTEGER    UNSIGNED          DEFAULT 876000)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS slot_` + table + ` ON ` + table + `(
+				region, area, locality, sublocality, housing_id, lot_id, start_at
+			)`,
+			`CREATE INDEX IF NOT EXISTS free_slot_` + table + ` ON ` + table + `(
+				region, start_at, end_at
+			)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS ` + table + ` (
+			id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+			region char(2) NOT NULL,
+			area smallint(6) UNSIGNED NOT NULL,
+			locality smallint(6) UNSIGNED NOT NULL,
+			sublocality smallint(6) UNSIGNED NOT NULL,
+			housing_id bigint(20) UNSIGNED NOT NULL,
+			lot_id bigint(20) UNSIGNED NOT NULL,
+			start_at int(10) UNSIGNED DEFAULT 0,
+			end_at int(10) UNSIGNED DEFAULT 876000,
+			PRIMARY KEY (id),
+			UNIQUE KEY slot (region, area, locality, sublocality, housing_id, lot_id, start_at),
+			KEY free_slot (region, start_at, end_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+// addTimeslotLotKey adds the key search pages are read by.
+func addTimeslotLotKey(dialect Dialect, table string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE INDEX IF NOT EXISTS lot_` + table + ` ON ` + table + `(
+				region, lot_id, id
+			)`,
+		}
+	}
+
+	return []string{
+		`ALTER TABLE ` + table + ` ADD KEY lot (region, lot_id, id)`,
+	}
+}
+
+// addTimeslotSortKeys adds the length of free intervals and the keys
+// search pages are sorted by.
+func addTimeslotSortKeys(dialect Dialect, table string) []string {
+	if dialect == SQLite {
+		return []string{
+			`ALTER TABLE ` + table + ` ADD COLUMN duration INTEGER
+				GENERATED ALWAYS AS (end_at - start_at) VIRTUAL`,
+			`CREATE INDEX IF NOT EXISTS start_` + table + ` ON ` + table + `(
+				region, start_at, lot_id, id
+			)`,
+			`CREATE INDEX IF NOT EXISTS duration_` + table + ` ON ` + table + `(
+				region, duration, lot_id, id
+			)`,
+		}
+	}
+
+	return []string{
+		`ALTER TABLE ` + table + `
+			ADD COLUMN duration int(11)
+				AS (CAST(end_at AS SIGNED) - CAST(start_at AS SIGNED)) STORED,
+			ADD KEY start (region, start_at, lot_id, id),
+			ADD KEY duration (region, duration, lot_id, id)`,
+	}
+}
+
+func createBookings(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS bookings (
+				id          INTEGER    PRIMARY KEY AUTOINCREMENT,
+				node        VARCHAR(2)          NOT NULL,
+				region      VARCHAR(2)          NOT NULL,
+				area        INTEGER    UNSIGNED NOT NULL,
+				locality    INTEGER    UNSIGNED NOT NULL,
+				sublocality INTEGER    UNSIGNED NOT NULL,
+				housing_id  INTEGER    UNSIGNED NOT NULL,
+				lot_id      INTEGER    UNSIGNED NOT NULL,
+				start_at    INTEGER    UNSIGNED NOT NULL,
+				end_at      INTEGER    UNSIGNED NOT NULL,
+				guest       INTEGER    UNSIGNED NOT NULL,
+				status      INTEGER    UNSIGNED NOT NULL,
+				token       VARCHAR(32)         NOT NULL DEFAULT '',
+				expires_at  INTEGER    UNSIGNED NOT NULL DEFAULT 0,
+				created_at  INTEGER    UNSIGNED NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL)`,
+			`CREATE INDEX IF NOT EXISTS booking_lot ON bookings(node, lot_id, start_at)`,
+			`CREATE INDEX IF NOT EXISTS booking_token ON bookings(token)`,
+			`CREATE INDEX IF NOT EXISTS booking_expiry ON bookings(status, expires_at)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS bookings (
+			id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+			node char(2) NOT NULL,
+			region char(2) NOT NULL,
+			area smallint(6) UNSIGNED NOT NULL,
+			locality smallint(6) UNSIGNED NOT NULL,
+			sublocality smallint(6) UNSIGNED NOT NULL,
+			housing_id bigint(20) UNSIGNED NOT NULL,
+			lot_id bigint(20) UNSIGNED NOT NULL,
+			start_at int(10) UNSIGNED NOT NULL,
+			end_at int(10) UNSIGNED NOT NULL,
+			guest bigint(20) UNSIGNED NOT NULL,
+			status tinyint(3) UNSIGNED NOT NULL,
+			token varchar(32) NOT NULL DEFAULT '',
+			expires_at bigint(20) UNSIGNED NOT NULL DEFAULT 0,
+			created_at bigint(20) UNSIGNED NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (id),
+			KEY booking_lot (node, lot_id, start_at),
+			KEY booking_token (token),
+			KEY booking_expiry (status, expires_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createCasbinRules(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS casbin_rules (
+				id      INTEGER          PRIMARY KEY AUTOINCREMENT,
+				ptype   INTEGER UNSIGNED,
+				v0      INTEGER UNSIGNED,
+				v1      INTEGER UNSIGNED,
+				v2      INTEGER UNSIGNED,
+				v3      INTEGER UNSIGNED,
+				deleted INTEGER UNSIGNED DEFAULT 0)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS rule ON casbin_rules (
+				ptype, v0, v1, v2, v3
+			)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS casbin_rules (
+			id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+			ptype tinyint(3) UNSIGNED NOT NULL,
+			v0 bigint(20) UNSIGNED NOT NULL,
+			v1 bigint(20) UNSIGNED NOT NULL,
+			v2 bigint(20) UNSIGNED DEFAULT NULL,
+			v3 bigint(20) UNSIGNED DEFAULT NULL,
+			deleted tinyint(1) UNSIGNED NOT NULL DEFAULT 0,
+			PRIMARY KEY (id),
+			UNIQUE KEY rule (ptype, v0, v1, v2, v3)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+// notNullCasbinRules replaces NULL values of the rules with zero, NULLs
+// never collide in the unique key, so a rule could be added twice. The
+// duplicates are merged, an active rule is kept over a removed one.
+func notNullCasbinRules(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE casbin_rules_new (
+				id      INTEGER          PRIMARY KEY AUTOINCREMENT,
+				ptype   INTEGER UNSIGNED,
+				v0      INTEGER UNSIGNED,
+				v1      INTEGER UNSIGNED,
+				v2      INTEGER UNSIGNED NOT NULL DEFAULT 0,
+				v3      INTEGER UNSIGNED NOT NULL DEFAULT 0,
+				deleted INTEGER UNSIGNED DEFAULT 0)`,
+			`INSERT INTO casbin_rules_new(id, ptype, v0, v1, v2, v3, deleted)
+				SELECT min(id), ptype, v0, v1,
+					coalesce(v2, 0), coalesce(v3, 0), min(deleted)
+				FROM casbin_rules
+				GROUP BY ptype, v0, v1, coalesce(v2, 0), coalesce(v3, 0)`,
+			`DROP TABLE casbin_rules`,
+			`ALTER TABLE casbin_rules_new RENAME TO casbin_rules`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS rule ON casbin_rules (
+				ptype, v0, v1, v2, v3
+			)`,
+		}
+	}
+
+	return []string{
+		`DELETE r FROM casbin_rules r
+			JOIN casbin_rules d
+				ON d.ptype = r.ptype AND d.v0 = r.v0 AND d.v1 = r.v1
+				AND coalesce(d.v2, 0) = coalesce(r.v2, 0)
+				AND coalesce(d.v3, 0) = coalesce(r.v3, 0)
+				AND (d.deleted < r.deleted OR d.deleted = r.deleted AND d.id < r.id)`,
+		`UPDATE casbin_rules SET v2 = coalesce(v2, 0), v3 = coalesce(v3, 0)
+			WHERE v2 IS NULL OR v3 IS NULL`,
+		`ALTER TABLE casbin_rules
+			MODIFY v2 bigint(20) UNSIGNED NOT NULL DEFAULT 0,
+			MODIFY v3 bigint(20) UNSIGNED NOT NULL DEFAULT 0`,
+	}
+}
+
+func createBlocks(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS blocks (
+				id          INTEGER    PRIMARY KEY AUTOINCREMENT,
+				node        VARCHAR(2)          NOT NULL,
+				region      VARCHAR(2)          NOT NULL,
+				area        INTEGER    UNSIGNED NOT NULL,
+				locality    INTEGER    UNSIGNED NOT NULL,
+				sublocality INTEGER    UNSIGNED NOT NULL,
+				housing_id  INTEGER    UNSIGNED NOT NULL,
+				lot_id      INTEGER    UNSIGNED NOT NULL,
+				start_at    INTEGER    UNSIGNED NOT NULL,
+				end_at      INTEGER    UNSIGNED NOT NULL,
+				author      INTEGER    UNSIGNED NOT NULL,
+				reason      VARCHAR(255)        NOT NULL DEFAULT '',
+				status      INTEGER    UNSIGNED NOT NULL,
+				created_at  INTEGER    UNSIGNED NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL)`,
+			`CREATE INDEX IF NOT EXISTS block_lot ON blocks(node, lot_id, start_at)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS blocks (
+			id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+			node char(2) NOT NULL,
+			region char(2) NOT NULL,
+			area smallint(6) UNSIGNED NOT NULL,
+			locality smallint(6) UNSIGNED NOT NULL,
+			sublocality smallint(6) UNSIGNED NOT NULL,
+			housing_id bigint(20) UNSIGNED NOT NULL,
+			lot_id bigint(20) UNSIGNED NOT NULL,
+			start_at int(10) UNSIGNED NOT NULL,
+			end_at int(10) UNSIGNED NOT NULL,
+			author bigint(20) UNSIGNED NOT NULL,
+			reason varchar(255) NOT NULL DEFAULT '',
+			status tinyint(3) UNSIGNED NOT NULL,
+			created_at bigint(20) UNSIGNED NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (id),
+			KEY block_lot (node, lot_id, start_at)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createAvailabilityRules(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS availability_rules (
+				id          INTEGER    PRIMARY KEY AUTOINCREMENT,
+				node        VARCHAR(2)          NOT NULL,
+				region      VARCHAR(2)          NOT NULL,
+				area        INTEGER    UNSIGNED NOT NULL,
+				locality    INTEGER    UNSIGNED NOT NULL,
+				sublocality INTEGER    UNSIGNED NOT NULL,
+				housing_id  INTEGER    UNSIGNED NOT NULL,
+				lot_id      INTEGER    UNSIGNED NOT NULL,
+				rules       TEXT                NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS availability_lot
+				ON availability_rules(node, lot_id)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS availability_rules (
+			id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+			node char(2) NOT NULL,
+			region char(2) NOT NULL,
+			area smallint(6) UNSIGNED NOT NULL,
+			locality smallint(6) UNSIGNED NOT NULL,
+			sublocality smallint(6) UNSIGNED NOT NULL,
+			housing_id bigint(20) UNSIGNED NOT NULL,
+			lot_id bigint(20) UNSIGNED NOT NULL,
+			rules text NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (id),
+			UNIQUE KEY availability_lot (node, lot_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createRates(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS rates (
+				lot_id      INTEGER    UNSIGNED PRIMARY KEY,
+				currency    VARCHAR(3)          NOT NULL,
+				rates       TEXT                NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS rates (
+			lot_id bigint(20) UNSIGNED NOT NULL,
+			currency char(3) NOT NULL,
+			rates text NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (lot_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createExchangeRates(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS exchange_rates (
+				currency    VARCHAR(3)          PRIMARY KEY,
+				base        VARCHAR(3)          NOT NULL,
+				rate        VARCHAR(32)         NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL)`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS exchange_rates (
+			currency char(3) NOT NULL,
+			base char(3) NOT NULL,
+			rate varchar(32) NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (currency)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createCharges(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS charges (
+				region      VARCHAR(2)          NOT NULL,
+				area        INTEGER    UNSIGNED NOT NULL,
+				locality    INTEGER    UNSIGNED NOT NULL,
+				rules       TEXT                NOT NULL,
+				updated_at  INTEGER    UNSIGNED NOT NULL,
+				PRIMARY KEY (region, area, locality))`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS charges (
+			region char(2) NOT NULL,
+			area smallint(6) UNSIGNED NOT NULL,
+			locality smallint(6) UNSIGNED NOT NULL,
+			rules text NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (region, area, locality)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
+
+func createPromotions(dialect Dialect, _ string) []string {
+	if dialect == SQLite {
+		return []string{
+			`CREATE TABLE IF NOT EXISTS promotions (
+				code             VARCHAR(32)         PRIMARY KEY,
+				kind             VARCHAR(16)         NOT NULL,
+				value            VARCHAR(32)         NOT NULL,
+				currency         VARCHAR(3)          NOT NULL,
+				region           VARCHAR(2)          NOT NULL,
+				min_nights       INTEGER    UNSIGNED NOT NULL,
+				starts_at        INTEGER    UNSIGNED NOT NULL,
+				ends_at          INTEGER    UNSIGNED NOT NULL,
+				max_redemptions  INTEGER    UNSIGNED NOT NULL,
+				redemptions      INTEGER    UNSIGNED NOT NULL,
+				updated_at       INTEGER    UNSIGNED NOT NULL)`,
+			`CREATE TABLE IF NOT EXISTS redemptions (
+				code        VARCHAR(32)         NOT NULL,
+				booking_id  INTEGER    UNSIGNED NOT NULL,
+				created_at  INTEGER    UNSIGNED NOT NULL,
+				PRIMARY KEY (code, booking_id))`,
+		}
+	}
+
+	return []string{
+		`CREATE TABLE IF NOT EXISTS promotions (
+			code varchar(32) NOT NULL,
+			kind varchar(16) NOT NULL,
+			value varchar(32) NOT NULL,
+			currency char(3) NOT NULL,
+			region char(2) NOT NULL,
+			min_nights smallint(6) UNSIGNED NOT NULL,
+			starts_at bigint(20) UNSIGNED NOT NULL,
+			ends_at bigint(20) UNSIGNED NOT NULL,
+			max_redemptions int(11) UNSIGNED NOT NULL,
+			redemptions int(11) UNSIGNED NOT NULL,
+			updated_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (code)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+		`CREATE TABLE IF NOT EXISTS redemptions (
+			code varchar(32) NOT NULL,
+			booking_id bigint(20) UNSIGNED NOT NULL,
+			created_at bigint(20) UNSIGNED NOT NULL,
+			PRIMARY KEY (code, booking_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci`,
+	}
+}
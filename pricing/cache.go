@@ -0,0 +1,130 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/findbed/app/schedule"
+)
+
+// maxCacheEntries bounds the number of cached calendars, the cache
+// is emptied when it is full of fresh ones.
+const maxCacheEntries = 10_000
+
+type cacheEntry struct {
+	region    schedule.CodeID
+	calendar  PriceCalendar
+	expiresAt time.Time
+}
+
+// calendarCache keeps price calendars for ttl unless they are
+// invalidated earlier.
+type calendarCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+
+	// Generations are bumped by invalidations of every region and of
+	// the region, a calendar computed meanwhile is not put.
+	generation  uint64
+	generations map[schedule.CodeID]uint64
+}
+
+func newCalendarCache(ttl time.Duration) *calendarCache {
+	return &calendarCache{
+		ttl:         ttl,
+		entries:     map[string]cacheEntry{},
+		generations: map[schedule.CodeID]uint64{},
+	}
+}
+
+// version returns the generation of calendars of the region, it is read
+// before a calendar is computed and passed to put.
+func (cache *calendarCache) version(region schedule.CodeID) uint64 {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.generation + cache.generations[region]
+}
+
+func (cache *calendarCache) get(key string, now time.Time) (PriceCalendar, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		return PriceCalendar{}, false
+	}
+
+	return entry.calendar, true
+}
+
+func (cache *calendarCache) put(
+	key string,
+	region schedule.CodeID,
+	version uint64,
+	calendar PriceCalendar,
+	now time.Time,
+) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// The calendar may be computed of free nights read before the
+	// region was invalidated.
+	if cache.generation+cache.generations[region] != version {
+		return
+	}
+
+	if len(cache.entries) >= maxCacheEntries {
+		for key, entry := range cache.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(cache.entries, key)
+			}
+		}
+	}
+
+	if len(cache.entries) >= maxCacheEntries {
+		cache.entries = map[string]cacheEntry{}
+	}
+
+	cache.entries[key] = cacheEntry{
+		region:    region,
+		calendar:  calendar,
+		expiresAt: now.Add(cache.ttl),
+	}
+}
+
+// invalidate drops calendars of the region, of every region if it is zero.
+func (cache *calendarCache) invalidate(region schedule.CodeID) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if region == (schedule.CodeID{}) {
+		cache.generation++
+		cache.entries = map[string]cacheEntry{}
+
+		return
+	}
+
+	cache.generations[region]++
+
+	for key, entry := range cache.entries {
+		if entry.region == region {
+			delete(cache.entries, key)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/schedule"
+)
+
+// calendarTTL is how long a price calendar is cached unless free
+// intervals in its region or rates change earlier. Changes made by
+// other processes, e.g. commands, are seen once calendars expire.
+const calendarTTL = 5 * time.Minute
+
+// Availability tells the nights lots are free.
+type Availability interface {
+	FreeNights(context.Context, schedule.Query) (schedule.FreeNights, error)
+}
+
+// WithAvailability lets price calendars be made of free nights of lots.
+func WithAvailability(availability Availability) Option {
+	return func(p *Pricer) {
+		p.availability = availability
+	}
+}
+
+// DayPrice is the lowest price of the night of the day among Lots free
+// lots, LotID is the lot of the price. Price is nil if no lot is free.
+type DayPrice struct {
+	Date  time.Time
+	Price *currency.Amount
+	LotID schedule.LongID
+	Lots  int
+}
+
+type PriceCalendar struct {
+	From time.Time
+	Days []DayPrice
+}
+
+// PriceCalendar returns the lowest price of a night of every day of
+// the range [query.From, query.To) among free lots matching the query.
+// Prices are for one guest in the currency of the code, lots in other
+// currencies are converted. Without the code all lots must be priced
+// in the same currency.
+func (unit *Pricer) PriceCalendar(
+	ctx context.Context,
+	query schedule.Query,
+	currencyCode string,
+) (PriceCalendar, error) {
+	if !currency.IsValid(currencyCode) {
+		return PriceCalendar{}, fmt.Errorf(
+			"currency %q, %w", currencyCode, ErrInvalidQuote,
+		)
+	}
+
+	if unit.availability == nil {
+		return PriceCalendar{}, fmt.Errorf("availability of lots is unknown")
+	}
+
+	key := calendarKey(query, currencyCode)
+	now := time.Now()
+
+	if calendar, ok := unit.cache.get(key, now); ok {
+		return calendar, nil
+	}
+
+	version := unit.cache.version(query.Region)
+
+	nights, err := unit.availability.FreeNights(ctx, query)
+	if err != nil {
+		return PriceCalendar{}, fmt.Errorf("failed to get free nights, %w", err)
+	}
+
+	calendar, err := unit.priceNights(ctx, nights, currencyCode)
+	if err != nil {
+		return PriceCalendar{}, err
+	}
+
+	unit.cache.put(key, query.Region, version, calendar, now)
+
+	return calendar, nil
+}
+
+// InvalidateCalendar drops cached price calendars of the region of
+// the slot, it is called when free intervals of the slot change.
+func (unit *Pricer) InvalidateCalendar(slot schedule.TimeSlot) {
+	unit.cache.invalidate(slot.Region)
+}
+
+func (unit *Pricer) priceNights(
+	ctx context.Context,
+	nights schedule.FreeNights,
+	currencyCode string,
+) (PriceCalendar, error) {
+	calendar := PriceCalendar{
+		From: nights.From,
+		Days: make([]DayPrice, nights.Days),
+	}
+
+	for day := range calendar.Days {
+		calendar.Days[day].Date = nights.From.AddDate(0, 0, day)
+	}
+
+	if len(nights.Lots) == 0 {
+		return calendar, nil
+	}
+
+	lotIDs := make([]uint64, 0, len(nights.Lots))
+	for lotID := range nights.Lots {
+		lotIDs = append(lotIDs, uint64(lotID))
+	}
+
+	recs, err := unit.connector.ListRates(ctx, lotIDs)
+	if err != nil {
+		return PriceCalendar{}, fmt.Errorf("failed to list rates, %w", err)
+	}
+
+	requested := currencyCode
+
+	for _, rec := range recs {
+		if currencyCode == "" {
+			currencyCode = rec.Currency
+		}
+
+		if rec.Currency != currencyCode && requested == "" {
+			return PriceCalendar{}, fmt.Errorf(
+				"lots are priced in %s and %s, currency is required, %w",
+				currencyCode,
+				rec.Currency,
+				ErrInvalidQuote,
+			)
+		}
+
+		if rec.Currency != currencyCode && unit.converter == nil {
+			return PriceCalendar{}, fmt.Errorf(
+				"%s can't be converted to %s, %w",
+				rec.Currency,
+				currencyCode,
+				ErrInvalidQuote,
+			)
+		}
+
+		var rates Rates
+		if err := json.Unmarshal([]byte(rec.Rates), &rates); err != nil {
+			return PriceCalendar{}, fmt.Errorf("failed to unmarshal rates, %w", err)
+		}
+
+		lotID := schedule.LongID(rec.LotID)
+
+		for day, free := range nights.Lots[lotID] {
+			if !free {
+				continue
+			}
+
+			price, err := unit.nightPrice(rates, calendar.Days[day].Date, currencyCode)
+			if err != nil {
+				return PriceCalendar{}, fmt.Errorf("failed to price lot %d, %w", lotID, err)
+			}
+
+			if err := calendar.Days[day].offer(lotID, price); err != nil {
+				return PriceCalendar{}, err
+			}
+		}
+	}
+
+	return calendar, nil
+}
+
+// nightPrice is the price of the night of the day for one guest.
+func (unit *Pricer) nightPrice(
+	rates Rates,
+	day time.Time,
+	currencyCode string,
+) (currency.Amount, error) {
+	night, err := rates.night(day, 1)
+	if err != nil {
+		return currency.Amount{}, err
+	}
+
+	if night.Total.CurrencyCode() == currencyCode {
+		return night.Total, nil
+	}
+
+	price, err := unit.converter.Convert(night.Total, currencyCode)
+	if err != nil {
+		return currency.Amount{}, fmt.Errorf("%s, %w", err, ErrInvalidQuote)
+	}
+
+	return price, nil
+}
+
+// offer counts the lot free for the night and keeps its price if it
+// is the lowest one.
+func (day *DayPrice) offer(lotID schedule.LongID, price currency.Amount) error {
+	day.Lots++
+
+	if day.Price != nil {
+		cmp, err := price.Cmp(*day.Price)
+		if err != nil {
+			return fmt.Errorf("failed to compare prices, %w", err)
+		}
+
+		if cmp > 0 || cmp == 0 && lotID > day.LotID {
+			return nil
+		}
+	}
+
+	day.Price = &price
+	day.LotID = lotID
+
+	return nil
+}
+
+func calendarKey(query schedule.Query, currencyCode string) string {
+	return fmt.Sprintf(
+		"%s/%s/%d/%d/%d/%d/%s/%s/%s",
+		query.NodeID[:],
+		query.Region[:],
+		query.Area,
+		query.Locality,
+		query.Sublocality,
+		query.LotID,
+		query.From.Format(time.RFC3339),
+		query.To.Format(time.RFC3339),
+		currencyCode,
+	)
+}
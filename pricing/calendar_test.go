@@ -0,0 +1,240 @@
+package pricing_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/pricing/mysqldb"
+	"github.com/findbed/app/schedule"
+	scheduledb "github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PriceCalendar(t *testing.T) {
+	node := schedule.CodeID{'F', 'I'}
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(node[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	defer close()
+
+	ctx := context.Background()
+	firstDay := time.Date(2023, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	var pricer *pricing.Pricer
+
+	scheduler := schedule.New(
+		firstDay,
+		scheduledb.New(curDB),
+		schedule.WithOnChange(func(slot schedule.TimeSlot) {
+			pricer.InvalidateCalendar(slot)
+		}),
+	)
+
+	pricer = pricing.New(
+		mysqldb.New(curDB),
+		pricing.WithAvailability(scheduler),
+	)
+
+	cheap := schedule.TimeSlot{
+		NodeID:    node,
+		HousingID: 1,
+		LotID:     10,
+		Region:    node,
+		Area:      1,
+	}
+	dear := cheap
+	dear.LotID = 11
+
+	for lotID, nightly := range map[schedule.LongID]string{10: "100", 11: "120"} {
+		err := pricer.SetRates(ctx, lotID, pricing.Rates{
+			Nightly: amount(t, nightly, "EUR"),
+		})
+		require.NoError(t, err)
+	}
+
+	for _, slot := range []schedule.TimeSlot{cheap, dear} {
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+	}
+
+	day := func(num int) time.Time {
+		return time.Date(2023, time.July, num, 0, 0, 0, 0, time.UTC)
+	}
+
+	// The cheap lot is booked the nights of the 2nd and the 3rd.
+	booked := cheap
+	booked.StartAt = day(2).Add(14 * time.Hour)
+	booked.EndAt = day(4).Add(11 * time.Hour)
+
+	booking, err := scheduler.Book(ctx, booked, domain.AccessSubject(1))
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID: node,
+		Region: node,
+		From:   day(1),
+		To:     day(5),
+	}
+
+	prices := func(calendar pricing.PriceCalendar) []string {
+		result := make([]string, len(calendar.Days))
+
+		for idx, day := range calendar.Days {
+			if day.Price != nil {
+				result[idx] = day.Price.String()
+			}
+		}
+
+		return result
+	}
+
+	t.Run("lowest price of free lots", func(t *testing.T) {
+		calendar, err := pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, day(1), calendar.From)
+		assert.Equal(
+			t,
+			[]string{"100 EUR", "120 EUR", "120 EUR", "100 EUR"},
+			prices(calendar),
+		)
+		assert.Equal(t, schedule.LongID(10), calendar.Days[0].LotID)
+		assert.Equal(t, 2, calendar.Days[0].Lots)
+		assert.Equal(t, schedule.LongID(11), calendar.Days[1].LotID)
+		assert.Equal(t, 1, calendar.Days[1].Lots)
+	})
+
+	t.Run("price calendar of a lot", func(t *testing.T) {
+		query := query
+		query.LotID = 10
+
+		calendar, err := pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"100 EUR", "", "", "100 EUR"}, prices(calendar))
+		assert.Equal(t, 0, calendar.Days[1].Lots)
+	})
+
+	t.Run("cancellation invalidates the calendar", func(t *testing.T) {
+		err := scheduler.Cancel(ctx, booking.ID)
+		require.NoError(t, err)
+
+		calendar, err := pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Equal(
+			t,
+			[]string{"100 EUR", "100 EUR", "100 EUR", "100 EUR"},
+			prices(calendar),
+		)
+	})
+
+	t.Run("rates invalidate the calendar", func(t *testing.T) {
+		err := pricer.SetRates(ctx, 11, pricing.Rates{
+			Nightly: amount(t, "90", "EUR"),
+		})
+		require.NoError(t, err)
+
+		calendar, err := pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Equal(t, "90 EUR", calendar.Days[0].Price.String())
+	})
+
+	t.Run("hold and block invalidate the calendar", func(t *testing.T) {
+		calendar, err := pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, calendar.Days[0].Lots)
+
+		held := dear
+		held.StartAt = day(1).Add(14 * time.Hour)
+		held.EndAt = day(2).Add(11 * time.Hour)
+
+		_, err = scheduler.Hold(ctx, held, time.Hour)
+		require.NoError(t, err)
+
+		calendar, err = pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Equal(t, "100 EUR", calendar.Days[0].Price.String())
+		assert.Equal(t, 1, calendar.Days[0].Lots)
+
+		blocked := held
+		blocked.LotID = cheap.LotID
+
+		_, err = scheduler.Block(ctx, blocked, "", domain.AccessSubject(1))
+		require.NoError(t, err)
+
+		calendar, err = pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+		assert.Nil(t, calendar.Days[0].Price)
+		assert.Equal(t, 0, calendar.Days[0].Lots)
+	})
+
+	t.Run("unknown currency", func(t *testing.T) {
+		_, err := pricer.PriceCalendar(ctx, query, "XYZ")
+		assert.ErrorIs(t, err, pricing.ErrInvalidQuote)
+	})
+
+	t.Run("conversion without converter", func(t *testing.T) {
+		_, err := pricer.PriceCalendar(ctx, query, "USD")
+		assert.ErrorIs(t, err, pricing.ErrInvalidQuote)
+	})
+}
+
+// racingAvailability invalidates calendars of the region while free
+// nights are read the first time, as a booking committed meanwhile does.
+type racingAvailability struct {
+	pricer *pricing.Pricer
+	calls  int
+}
+
+func (availability *racingAvailability) FreeNights(
+	_ context.Context,
+	query schedule.Query,
+) (schedule.FreeNights, error) {
+	availability.calls++
+	if availability.calls == 1 {
+		availability.pricer.InvalidateCalendar(schedule.TimeSlot{Region: query.Region})
+	}
+
+	return schedule.FreeNights{From: query.From, Days: 1}, nil
+}
+
+func Test_PriceCalendar_invalidated_meanwhile(t *testing.T) {
+	availability := &racingAvailability{}
+	availability.pricer = pricing.New(
+		mysqldb.New(nil),
+		pricing.WithAvailability(availability),
+	)
+
+	ctx := context.Background()
+	query := schedule.Query{
+		Region: schedule.CodeID{'F', 'I'},
+		From:   time.Date(2023, time.July, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2023, time.July, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	for range [3]struct{}{} {
+		_, err := availability.pricer.PriceCalendar(ctx, query, "")
+		require.NoError(t, err)
+	}
+
+	// The first calendar is dropped, the second one is cached.
+	assert.Equal(t, 2, availability.calls)
+}
@@ -0,0 +1,236 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/cockroachdb/apd/v3"
+	"github.com/findbed/app/pricing/mysqldb"
+	"github.com/findbed/app/schedule"
+)
+
+// ChargeKind is how a tax or a fee is counted.
+type ChargeKind string
+
+const (
+	// ChargePercent is a percentage of the price of the nights.
+	ChargePercent ChargeKind = "percent"
+	// ChargePerNight is charged for every night.
+	ChargePerNight ChargeKind = "per_night"
+	// ChargePerPerson is charged for every guest for every night.
+	ChargePerPerson ChargeKind = "per_person"
+	// ChargeOnce is charged once for the stay.
+	ChargeOnce ChargeKind = "once"
+)
+
+// Rule is a tax or a fee, Name is the key of its label in translations.
+// Percent is set for ChargePercent and Amount for the rest.
+type Rule struct {
+	Name    string           `json:"name"`
+	Kind    ChargeKind       `json:"kind"`
+	Percent string           `json:"percent,omitempty"`
+	Amount  *currency.Amount `json:"amount,omitempty"`
+}
+
+func (rule Rule) validate() error {
+	if rule.Name == "" {
+		return fmt.Errorf("name of charge is required, %w", ErrInvalidRates)
+	}
+
+	switch rule.Kind {
+	case ChargePercent:
+		percent, _, err := apd.NewFromString(rule.Percent)
+		if err != nil || percent.Form != apd.Finite ||
+			percent.Sign() < 0 || percent.Cmp(apd.New(100, 0)) > 0 {
+			return fmt.Errorf("percent of %s, %w", rule.Name, ErrInvalidRates)
+		}
+
+		if rule.Amount != nil {
+			return fmt.Errorf("amount of %s is set, %w", rule.Name, ErrInvalidRates)
+		}
+	case ChargePerNight, ChargePerPerson, ChargeOnce:
+		if rule.Amount == nil || rule.Amount.IsNegative() {
+			return fmt.Errorf("amount of %s, %w", rule.Name, ErrInvalidRates)
+		}
+
+		if rule.Percent != "" {
+			return fmt.Errorf("percent of %s is set, %w", rule.Name, ErrInvalidRates)
+		}
+	default:
+		return fmt.Errorf("kind %q of %s, %w", rule.Kind, rule.Name, ErrInvalidRates)
+	}
+
+	return nil
+}
+
+// Location is where a lot is, zero Area or Locality is the whole
+// region or area.
+type Location struct {
+	Region   schedule.CodeID
+	Area     schedule.ID
+	Locality schedule.ID
+}
+
+// Charge is a tax or a fee of a quote.
+type Charge struct {
+	Name   string
+	Kind   ChargeKind
+	Amount currency.Amount
+}
+
+// SetCharges replaces taxes and fees of the location.
+func (unit *Pricer) SetCharges(
+	ctx context.Context,
+	location Location,
+	rules []Rule,
+) error {
+	if location.Region == (schedule.CodeID{}) {
+		return fmt.Errorf("region is required, %w", ErrInvalidRates)
+	}
+
+	if location.Area == 0 && location.Locality != 0 {
+		return fmt.Errorf("area of locality is required, %w", ErrInvalidRates)
+	}
+
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rules, %w", err)
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	txw.Error(mysqldb.SetCharges(ctx, txw, mysqldb.ChargesRecord{
+		Region:    string(location.Region[:]),
+		Area:      uint16(location.Area),
+		Locality:  uint16(location.Locality),
+		Rules:     string(data),
+		UpdatedAt: time.Now().Unix(),
+	}))
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to set charges, %w", err)
+	}
+
+	return nil
+}
+
+// Charges returns taxes and fees of the region, of the area and of
+// the locality of the location.
+func (unit *Pricer) Charges(ctx context.Context, location Location) ([]Rule, error) {
+	if location.Region == (schedule.CodeID{}) {
+		return nil, nil
+	}
+
+	recs, err := unit.connector.ListCharges(
+		ctx,
+		string(location.Region[:]),
+		uint16(location.Area),
+		uint16(location.Locality),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list charges, %w", err)
+	}
+
+	var result []Rule
+
+	for _, rec := range recs {
+		var rules []Rule
+		if err := json.Unmarshal([]byte(rec.Rules), &rules); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rules, %w", err)
+		}
+
+		result = append(result, rules...)
+	}
+
+	return result, nil
+}
+
+// charge counts the rule for the stay, fixed amounts in other
+// currencies are converted to the currency of the subtotal.
+func (unit *Pricer) charge(
+	rule Rule,
+	subtotal currency.Amount,
+	nights int,
+	guests uint8,
+) (Charge, error) {
+	charge := Charge{Name: rule.Name, Kind: rule.Kind}
+
+	if rule.Kind == ChargePercent {
+		amount, err := subtotal.Mul(rule.Percent)
+		if err != nil {
+			return Charge{}, fmt.Errorf("failed to charge %s, %w", rule.Name, err)
+		}
+
+		if amount, err = amount.Div("100"); err != nil {
+			return Charge{}, fmt.Errorf("failed to charge %s, %w", rule.Name, err)
+		}
+
+		charge.Amount = amount.Round()
+
+		return charge, nil
+	}
+
+	amount := *rule.Amount
+
+	if code := subtotal.CurrencyCode(); amount.CurrencyCode() != code {
+		if unit.converter == nil {
+			return Charge{}, fmt.Errorf(
+				"%s is not in %s, %w", amount, code, ErrInvalidQuote,
+			)
+		}
+
+		converted, err := unit.converter.Convert(amount, code)
+		if err != nil {
+			return Charge{}, fmt.Errorf(
+				"failed to convert %s, %s, %w", rule.Name, err, ErrInvalidQuote,
+			)
+		}
+
+		amount = converted
+	}
+
+	times := 1
+
+	switch rule.Kind {
+	case ChargePerNight:
+		times = nights
+	case ChargePerPerson:
+		times = nights * int(guests)
+	}
+
+	amount, err := amount.Mul(strconv.Itoa(times))
+	if err != nil {
+		return Charge{}, fmt.Errorf("failed to charge %s, %w", rule.Name, err)
+	}
+
+	charge.Amount = amount
+
+	return charge, nil
+}
@@ -0,0 +1,166 @@
+package pricing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConverter struct{}
+
+func (fakeConverter) Convert(
+	amount currency.Amount,
+	code string,
+) (currency.Amount, error) {
+	return amount.Convert(code, "0.01")
+}
+
+func Test_Quote_charges(t *testing.T) {
+	conn, close := newConnector(t)
+	defer close()
+
+	ctx := context.Background()
+	pricer := pricing.New(conn)
+
+	cleaning := amount(t, "30", "EUR")
+
+	err := pricer.SetRates(ctx, 10, pricing.Rates{
+		Nightly: amount(t, "100", "EUR"),
+		Guests:  2,
+		Fees: []pricing.Rule{
+			{Name: "cleaning_fee", Kind: pricing.ChargeOnce, Amount: &cleaning},
+		},
+	})
+	require.NoError(t, err)
+
+	region := schedule.CodeID{'F', 'I'}
+	touristTax := amount(t, "200", "RUB")
+	cityLevy := amount(t, "1.5", "EUR")
+
+	err = pricer.SetCharges(
+		ctx,
+		pricing.Location{Region: region},
+		[]pricing.Rule{{Name: "vat", Kind: pricing.ChargePercent, Percent: "10"}},
+	)
+	require.NoError(t, err)
+
+	err = pricer.SetCharges(
+		ctx,
+		pricing.Location{Region: region, Area: 1, Locality: 2},
+		[]pricing.Rule{
+			{Name: "tourist_tax", Kind: pricing.ChargePerPerson, Amount: &touristTax},
+			{Name: "city_levy", Kind: pricing.ChargePerNight, Amount: &cityLevy},
+		},
+	)
+	require.NoError(t, err)
+
+	err = pricer.SetCharges(
+		ctx,
+		pricing.Location{Region: region, Area: 3},
+		[]pricing.Rule{{Name: "other_area", Kind: pricing.ChargeOnce, Amount: &cleaning}},
+	)
+	require.NoError(t, err)
+
+	from := time.Date(2023, time.June, 12, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 2)
+	location := pricing.Location{Region: region, Area: 1, Locality: 2}
+
+	t.Run("charges are itemised", func(t *testing.T) {
+		pricer := pricing.New(conn, pricing.WithConverter(fakeConverter{}))
+
+		quote, err := pricer.Quote(ctx, 10, location, from, to, 3)
+		require.NoError(t, err)
+
+		actual := map[string]string{}
+		for _, charge := range quote.Charges {
+			actual[charge.Name] = charge.Amount.String()
+		}
+
+		expected := map[string]string{
+			"cleaning_fee": "30 EUR",
+			"vat":          "20.00 EUR",
+			"tourist_tax":  "12.00 EUR",
+			"city_levy":    "3.0 EUR",
+		}
+		assert.Equal(t, expected, actual)
+		assert.Equal(t, "200 EUR", quote.Subtotal.String())
+		assert.Equal(t, "265.00 EUR", quote.Total.String())
+	})
+
+	t.Run("charges in other currency need a converter", func(t *testing.T) {
+		_, err := pricer.Quote(ctx, 10, location, from, to, 3)
+		assert.ErrorIs(t, err, pricing.ErrInvalidQuote)
+	})
+
+	t.Run("charges of the region only", func(t *testing.T) {
+		location := pricing.Location{Region: region, Area: 1}
+
+		quote, err := pricer.Quote(ctx, 10, location, from, to, 3)
+		require.NoError(t, err)
+		assert.Len(t, quote.Charges, 2)
+		assert.Equal(t, "250.00 EUR", quote.Total.String())
+	})
+}
+
+func Test_SetCharges_invalid(t *testing.T) {
+	pricer, close := newPricer(t)
+	defer close()
+
+	ctx := context.Background()
+	fee := amount(t, "10", "EUR")
+	region := pricing.Location{Region: schedule.CodeID{'F', 'I'}}
+
+	for name, tc := range map[string]struct {
+		location pricing.Location
+		rule     pricing.Rule
+	}{
+		"without region": {
+			rule: pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "10"},
+		},
+		"locality without area": {
+			location: pricing.Location{Region: region.Region, Locality: 1},
+			rule:     pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "10"},
+		},
+		"without name": {
+			location: region,
+			rule:     pricing.Rule{Kind: pricing.ChargeOnce, Amount: &fee},
+		},
+		"unknown kind": {
+			location: region,
+			rule:     pricing.Rule{Name: "fee", Kind: "weekly", Amount: &fee},
+		},
+		"percent over 100": {
+			location: region,
+			rule:     pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "120"},
+		},
+		"percent is not a number": {
+			location: region,
+			rule:     pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "NaN"},
+		},
+		"infinite percent": {
+			location: region,
+			rule:     pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "-Inf"},
+		},
+		"negative percent": {
+			location: region,
+			rule:     pricing.Rule{Name: "vat", Kind: pricing.ChargePercent, Percent: "-1"},
+		},
+		"fixed without amount": {
+			location: region,
+			rule:     pricing.Rule{Name: "fee", Kind: pricing.ChargePerNight},
+		},
+	} {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			err := pricer.SetCharges(ctx, tc.location, []pricing.Rule{tc.rule})
+			assert.ErrorIs(t, err, pricing.ErrInvalidRates)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+)
+
+// ChargesRecord is taxes and fees of a location, zero Area or Locality
+// is the whole region or area. Rules is JSON of the rules.
+type ChargesRecord struct {
+	Region    string
+	Area      uint16
+	Locality  uint16
+	Rules     string
+	UpdatedAt int64
+}
+
+// SetCharges replaces the charges of the location.
+func SetCharges(ctx context.Context, stmt isql.ContextStatement, rec ChargesRecord) error {
+	query, args, err := squirrel.Delete("charges").
+		Where(squirrel.Eq{
+			"region":   rec.Region,
+			"area":     rec.Area,
+			"locality": rec.Locality,
+		}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete a record, %w", err)
+	}
+
+	query = `insert into charges(
+		region,
+		area,
+		locality,
+		rules,
+		updated_at)values(?,?,?,?,?)`
+
+	_, err = stmt.ExecContext(
+		ctx,
+		query,
+		rec.Region,
+		rec.Area,
+		rec.Locality,
+		rec.Rules,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert, %w", err)
+	}
+
+	return nil
+}
+
+// ListCharges returns the charges of the region, of the area and of
+// the locality, the wider location goes first.
+func (conn *Connector) ListCharges(
+	ctx context.Context,
+	region string,
+	area uint16,
+	locality uint16,
+) ([]ChargesRecord, error) {
+	query, args, err := squirrel.Select(
+		"region",
+		"area",
+		"locality",
+		"rules",
+		"updated_at").
+		From("charges").
+		Where(squirrel.Eq{"region": region}).
+		Where(squirrel.Or{
+			squirrel.Eq{"area": 0, "locality": 0},
+			squirrel.Eq{"area": area, "locality": 0},
+			squirrel.Eq{"area": area, "locality": locality},
+		}).
+		OrderBy("area", "locality").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query, %w", err)
+	}
+	defer rows.Close()
+
+	var result []ChargesRecord
+
+	for rows.Next() {
+		var rec ChargesRecord
+
+		err := rows.Scan(
+			&rec.Region,
+			&rec.Area,
+			&rec.Locality,
+			&rec.Rules,
+			&rec.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows, %w", err)
+	}
+
+	return result, nil
+}
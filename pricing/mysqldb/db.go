@@ -0,0 +1,156 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/txwrapper"
+)
+
+type Connector struct {
+	db isql.DB
+}
+
+func New(db isql.DB) *Connector {
+	return &Connector{db: db}
+}
+
+// RatesRecord is the rates of the lot, Rates is JSON of all amounts
+// in Currency.
+type RatesRecord struct {
+	LotID     uint64
+	Currency  string
+	Rates     string
+	UpdatedAt int64
+}
+
+func (conn *Connector) Transaction(
+	ctx context.Context,
+) (*txwrapper.TxWrapper, error) {
+	wrapper := txwrapper.New(conn.db)
+	if err := wrapper.StartTx(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to start tx, %w", err)
+	}
+
+	return wrapper, nil
+}
+
+// SetRates replaces the rates of the lot.
+func SetRates(ctx context.Context, stmt isql.ContextStatement, rec RatesRecord) error {
+	query, args, err := squirrel.Delete("rates").
+		Where(squirrel.Eq{"lot_id": rec.LotID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete a record, %w", err)
+	}
+
+	query = `insert into rates(
+		lot_id,
+		currency,
+		rates,
+		updated_at)values(?,?,?,?)`
+
+	_, err = stmt.ExecContext(
+		ctx,
+		query,
+		rec.LotID,
+		rec.Currency,
+		rec.Rates,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert, %w", err)
+	}
+
+	return nil
+}
+
+// GetRates returns the rates of the lot, sql.ErrNoRows if there are none.
+func (conn *Connector) GetRates(ctx context.Context, lotID uint64) (*RatesRecord, error) {
+	query, args, err := squirrel.Select(
+		"lot_id",
+		"currency",
+		"rates",
+		"updated_at").
+		From("rates").
+		Where(squirrel.Eq{"lot_id": lotID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	var rec RatesRecord
+
+	err = conn.db.QueryRowContext(ctx, query, args...).Scan(
+		&rec.LotID,
+		&rec.Currency,
+		&rec.Rates,
+		&rec.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	return &rec, nil
+}
+
+// ListRates returns the rates of the lots which have them.
+func (conn *Connector) ListRates(ctx context.Context, lotIDs []uint64) ([]RatesRecord, error) {
+	query, args, err := squirrel.Select(
+		"lot_id",
+		"currency",
+		"rates",
+		"updated_at").
+		From("rates").
+		Where(squirrel.Eq{"lot_id": lotIDs}).
+		OrderBy("lot_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query, %w", err)
+	}
+	defer rows.Close()
+
+	var result []RatesRecord
+
+	for rows.Next() {
+		var rec RatesRecord
+
+		err := rows.Scan(&rec.LotID, &rec.Currency, &rec.Rates, &rec.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows, %w", err)
+	}
+
+	return result, nil
+}
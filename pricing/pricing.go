@@ -0,0 +1,385 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pricing
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/pricing/mysqldb"
+	"github.com/findbed/app/schedule"
+)
+
+var (
+	ErrNotFound     = errors.New("rates not found")
+	ErrInvalidRates = errors.New("invalid rates")
+	ErrInvalidQuote = errors.New("invalid quote")
+)
+
+// maxNights is the longest stay a quote is made for.
+const maxNights = 366
+
+// Converter converts amounts between currencies.
+type Converter interface {
+	Convert(currency.Amount, string) (currency.Amount, error)
+}
+
+type Pricer struct {
+	connector    *mysqldb.Connector
+	converter    Converter
+	availability Availability
+	cache        *calendarCache
+}
+
+type Option func(*Pricer)
+
+// WithConverter lets taxes and fees in other currencies be charged.
+func WithConverter(converter Converter) Option {
+	return func(p *Pricer) {
+		p.converter = converter
+	}
+}
+
+func New(conn *mysqldb.Connector, opts ...Option) *Pricer {
+	pricer := &Pricer{
+		connector: conn,
+		cache:     newCalendarCache(calendarTTL),
+	}
+
+	for _, opt := range opts {
+		opt(pricer)
+	}
+
+	return pricer
+}
+
+// SeasonRate overrides the nightly rate for the nights of the season.
+type SeasonRate struct {
+	schedule.Season
+
+	Nightly currency.Amount `json:"nightly"`
+}
+
+// Rates are prices of the lot, all amounts are in the currency of
+// the nightly rate. The last matching season wins. Weekend is added
+// to the nights of the weekend days, Friday and Saturday unless they
+// are set. ExtraGuest is charged per night for every guest over Guests.
+type Rates struct {
+	Nightly     currency.Amount  `json:"nightly"`
+	Seasons     []SeasonRate     `json:"seasons,omitempty"`
+	Weekend     *currency.Amount `json:"weekend,omitempty"`
+	WeekendDays []time.Weekday   `json:"weekend_days,omitempty"`
+	Guests      uint8            `json:"guests"`
+	ExtraGuest  *currency.Amount `json:"extra_guest,omitempty"`
+	Fees        []Rule           `json:"fees,omitempty"`
+}
+
+var defaultWeekendDays = []time.Weekday{time.Friday, time.Saturday}
+
+func (rates Rates) validate() error {
+	code := rates.Nightly.CurrencyCode()
+	if code == "" {
+		return fmt.Errorf("nightly rate is required, %w", ErrInvalidRates)
+	}
+
+	amounts := []currency.Amount{rates.Nightly}
+
+	for _, season := range rates.Seasons {
+		if !season.Valid() {
+			return fmt.Errorf("season %v, %w", season.Season, ErrInvalidRates)
+		}
+
+		amounts = append(amounts, season.Nightly)
+	}
+
+	for _, amount := range []*currency.Amount{rates.Weekend, rates.ExtraGuest} {
+		if amount != nil {
+			amounts = append(amounts, *amount)
+		}
+	}
+
+	for _, fee := range rates.Fees {
+		if err := fee.validate(); err != nil {
+			return err
+		}
+
+		if fee.Amount != nil {
+			amounts = append(amounts, *fee.Amount)
+		}
+	}
+
+	for _, amount := range amounts {
+		if amount.CurrencyCode() != code {
+			return fmt.Errorf(
+				"%s is not in %s, %w", amount, code, ErrInvalidRates,
+			)
+		}
+
+		if amount.IsNegative() {
+			return fmt.Errorf("%s is negative, %w", amount, ErrInvalidRates)
+		}
+	}
+
+	for _, day := range rates.WeekendDays {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("weekday %d, %w", day, ErrInvalidRates)
+		}
+	}
+
+	return nil
+}
+
+// SetRates replaces the rates of the lot.
+func (unit *Pricer) SetRates(
+	ctx context.Context,
+	lotID schedule.LongID,
+	rates Rates,
+) error {
+	if lotID == 0 {
+		return fmt.Errorf("lot is required, %w", ErrInvalidRates)
+	}
+
+	if err := rates.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rates, %w", err)
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	txw.Error(mysqldb.SetRates(ctx, txw, mysqldb.RatesRecord{
+		LotID:     uint64(lotID),
+		Currency:  rates.Nightly.CurrencyCode(),
+		Rates:     string(data),
+		UpdatedAt: time.Now().Unix(),
+	}))
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to set rates, %w", err)
+	}
+
+	// The lot isn't known to be in any region, so all calendars go.
+	unit.cache.invalidate(schedule.CodeID{})
+
+	return nil
+}
+
+// Rates returns the rates of the lot.
+func (unit *Pricer) Rates(ctx context.Context, lotID schedule.LongID) (Rates, error) {
+	rec, err := unit.connector.GetRates(ctx, uint64(lotID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Rates{}, fmt.Errorf("failed to find rates of lot %d, %w", lotID, ErrNotFound)
+	}
+
+	if err != nil {
+		return Rates{}, fmt.Errorf("failed to get rates, %w", err)
+	}
+
+	var rates Rates
+	if err := json.Unmarshal([]byte(rec.Rates), &rates); err != nil {
+		return Rates{}, fmt.Errorf("failed to unmarshal rates, %w", err)
+	}
+
+	return rates, nil
+}
+
+// Night is the price of the night starting on Date.
+type Night struct {
+	Date       time.Time
+	Nightly    currency.Amount
+	Weekend    currency.Amount
+	ExtraGuest currency.Amount
+	Total      currency.Amount
+}
+
+// Discount is taken off the total of a quote by a promo code.
+type Discount struct {
+	Code   string
+	Amount currency.Amount
+}
+
+// Quote is the price of a stay, Subtotal is the price of the nights
+// and Total includes the charges and the discount.
+type Quote struct {
+	LotID    schedule.LongID
+	Location Location
+	From     time.Time
+	To       time.Time
+	Guests   uint8
+	Nights   []Night
+	Subtotal currency.Amount
+	Charges  []Charge
+	Discount *Discount
+	Total    currency.Amount
+}
+
+// Quote prices the nights from the day of from to the day of to
+// for the guests, with fees of the lot and taxes and fees of
+// the location.
+func (unit *Pricer) Quote(
+	ctx context.Context,
+	lotID schedule.LongID,
+	location Location,
+	from time.Time,
+	to time.Time,
+	guests uint8,
+) (Quote, error) {
+	first := startOfDay(from)
+	last := startOfDay(to)
+
+	if !first.Before(last) {
+		return Quote{}, fmt.Errorf("stay has no nights, %w", ErrInvalidQuote)
+	}
+
+	if last.After(first.AddDate(0, 0, maxNights)) {
+		return Quote{}, fmt.Errorf(
+			"stay is longer than %d nights, %w", maxNights, ErrInvalidQuote,
+		)
+	}
+
+	rates, err := unit.Rates(ctx, lotID)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	quote := Quote{
+		LotID:    lotID,
+		Location: location,
+		From:     from,
+		To:       to,
+		Guests:   guests,
+		Nights:   []Night{},
+		Charges:  []Charge{},
+	}
+
+	for day := first; day.Before(last); day = day.AddDate(0, 0, 1) {
+		night, err := rates.night(day, guests)
+		if err != nil {
+			return Quote{}, err
+		}
+
+		quote.Nights = append(quote.Nights, night)
+
+		if quote.Subtotal, err = quote.Subtotal.Add(night.Total); err != nil {
+			return Quote{}, fmt.Errorf("failed to sum nights, %w", err)
+		}
+	}
+
+	charges, err := unit.Charges(ctx, location)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	quote.Total = quote.Subtotal
+
+	for _, rule := range append(rates.Fees, charges...) {
+		charge, err := unit.charge(rule, quote.Subtotal, len(quote.Nights), guests)
+		if err != nil {
+			return Quote{}, err
+		}
+
+		quote.Charges = append(quote.Charges, charge)
+
+		if quote.Total, err = quote.Total.Add(charge.Amount); err != nil {
+			return Quote{}, fmt.Errorf("failed to sum charges, %w", err)
+		}
+	}
+
+	return quote, nil
+}
+
+// night prices the night starting on the day.
+func (rates Rates) night(day time.Time, guests uint8) (Night, error) {
+	code := rates.Nightly.CurrencyCode()
+	zero, _ := currency.NewAmount("0", code)
+
+	night := Night{
+		Date:       day,
+		Nightly:    rates.Nightly,
+		Weekend:    zero,
+		ExtraGuest: zero,
+	}
+
+	for _, season := range rates.Seasons {
+		if season.Contains(day) {
+			night.Nightly = season.Nightly
+		}
+	}
+
+	weekendDays := rates.WeekendDays
+	if len(weekendDays) == 0 {
+		weekendDays = defaultWeekendDays
+	}
+
+	if rates.Weekend != nil {
+		for _, weekday := range weekendDays {
+			if day.Weekday() == weekday {
+				night.Weekend = *rates.Weekend
+
+				break
+			}
+		}
+	}
+
+	if rates.ExtraGuest != nil && guests > rates.Guests {
+		extra := strconv.Itoa(int(guests - rates.Guests))
+
+		fee, err := rates.ExtraGuest.Mul(extra)
+		if err != nil {
+			return Night{}, fmt.Errorf("failed to charge extra guests, %w", err)
+		}
+
+		night.ExtraGuest = fee
+	}
+
+	total := night.Nightly
+
+	for _, amount := range []currency.Amount{night.Weekend, night.ExtraGuest} {
+		var err error
+
+		if total, err = total.Add(amount); err != nil {
+			return Night{}, fmt.Errorf("failed to sum a night, %w", err)
+		}
+	}
+
+	night.Total = total
+
+	return night, nil
+}
+
+func startOfDay(point time.Time) time.Time {
+	return time.Date(
+		point.Year(),
+		point.Month(),
+		point.Day(),
+		0,
+		0,
+		0,
+		0,
+		point.Location(),
+	)
+}
@@ -0,0 +1,163 @@
+package pricing_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/pricing/mysqldb"
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPricer(t *testing.T) (*pricing.Pricer, func() error) {
+	t.Helper()
+
+	conn, close := newConnector(t)
+
+	return pricing.New(conn), close
+}
+
+func newConnector(t *testing.T) (*mysqldb.Connector, func() error) {
+	t.Helper()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	return mysqldb.New(curDB), close
+}
+
+func amount(t *testing.T, number, code string) currency.Amount {
+	t.Helper()
+
+	val, err := currency.NewAmount(number, code)
+	require.NoError(t, err)
+
+	return val
+}
+
+func Test_Quote(t *testing.T) {
+	pricer, close := newPricer(t)
+	defer close()
+
+	ctx := context.Background()
+
+	weekend := amount(t, "20", "EUR")
+	extraGuest := amount(t, "15.50", "EUR")
+
+	rates := pricing.Rates{
+		Nightly: amount(t, "100", "EUR"),
+		Seasons: []pricing.SeasonRate{
+			{
+				Season: schedule.Season{
+					From: schedule.MonthDay{Month: time.July, Day: 1},
+					To:   schedule.MonthDay{Month: time.August, Day: 31},
+				},
+				Nightly: amount(t, "150", "EUR"),
+			},
+		},
+		Weekend:    &weekend,
+		Guests:     2,
+		ExtraGuest: &extraGuest,
+	}
+
+	err := pricer.SetRates(ctx, 10, rates)
+	require.NoError(t, err)
+
+	t.Run("nights are priced", func(t *testing.T) {
+		// Thursday to Sunday, the last night is in the season.
+		from := time.Date(2023, time.June, 29, 14, 0, 0, 0, time.UTC)
+		to := time.Date(2023, time.July, 2, 12, 0, 0, 0, time.UTC)
+
+		quote, err := pricer.Quote(ctx, 10, pricing.Location{}, from, to, 3)
+		require.NoError(t, err)
+
+		require.Len(t, quote.Nights, 3)
+
+		totals := []string{}
+		for _, night := range quote.Nights {
+			totals = append(totals, night.Total.String())
+		}
+
+		expected := []string{"115.50 EUR", "135.50 EUR", "185.50 EUR"}
+		assert.Equal(t, expected, totals)
+		assert.Equal(t, "436.50 EUR", quote.Total.String())
+
+		last := quote.Nights[2]
+		assert.Equal(t, "150 EUR", last.Nightly.String())
+		assert.Equal(t, "20 EUR", last.Weekend.String())
+		assert.Equal(t, "15.50 EUR", last.ExtraGuest.String())
+	})
+
+	t.Run("guests within the rate are not charged", func(t *testing.T) {
+		from := time.Date(2023, time.June, 12, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2023, time.June, 13, 0, 0, 0, 0, time.UTC)
+
+		quote, err := pricer.Quote(ctx, 10, pricing.Location{}, from, to, 2)
+		require.NoError(t, err)
+		assert.Equal(t, "100 EUR", quote.Total.String())
+	})
+
+	t.Run("stay without nights", func(t *testing.T) {
+		from := time.Date(2023, time.June, 12, 10, 0, 0, 0, time.UTC)
+		to := time.Date(2023, time.June, 12, 20, 0, 0, 0, time.UTC)
+
+		_, err := pricer.Quote(ctx, 10, pricing.Location{}, from, to, 2)
+		assert.ErrorIs(t, err, pricing.ErrInvalidQuote)
+	})
+
+	t.Run("lot without rates", func(t *testing.T) {
+		from := time.Date(2023, time.June, 12, 0, 0, 0, 0, time.UTC)
+
+		_, err := pricer.Quote(ctx, 11, pricing.Location{}, from, from.AddDate(0, 0, 1), 2)
+		assert.ErrorIs(t, err, pricing.ErrNotFound)
+	})
+}
+
+func Test_SetRates_invalid(t *testing.T) {
+	pricer, close := newPricer(t)
+	defer close()
+
+	ctx := context.Background()
+	dollars := amount(t, "10", "USD")
+	negative := amount(t, "-10", "EUR")
+
+	for name, rates := range map[string]pricing.Rates{
+		"without nightly rate": {},
+		"mixed currencies": {
+			Nightly: amount(t, "100", "EUR"),
+			Weekend: &dollars,
+		},
+		"negative fee": {
+			Nightly:    amount(t, "100", "EUR"),
+			ExtraGuest: &negative,
+		},
+		"wrong season": {
+			Nightly: amount(t, "100", "EUR"),
+			Seasons: []pricing.SeasonRate{
+				{Nightly: amount(t, "100", "EUR")},
+			},
+		},
+	} {
+		rates := rates
+
+		t.Run(name, func(t *testing.T) {
+			err := pricer.SetRates(ctx, 10, rates)
+			assert.ErrorIs(t, err, pricing.ErrInvalidRates)
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/txwrapper"
+)
+
+type Connector struct {
+	db isql.DB
+}
+
+func New(db isql.DB) *Connector {
+	return &Connector{db: db}
+}
+
+// Record is a promotion, Value is the percent or the amount off
+// in Currency. Zero limits are unlimited.
+type Record struct {
+	Code           string
+	Kind           string
+	Value          string
+	Currency       string
+	Region         string
+	MinNights      uint16
+	StartsAt       int64
+	EndsAt         int64
+	MaxRedemptions uint32
+	Redemptions    uint32
+	UpdatedAt      int64
+}
+
+func (conn *Connector) Transaction(
+	ctx context.Context,
+) (*txwrapper.TxWrapper, error) {
+	wrapper := txwrapper.New(conn.db)
+	if err := wrapper.StartTx(ctx, nil); err != nil {
+		return nil, fmt.Errorf("failed to start tx, %w", err)
+	}
+
+	return wrapper, nil
+}
+
+// SetPromotion adds the promotion or updates it keeping the count
+// of redemptions.
+func SetPromotion(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
+	_, err := GetPromotion(ctx, stmt, rec.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return addPromotion(ctx, stmt, rec)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	query, args, err := squirrel.Update("promotions").
+		SetMap(map[string]interface{}{
+			"kind":            rec.Kind,
+			"value":           rec.Value,
+			"currency":        rec.Currency,
+			"region":          rec.Region,
+			"min_nights":      rec.MinNights,
+			"starts_at":       rec.StartsAt,
+			"ends_at":         rec.EndsAt,
+			"max_redemptions": rec.MaxRedemptions,
+			"updated_at":      rec.UpdatedAt,
+		}).
+		Where(squirrel.Eq{"code": rec.Code}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update, %w", err)
+	}
+
+	return nil
+}
+
+func addPromotion(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
+	query := `insert into promotions(
+		code,
+		kind,
+		value,
+		currency,
+		region,
+		min_nights,
+		starts_at,
+		ends_at,
+		max_redemptions,
+		redemptions,
+		updated_at)values(?,?,?,?,?,?,?,?,?,?,?)`
+
+	_, err := stmt.ExecContext(
+		ctx,
+		query,
+		rec.Code,
+		rec.Kind,
+		rec.Value,
+		rec.Currency,
+		rec.Region,
+		rec.MinNights,
+		rec.StartsAt,
+		rec.EndsAt,
+		rec.MaxRedemptions,
+		0,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert, %w", err)
+	}
+
+	return nil
+}
+
+// GetPromotion returns the promotion, sql.ErrNoRows if there is none.
+func GetPromotion(ctx context.Context, stmt isql.ContextStatement, code string) (*Record, error) {
+	query, args, err := squirrel.Select(
+		"code",
+		"kind",
+		"value",
+		"currency",
+		"region",
+		"min_nights",
+		"starts_at",
+		"ends_at",
+		"max_redemptions",
+		"redemptions",
+		"updated_at").
+		From("promotions").
+		Where(squirrel.Eq{"code": code}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	var rec Record
+
+	err = stmt.QueryRowContext(ctx, query, args...).Scan(
+		&rec.Code,
+		&rec.Kind,
+		&rec.Value,
+		&rec.Currency,
+		&rec.Region,
+		&rec.MinNights,
+		&rec.StartsAt,
+		&rec.EndsAt,
+		&rec.MaxRedemptions,
+		&rec.Redemptions,
+		&rec.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	return &rec, nil
+}
+
+// GetPromotion returns the promotion, sql.ErrNoRows if there is none.
+func (conn *Connector) GetPromotion(ctx context.Context, code string) (*Record, error) {
+	return GetPromotion(ctx, conn.db, code)
+}
+
+// Redeem counts a redemption of the code by the booking, it returns
+// false if the code has run out of redemptions. The count is checked
+// and increased by a single statement, so concurrent bookings can't
+// exceed the limit.
+func Redeem(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	code string,
+	bookingID uint64,
+	createdAt int64,
+) (bool, error) {
+	query, args, err := squirrel.Update("promotions").
+		Set("redemptions", squirrel.Expr("redemptions + 1")).
+		Where(squirrel.Eq{"code": code}).
+		Where(squirrel.Or{
+			squirrel.Eq{"max_redemptions": 0},
+			squirrel.Expr("redemptions < max_redemptions"),
+		}).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	res, err := stmt.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update, %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows, %w", err)
+	}
+
+	if affected == 0 {
+		return false, nil
+	}
+
+	query = `insert into redemptions(
+		code,
+		booking_id,
+		created_at)values(?,?,?)`
+
+	if _, err := stmt.ExecContext(ctx, query, code, bookingID, createdAt); err != nil {
+		return false, fmt.Errorf("failed to insert, %w", err)
+	}
+
+	return true, nil
+}
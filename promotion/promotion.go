@@ -0,0 +1,408 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promotion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/cockroachdb/apd/v3"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/promotion/mysqldb"
+	"github.com/findbed/app/schedule"
+)
+
+var (
+	ErrNotFound         = errors.New("promo code not found")
+	ErrInvalidPromotion = errors.New("invalid promotion")
+	ErrNotApplicable    = errors.New("promo code is not applicable")
+	ErrExhausted        = errors.New("promo code is exhausted")
+)
+
+// maxCodeLength is the size of the code column.
+const maxCodeLength = 32
+
+// Kind is how a discount is counted.
+type Kind string
+
+const (
+	// KindPercent takes a percentage off the price of the nights.
+	KindPercent Kind = "percent"
+	// KindAmount takes a fixed amount off the price of the nights.
+	KindAmount Kind = "amount"
+)
+
+// Promotion is a promo code, zero limits are unlimited. The code can
+// be redeemed from StartsAt until EndsAt for stays in the Region of
+// at least MinNights.
+type Promotion struct {
+	Code           string
+	Kind           Kind
+	Percent        string
+	Amount         *currency.Amount
+	StartsAt       time.Time
+	EndsAt         time.Time
+	Region         schedule.CodeID
+	MinNights      uint16
+	MaxRedemptions uint32
+	Redemptions    uint32
+}
+
+func (promo Promotion) validate() error {
+	if promo.Code == "" || len(promo.Code) > maxCodeLength {
+		return fmt.Errorf("code must be 1 to %d characters, %w", maxCodeLength, ErrInvalidPromotion)
+	}
+
+	switch promo.Kind {
+	case KindPercent:
+		percent, _, err := apd.NewFromString(promo.Percent)
+		if err != nil || percent.Form != apd.Finite ||
+			percent.Sign() <= 0 || percent.Cmp(apd.New(100, 0)) > 0 {
+			return fmt.Errorf("percent %q, %w", promo.Percent, ErrInvalidPromotion)
+		}
+
+		if promo.Amount != nil {
+			return fmt.Errorf("amount is set, %w", ErrInvalidPromotion)
+		}
+	case KindAmount:
+		if promo.Amount == nil || promo.Amount.IsNegative() || promo.Amount.IsZero() {
+			return fmt.Errorf("amount must be positive, %w", ErrInvalidPromotion)
+		}
+
+		if promo.Percent != "" {
+			return fmt.Errorf("percent is set, %w", ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("kind %q, %w", promo.Kind, ErrInvalidPromotion)
+	}
+
+	if !promo.StartsAt.IsZero() && !promo.EndsAt.IsZero() &&
+		!promo.StartsAt.Before(promo.EndsAt) {
+		return fmt.Errorf("promotion ends before it starts, %w", ErrInvalidPromotion)
+	}
+
+	return nil
+}
+
+// check returns ErrNotApplicable if the code can't be redeemed at
+// the moment for the stay.
+func (promo Promotion) check(
+	now time.Time,
+	region schedule.CodeID,
+	from time.Time,
+	to time.Time,
+) error {
+	if !promo.StartsAt.IsZero() && now.Before(promo.StartsAt) {
+		return fmt.Errorf("%s has not started, %w", promo.Code, ErrNotApplicable)
+	}
+
+	if !promo.EndsAt.IsZero() && !now.Before(promo.EndsAt) {
+		return fmt.Errorf("%s has ended, %w", promo.Code, ErrNotApplicable)
+	}
+
+	if promo.Region != (schedule.CodeID{}) && promo.Region != region {
+		return fmt.Errorf(
+			"%s is for region %s, %w", promo.Code, promo.Region[:], ErrNotApplicable,
+		)
+	}
+
+	if nights(from, to) < int(promo.MinNights) {
+		return fmt.Errorf(
+			"%s is for %d nights or more, %w", promo.Code, promo.MinNights, ErrNotApplicable,
+		)
+	}
+
+	if promo.MaxRedemptions != 0 && promo.Redemptions >= promo.MaxRedemptions {
+		return fmt.Errorf("%s, %w", promo.Code, ErrExhausted)
+	}
+
+	return nil
+}
+
+// Converter converts amounts between currencies.
+type Converter interface {
+	Convert(currency.Amount, string) (currency.Amount, error)
+}
+
+type Promoter struct {
+	connector *mysqldb.Connector
+	converter Converter
+}
+
+type Option func(*Promoter)
+
+// WithConverter lets amounts off be taken from prices in other currencies.
+func WithConverter(converter Converter) Option {
+	return func(p *Promoter) {
+		p.converter = converter
+	}
+}
+
+func New(conn *mysqldb.Connector, opts ...Option) *Promoter {
+	promoter := &Promoter{connector: conn}
+
+	for _, opt := range opts {
+		opt(promoter)
+	}
+
+	return promoter
+}
+
+// SetPromotion adds or updates the promotion, its redemptions are kept.
+func (unit *Promoter) SetPromotion(ctx context.Context, promo Promotion) error {
+	promo.Code = normalize(promo.Code)
+
+	if err := promo.validate(); err != nil {
+		return err
+	}
+
+	rec := mysqldb.Record{
+		Code:           promo.Code,
+		Kind:           string(promo.Kind),
+		Value:          promo.Percent,
+		MinNights:      promo.MinNights,
+		StartsAt:       unixOrZero(promo.StartsAt),
+		EndsAt:         unixOrZero(promo.EndsAt),
+		MaxRedemptions: promo.MaxRedemptions,
+		UpdatedAt:      time.Now().Unix(),
+	}
+
+	if promo.Amount != nil {
+		rec.Value = promo.Amount.Number()
+		rec.Currency = promo.Amount.CurrencyCode()
+	}
+
+	if promo.Region != (schedule.CodeID{}) {
+		rec.Region = string(promo.Region[:])
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	txw.Error(mysqldb.SetPromotion(ctx, txw, rec))
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to set promotion, %w", err)
+	}
+
+	return nil
+}
+
+// Promotion returns the promotion of the code.
+func (unit *Promoter) Promotion(ctx context.Context, code string) (Promotion, error) {
+	return promotion(ctx, unit.connector.GetPromotion, code)
+}
+
+// Apply takes the discount of the code off the quote.
+func (unit *Promoter) Apply(
+	ctx context.Context,
+	code string,
+	quote pricing.Quote,
+) (pricing.Quote, error) {
+	promo, err := unit.Promotion(ctx, code)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	err = promo.check(time.Now(), quote.Location.Region, quote.From, quote.To)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	amount, err := unit.discount(promo, quote.Subtotal)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	total, err := quote.Total.Sub(amount)
+	if err != nil {
+		return pricing.Quote{}, fmt.Errorf("failed to take discount off, %w", err)
+	}
+
+	quote.Discount = &pricing.Discount{Code: promo.Code, Amount: amount}
+	quote.Total = total
+
+	return quote, nil
+}
+
+// discount returns the amount off the subtotal, it is never more than
+// the subtotal.
+func (unit *Promoter) discount(
+	promo Promotion,
+	subtotal currency.Amount,
+) (currency.Amount, error) {
+	if promo.Kind == KindPercent {
+		amount, err := subtotal.Mul(promo.Percent)
+		if err != nil {
+			return currency.Amount{}, fmt.Errorf("failed to count discount, %w", err)
+		}
+
+		if amount, err = amount.Div("100"); err != nil {
+			return currency.Amount{}, fmt.Errorf("failed to count discount, %w", err)
+		}
+
+		return amount.Round(), nil
+	}
+
+	amount := *promo.Amount
+
+	if code := subtotal.CurrencyCode(); amount.CurrencyCode() != code {
+		if unit.converter == nil {
+			return currency.Amount{}, fmt.Errorf(
+				"%s is not in %s, %w", amount, code, ErrNotApplicable,
+			)
+		}
+
+		converted, err := unit.converter.Convert(amount, code)
+		if err != nil {
+			return currency.Amount{}, fmt.Errorf(
+				"failed to convert %s, %s, %w", amount, err, ErrNotApplicable,
+			)
+		}
+
+		amount = converted
+	}
+
+	more, err := amount.Cmp(subtotal)
+	if err != nil {
+		return currency.Amount{}, fmt.Errorf("failed to compare discount, %w", err)
+	}
+
+	if more > 0 {
+		return subtotal, nil
+	}
+
+	return amount, nil
+}
+
+// Redeem counts a redemption of the code by the booking within
+// the statement of the booking, so the booking fails if the code
+// has run out. Cancelled bookings don't give the redemption back.
+func (unit *Promoter) Redeem(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	code string,
+	booking schedule.Booking,
+) error {
+	getPromotion := func(ctx context.Context, code string) (*mysqldb.Record, error) {
+		return mysqldb.GetPromotion(ctx, stmt, code)
+	}
+
+	promo, err := promotion(ctx, getPromotion, code)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	err = promo.check(now, booking.Slot.Region, booking.Slot.StartAt, booking.Slot.EndAt)
+	if err != nil {
+		return err
+	}
+
+	ok, err := mysqldb.Redeem(ctx, stmt, promo.Code, uint64(booking.ID), now.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to redeem %s, %w", promo.Code, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("%s, %w", promo.Code, ErrExhausted)
+	}
+
+	return nil
+}
+
+func promotion(
+	ctx context.Context,
+	get func(context.Context, string) (*mysqldb.Record, error),
+	code string,
+) (Promotion, error) {
+	code = normalize(code)
+
+	rec, err := get(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Promotion{}, fmt.Errorf("%s, %w", code, ErrNotFound)
+	}
+
+	if err != nil {
+		return Promotion{}, fmt.Errorf("failed to get promotion, %w", err)
+	}
+
+	return record2promotion(*rec)
+}
+
+func record2promotion(rec mysqldb.Record) (Promotion, error) {
+	promo := Promotion{
+		Code:           rec.Code,
+		Kind:           Kind(rec.Kind),
+		MinNights:      rec.MinNights,
+		MaxRedemptions: rec.MaxRedemptions,
+		Redemptions:    rec.Redemptions,
+	}
+
+	if rec.StartsAt != 0 {
+		promo.StartsAt = time.Unix(rec.StartsAt, 0)
+	}
+
+	if rec.EndsAt != 0 {
+		promo.EndsAt = time.Unix(rec.EndsAt, 0)
+	}
+
+	copy(promo.Region[:], rec.Region)
+
+	if promo.Kind == KindPercent {
+		promo.Percent = rec.Value
+
+		return promo, nil
+	}
+
+	amount, err := currency.NewAmount(rec.Value, rec.Currency)
+	if err != nil {
+		return Promotion{}, fmt.Errorf("failed to read amount of %s, %w", rec.Code, err)
+	}
+
+	promo.Amount = &amount
+
+	return promo, nil
+}
+
+// normalize makes codes case-insensitive.
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func unixOrZero(point time.Time) int64 {
+	if point.IsZero() {
+		return 0
+	}
+
+	return point.Unix()
+}
+
+// nights counts nights like quotes do, by days of check-in and check-out.
+func nights(from time.Time, to time.Time) int {
+	first := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(last.Sub(first).Hours() / 24)
+}
@@ -0,0 +1,246 @@
+package promotion_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bojanz/currency"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/promotion"
+	"github.com/findbed/app/promotion/mysqldb"
+	"github.com/findbed/app/schedule"
+	scheduledb "github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var finland = schedule.CodeID{'F', 'I'}
+
+func newPromoter(
+	t *testing.T,
+) (*promotion.Promoter, *schedule.Scheduler, func() error) {
+	t.Helper()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(finland[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	promoter := promotion.New(mysqldb.New(curDB))
+	scheduler := schedule.New(
+		time.Now(),
+		scheduledb.New(curDB),
+		schedule.WithRedeemer(promoter),
+	)
+
+	return promoter, scheduler, close
+}
+
+func amount(t *testing.T, number, code string) currency.Amount {
+	t.Helper()
+
+	val, err := currency.NewAmount(number, code)
+	require.NoError(t, err)
+
+	return val
+}
+
+func newQuote(t *testing.T, nights int) pricing.Quote {
+	t.Helper()
+
+	from := time.Date(2023, time.June, 12, 0, 0, 0, 0, time.UTC)
+
+	return pricing.Quote{
+		Location: pricing.Location{Region: finland},
+		From:     from,
+		To:       from.AddDate(0, 0, nights),
+		Subtotal: amount(t, "200", "EUR"),
+		Total:    amount(t, "230", "EUR"),
+	}
+}
+
+func Test_Apply(t *testing.T) {
+	promoter, _, close := newPromoter(t)
+	defer close()
+
+	ctx := context.Background()
+	fixed := amount(t, "50", "EUR")
+	large := amount(t, "500", "EUR")
+	dollars := amount(t, "10", "USD")
+
+	for _, promo := range []promotion.Promotion{
+		{Code: "summer10", Kind: promotion.KindPercent, Percent: "10"},
+		{Code: "FIXED", Kind: promotion.KindAmount, Amount: &fixed, MinNights: 2},
+		{Code: "LARGE", Kind: promotion.KindAmount, Amount: &large},
+		{Code: "DOLLARS", Kind: promotion.KindAmount, Amount: &dollars},
+		{
+			Code:    "SWEDEN",
+			Kind:    promotion.KindPercent,
+			Percent: "5",
+			Region:  schedule.CodeID{'S', 'E'},
+		},
+		{
+			Code:     "LATER",
+			Kind:     promotion.KindPercent,
+			Percent:  "5",
+			StartsAt: time.Now().Add(time.Hour),
+		},
+		{
+			Code:    "ENDED",
+			Kind:    promotion.KindPercent,
+			Percent: "5",
+			EndsAt:  time.Now().Add(-time.Hour),
+		},
+	} {
+		err := promoter.SetPromotion(ctx, promo)
+		require.NoError(t, err)
+	}
+
+	t.Run("percent off", func(t *testing.T) {
+		quote, err := promoter.Apply(ctx, " Summer10 ", newQuote(t, 2))
+		require.NoError(t, err)
+		require.NotNil(t, quote.Discount)
+		assert.Equal(t, "SUMMER10", quote.Discount.Code)
+		assert.Equal(t, "20.00 EUR", quote.Discount.Amount.String())
+		assert.Equal(t, "210.00 EUR", quote.Total.String())
+	})
+
+	t.Run("amount off", func(t *testing.T) {
+		quote, err := promoter.Apply(ctx, "FIXED", newQuote(t, 2))
+		require.NoError(t, err)
+		assert.Equal(t, "180 EUR", quote.Total.String())
+	})
+
+	t.Run("amount off is no more than the nights", func(t *testing.T) {
+		quote, err := promoter.Apply(ctx, "LARGE", newQuote(t, 2))
+		require.NoError(t, err)
+		assert.Equal(t, "200 EUR", quote.Discount.Amount.String())
+		assert.Equal(t, "30 EUR", quote.Total.String())
+	})
+
+	for name, tc := range map[string]struct {
+		code   string
+		nights int
+		err    error
+	}{
+		"unknown code":          {"WINTER", 2, promotion.ErrNotFound},
+		"too few nights":        {"FIXED", 1, promotion.ErrNotApplicable},
+		"other region":          {"SWEDEN", 2, promotion.ErrNotApplicable},
+		"not started":           {"LATER", 2, promotion.ErrNotApplicable},
+		"ended":                 {"ENDED", 2, promotion.ErrNotApplicable},
+		"currency of the quote": {"DOLLARS", 2, promotion.ErrNotApplicable},
+	} {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			_, err := promoter.Apply(ctx, tc.code, newQuote(t, tc.nights))
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func Test_BookWithCode(t *testing.T) {
+	promoter, scheduler, close := newPromoter(t)
+	defer close()
+
+	ctx := context.Background()
+
+	err := promoter.SetPromotion(ctx, promotion.Promotion{
+		Code:           "ONCE",
+		Kind:           promotion.KindPercent,
+		Percent:        "15",
+		Region:         finland,
+		MaxRedemptions: 1,
+	})
+	require.NoError(t, err)
+
+	slot := schedule.TimeSlot{
+		NodeID:    finland,
+		HousingID: 1,
+		LotID:     10,
+		Region:    finland,
+		Area:      1,
+		Locality:  1,
+	}
+
+	err = scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	day := time.Now().Truncate(time.Hour).AddDate(0, 0, 1)
+
+	first := slot
+	first.StartAt = day
+	first.EndAt = day.AddDate(0, 0, 2)
+
+	_, err = scheduler.BookWithCode(ctx, first, 1, "once")
+	require.NoError(t, err)
+
+	promo, err := promoter.Promotion(ctx, "ONCE")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), promo.Redemptions)
+
+	second := slot
+	second.StartAt = day.AddDate(0, 0, 3)
+	second.EndAt = day.AddDate(0, 0, 5)
+
+	t.Run("exhausted code fails the booking", func(t *testing.T) {
+		_, err := scheduler.BookWithCode(ctx, second, 2, "ONCE")
+		assert.ErrorIs(t, err, promotion.ErrExhausted)
+
+		_, err = scheduler.Book(ctx, second, 2)
+		assert.NoError(t, err)
+	})
+
+	t.Run("code without scheduler support", func(t *testing.T) {
+		plain := schedule.New(time.Now(), nil)
+
+		_, err := plain.BookWithCode(ctx, second, 2, "ONCE")
+		assert.ErrorIs(t, err, schedule.ErrInvalidSlot)
+	})
+}
+
+func Test_SetPromotion_invalid(t *testing.T) {
+	promoter, _, close := newPromoter(t)
+	defer close()
+
+	ctx := context.Background()
+	negative := amount(t, "-5", "EUR")
+	now := time.Now()
+
+	for name, promo := range map[string]promotion.Promotion{
+		"without code":            {Kind: promotion.KindPercent, Percent: "5"},
+		"unknown kind":            {Code: "A", Kind: "free"},
+		"percent over 100":        {Code: "A", Kind: promotion.KindPercent, Percent: "101"},
+		"percent is not a number": {Code: "A", Kind: promotion.KindPercent, Percent: "NaN"},
+		"infinite percent":        {Code: "A", Kind: promotion.KindPercent, Percent: "Inf"},
+		"negative amount":         {Code: "A", Kind: promotion.KindAmount, Amount: &negative},
+		"without amount":          {Code: "A", Kind: promotion.KindAmount},
+		"ends before it starts": {
+			Code:     "A",
+			Kind:     promotion.KindPercent,
+			Percent:  "5",
+			StartsAt: now,
+			EndsAt:   now.Add(-time.Hour),
+		},
+	} {
+		promo := promo
+
+		t.Run(name, func(t *testing.T) {
+			err := promoter.SetPromotion(ctx, promo)
+			assert.ErrorIs(t, err, promotion.ErrInvalidPromotion)
+		})
+	}
+}
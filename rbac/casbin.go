@@ -21,13 +21,22 @@ import (
 
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
-	"github.com/findbed/app/domain"
 	"github.com/findbed/app/isql"
 	"github.com/imega/daemon/logging"
 )
 
+// Retrier runs the operation until it succeeds, notify is called
+// after every failed attempt.
+type Retrier interface {
+	Retry(
+		ctx context.Context,
+		operation func() error,
+		notify func(err error, next time.Duration),
+	) error
+}
+
 type Controller struct {
-	retrier   domain.Retrier
+	retrier   Retrier
 	db        isql.DB
 	enforcer  *casbin.CachedEnforcer
 	logger    logging.Logger
@@ -99,7 +108,7 @@ func makeModel() model.Model {
 
 type Option func(*Controller)
 
-func WithRetrier(retrier domain.Retrier) Option {
+func WithRetrier(retrier Retrier) Option {
 	return func(ctrl *Controller) {
 		ctrl.retrier = retrier
 	}
@@ -34,9 +34,9 @@ func WithSubject(
 	return context.WithValue(ctx, subjectCtxKey, subject)
 }
 
-func (ctrl *Controller) SubjectFromContext(
-	ctx context.Context,
-) domain.AccessSubject {
+// SubjectFromContext returns the subject put into the context by
+// WithSubject, the unknown user if there is none.
+func SubjectFromContext(ctx context.Context) domain.AccessSubject {
 	subject, ok := ctx.Value(subjectCtxKey).(domain.AccessSubject)
 	if !ok {
 		return domain.AccessSubjectUnknowUser
@@ -44,3 +44,9 @@ func (ctrl *Controller) SubjectFromContext(
 
 	return subject
 }
+
+func (ctrl *Controller) SubjectFromContext(
+	ctx context.Context,
+) domain.AccessSubject {
+	return SubjectFromContext(ctx)
+}
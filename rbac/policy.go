@@ -137,13 +137,10 @@ func (ctrl *Controller) RemoveGrouppingPolicy(
 		return fmt.Errorf("failed to remove a groupping policy, %w", err)
 	}
 
-	a := policy2policyParams(subject, domain.Policy{Subject: subject})
-	_, err = ctrl.enforcer.RemovePolicy(
-		// the function getting cache of casbin doesn't work correct with []string
-		a[0],
-	)
-	if err != nil {
-		return fmt.Errorf("failed to remove a policy, %w", err)
+	// Decisions of every member of the group are cached, so the whole
+	// cache is dropped.
+	if err := ctrl.enforcer.InvalidateCache(); err != nil {
+		return fmt.Errorf("failed to invalidate a cache, %w", err)
 	}
 
 	return nil
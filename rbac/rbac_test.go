@@ -10,6 +10,7 @@ import (
 
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/findbed/app/domain"
+	"github.com/findbed/app/migration"
 	"github.com/findbed/app/rbac"
 	"github.com/findbed/app/retrier"
 	"github.com/imega/testhelpers/db"
@@ -26,7 +27,7 @@ func TestRBAC(t *testing.T) {
 		q := `insert into casbin_rules(ptype,v0,v1,v2,v3)values
 			(1,  2,  3,  4,    5),
 			(1, 22, 13,  0,    0),
-			(2, 33, 22, 13, null)
+			(2, 33, 22,  0,    0)
 		`
 		_, err = tx.ExecContext(ctx, q)
 		require.NoError(t, err)
@@ -265,6 +266,35 @@ func TestRBAC(t *testing.T) {
 		assert.Equal(t, domain.Deny, actual)
 	})
 
+	t.Run("removed group rule was added again", func(t *testing.T) {
+		ctx := context.Background()
+
+		groupPolicy := domain.GrouppingPolicy{
+			Subject: domain.AccessSubject(gofakeit.Uint32()),
+			Role:    domain.AccessRoleAdmin,
+		}
+		err = ctrl.AddGrouppingPolicy(ctx, groupPolicy)
+		require.NoError(t, err)
+
+		err = ctrl.AddGrouppingPolicy(ctx, groupPolicy)
+		assert.ErrorIs(t, err, domain.ErrUserExists)
+
+		err = ctrl.RemoveGrouppingPolicy(ctx, groupPolicy)
+		require.NoError(t, err)
+
+		err = ctrl.AddGrouppingPolicy(ctx, groupPolicy)
+		require.NoError(t, err)
+
+		var count int
+		err = curDB.QueryRow(
+			`select count(*) from casbin_rules
+			where ptype = 2 and v0 = ? and deleted = 0`,
+			groupPolicy.Subject,
+		).Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
 	rows, err := curDB.Query("select ptype,v0,v1,v2,v3,deleted from casbin_rules")
 	require.NoError(t, err)
 	defer rows.Close()
@@ -303,22 +333,10 @@ func TestRBAC(t *testing.T) {
 }
 
 func CreateRulesTable(ctx context.Context, tx *sql.Tx) error {
-	q := `CREATE TABLE IF NOT EXISTS casbin_rules (
-		id      INTEGER          PRIMARY KEY AUTOINCREMENT,
-		ptype   INTEGER UNSIGNED,
-		v0      INTEGER UNSIGNED,
-		v1      INTEGER UNSIGNED,
-		v2      INTEGER UNSIGNED,
-		v3      INTEGER UNSIGNED,
-		deleted INTEGER UNSIGNED DEFAULT 0);
-
-		CREATE UNIQUE INDEX rule ON casbin_rules (
-			ptype, v0, v1, v2, v3
-		);
-    `
-
-	if _, err := tx.ExecContext(ctx, q); err != nil {
-		return fmt.Errorf("failed to execute query, %w", err)
+	for _, q := range migration.GlobalScope().Statements(migration.SQLite) {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to execute query, %w", err)
+		}
 	}
 
 	return nil
@@ -337,3 +355,59 @@ func (Logger) Errorf(format string, args ...interface{}) {
 func (Logger) Debugf(format string, args ...interface{}) {
 	fmt.Printf(format+"\n", args...)
 }
+
+func TestStorage_rule_of_wrong_length(t *testing.T) {
+	// RemoveGrouppingPolicy used to remove the policy of a one-value rule
+	// to drop cached decisions, it panicked with index out of range.
+	storage := &rbac.Storage{}
+
+	err := storage.RemovePolicy("p", "p", []string{"33"})
+	assert.ErrorIs(t, err, rbac.ErrInvalidRule)
+
+	err = storage.AddPolicy("g", "g", []string{"33"})
+	assert.ErrorIs(t, err, rbac.ErrInvalidRule)
+}
+
+func TestTokens(t *testing.T) {
+	tokens := rbac.NewTokens("secret")
+	subject := domain.AccessSubject(gofakeit.Uint32() + 1)
+
+	token, err := tokens.Sign(subject, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	t.Run("signed token is authenticated", func(t *testing.T) {
+		actual, err := tokens.Authenticate(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, subject, actual)
+	})
+
+	t.Run("forged token is rejected", func(t *testing.T) {
+		forged := strconv.FormatUint(uint64(subject)+1, 10) +
+			token[len(strconv.FormatUint(uint64(subject), 10)):]
+
+		_, err := tokens.Authenticate(context.Background(), forged)
+		assert.ErrorIs(t, err, rbac.ErrInvalidToken)
+
+		_, err = tokens.Authenticate(context.Background(), "33")
+		assert.ErrorIs(t, err, rbac.ErrInvalidToken)
+	})
+
+	t.Run("expired token is rejected", func(t *testing.T) {
+		expired, err := tokens.Sign(subject, time.Now().Add(-time.Second))
+		require.NoError(t, err)
+
+		_, err = tokens.Authenticate(context.Background(), expired)
+		assert.ErrorIs(t, err, rbac.ErrInvalidToken)
+	})
+
+	t.Run("token of another secret is rejected", func(t *testing.T) {
+		other := rbac.NewTokens("other")
+
+		_, err := other.Authenticate(context.Background(), token)
+		assert.ErrorIs(t, err, rbac.ErrInvalidToken)
+
+		other.SetSecret("")
+		_, err = other.Authenticate(context.Background(), token)
+		assert.ErrorIs(t, err, rbac.ErrNoSecret)
+	})
+}
@@ -16,7 +16,6 @@ package rbac
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"github.com/findbed/app/isql"
@@ -26,15 +25,37 @@ type record struct {
 	PType uint8
 	V0    uint64
 	V1    uint64
-	V2    *uint64
-	V3    *uint64
+	V2    uint64
+	V3    uint64
 }
 
 func add(ctx context.Context, db isql.Stmt, rec record) error {
+	// The unique key of the rules keeps a removed rule, it is restored.
+	restore := `update casbin_rules set deleted = 0
+				where ptype = ? and v0 = ? and v1 = ? and v2 = ? and v3 = ?
+				and deleted = 1`
+
+	res, err := db.ExecContext(
+		ctx,
+		restore,
+		rec.PType,
+		rec.V0,
+		rec.V1,
+		rec.V2,
+		rec.V3,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to execute a query, %w", err)
+	}
+
+	if num, err := res.RowsAffected(); num == 1 && err == nil {
+		return nil
+	}
+
 	query := `insert into casbin_rules(ptype,v0,v1,v2,v3)
 				values(?,?,?,?,?)`
 
-	res, err := db.ExecContext(
+	res, err = db.ExecContext(
 		ctx,
 		query,
 		rec.PType,
@@ -56,11 +77,7 @@ func add(ctx context.Context, db isql.Stmt, rec record) error {
 
 func remove(ctx context.Context, db isql.Stmt, rec record) error {
 	query := `update casbin_rules set deleted = 1
-				where ptype = ? and v0 = ? and v1 = ?`
-
-	if rec.V2 != nil && rec.V3 != nil {
-		query += ` and v2 = ? and v3 = ?`
-	}
+				where ptype = ? and v0 = ? and v1 = ? and v2 = ? and v3 = ?`
 
 	res, err := db.ExecContext(
 		ctx,
@@ -97,26 +114,19 @@ func list(ctx context.Context, db isql.Stmt, ptype uint8) ([]record, error) {
 
 	result := []record{}
 	for rows.Next() {
-		var (
-			rec record
-			v2  sql.NullInt64
-			v3  sql.NullInt64
-		)
+		var rec record
 
 		err := rows.Scan(
 			&rec.PType,
 			&rec.V0,
 			&rec.V1,
-			&v2,
-			&v3,
+			&rec.V2,
+			&rec.V3,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan, %w", err)
 		}
 
-		rec.V2 = getValue(v2)
-		rec.V3 = getValue(v3)
-
 		result = append(result, rec)
 	}
 
@@ -130,12 +140,3 @@ func list(ctx context.Context, db isql.Stmt, ptype uint8) ([]record, error) {
 
 	return result, nil
 }
-
-func getValue(val sql.NullInt64) *uint64 {
-	if val.Valid {
-		v := uint64(val.Int64)
-		return &v
-	}
-
-	return nil
-}
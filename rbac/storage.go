@@ -26,13 +26,16 @@ import (
 	"github.com/findbed/app/txwrapper"
 )
 
+var ErrInvalidRule = errors.New("invalid rule")
+
 const (
-	lengthPolicy         = 4
-	ptypePolicy          = 1
-	ptypeGrouppingPolicy = 2
-	codePolicy           = "p"
-	codeGrouppingPolicy  = "g"
-	star                 = "*"
+	lengthPolicy          = 4
+	lengthGrouppingPolicy = 2
+	ptypePolicy           = 1
+	ptypeGrouppingPolicy  = 2
+	codePolicy            = "p"
+	codeGrouppingPolicy   = "g"
+	star                  = "*"
 )
 
 type Storage struct {
@@ -78,7 +81,7 @@ func (unit *Storage) LoadPolicy(model model.Model) error {
 func records2rules(records []record) [][]string {
 	rules := make([][]string, len(records))
 	for idx, rec := range records {
-		if rec.V3 != nil {
+		if rec.PType == ptypePolicy {
 			rules[idx] = []string{
 				strconv.FormatUint(rec.V0, 10),
 				strconv.FormatUint(rec.V1, 10),
@@ -92,19 +95,18 @@ func records2rules(records []record) [][]string {
 		rules[idx] = []string{
 			strconv.FormatUint(rec.V0, 10),
 			strconv.FormatUint(rec.V1, 10),
-			applyStarAccess(rec.V2),
 		}
 	}
 
 	return rules
 }
 
-func applyStarAccess(val *uint64) string {
-	if *val == 0 {
+func applyStarAccess(val uint64) string {
+	if val == 0 {
 		return star
 	}
 
-	return strconv.FormatUint(*val, 10)
+	return strconv.FormatUint(val, 10)
 }
 
 // SavePolicy saves all policy rules to the storage.
@@ -130,9 +132,15 @@ func (unit *Storage) AddPolicy(sec, ptype string, rule []string) error {
 }
 
 func policy2record(ptype string, rule []string) (record, error) {
-	ptypeRaw := uint8(ptypePolicy)
+	ptypeRaw, length := uint8(ptypePolicy), lengthPolicy
 	if ptype == codeGrouppingPolicy {
-		ptypeRaw = ptypeGrouppingPolicy
+		ptypeRaw, length = ptypeGrouppingPolicy, lengthGrouppingPolicy
+	}
+
+	if len(rule) != length {
+		return record{}, fmt.Errorf(
+			"%s rule of %d values, %w", ptype, len(rule), ErrInvalidRule,
+		)
 	}
 
 	values := make([]uint64, len(rule))
@@ -159,8 +167,8 @@ func policy2record(ptype string, rule []string) (record, error) {
 	}
 
 	if len(rule) == lengthPolicy {
-		rec.V2 = &values[2]
-		rec.V3 = &values[3]
+		rec.V2 = values[2]
+		rec.V3 = values[3]
 	}
 
 	return rec, nil
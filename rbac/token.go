@@ -0,0 +1,129 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rbac
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/findbed/app/domain"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrNoSecret     = errors.New("secret of tokens isn't set")
+)
+
+// Tokens signs and verifies bearer tokens of subjects. A token is
+// "<subject>.<expiry in unix seconds>.<signature>", the signature is
+// the HMAC-SHA256 of the rest by the shared secret.
+type Tokens struct {
+	mu     sync.RWMutex
+	secret []byte
+}
+
+func NewTokens(secret string) *Tokens {
+	return &Tokens{secret: []byte(secret)}
+}
+
+// SetSecret replaces the secret, tokens signed by the previous one
+// are rejected.
+func (t *Tokens) SetSecret(secret string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.secret = []byte(secret)
+}
+
+// Sign returns the token of the subject valid until the time.
+func (t *Tokens) Sign(
+	subject domain.AccessSubject,
+	expiresAt time.Time,
+) (string, error) {
+	if subject == domain.AccessSubjectUnknowUser {
+		return "", domain.ErrUnknowUser
+	}
+
+	payload := strconv.FormatUint(uint64(subject), 10) + "." +
+		strconv.FormatInt(expiresAt.Unix(), 10)
+
+	signature, err := t.sign(payload)
+	if err != nil {
+		return "", err
+	}
+
+	return payload + "." + signature, nil
+}
+
+// Authenticate returns the subject of the token.
+func (t *Tokens) Authenticate(
+	ctx context.Context,
+	token string,
+) (domain.AccessSubject, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return domain.AccessSubjectUnknowUser, ErrInvalidToken
+	}
+
+	signature, err := t.sign(parts[0] + "." + parts[1])
+	if err != nil {
+		return domain.AccessSubjectUnknowUser, err
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(parts[2])) {
+		return domain.AccessSubjectUnknowUser, ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return domain.AccessSubjectUnknowUser,
+			fmt.Errorf("failed to parse an expiry, %w", ErrInvalidToken)
+	}
+
+	if time.Now().Unix() >= expiresAt {
+		return domain.AccessSubjectUnknowUser,
+			fmt.Errorf("token is expired, %w", ErrInvalidToken)
+	}
+
+	subject, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || subject == uint64(domain.AccessSubjectUnknowUser) {
+		return domain.AccessSubjectUnknowUser,
+			fmt.Errorf("failed to parse a subject, %w", ErrInvalidToken)
+	}
+
+	return domain.AccessSubject(subject), nil
+}
+
+func (t *Tokens) sign(payload string) (string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if len(t.secret) == 0 {
+		return "", ErrNoSecret
+	}
+
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/findbed/app/schedule"
+	"github.com/imega/daemon"
+	"github.com/imega/daemon/logging"
+)
+
+// registryWatcher loads the node registry from APP_SCHEDULE_NODES,
+// a comma-separated list of region:node pairs.
+func registryWatcher(
+	registry *schedule.Registry,
+	logger logging.Logger,
+) daemon.WatcherConfigFunc {
+	return func() daemon.WatcherConfig {
+		return daemon.WatcherConfig{
+			Prefix:  appName,
+			MainKey: "schedule",
+			Keys:    []string{"nodes"},
+			ApplyFunc: func(conf, reset map[string]string) {
+				val, ok := conf[appName+"/schedule/nodes"]
+				if !ok {
+					return
+				}
+
+				if err := registry.Load(val); err != nil {
+					logger.Errorf("failed to load the node registry, %s", err)
+				}
+			},
+		}
+	}
+}
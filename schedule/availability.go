@@ -0,0 +1,613 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+var ErrInvalidRules = errors.New("invalid availability rules")
+
+// availabilityDays is the number of days ahead the rules are
+// materialised for, the lot is closed after them until the rules are
+// refreshed.
+const availabilityDays = 2 * 365
+
+// leapYear is a year every day of a season exists in.
+const leapYear = 2000
+
+type MonthDay struct {
+	Month time.Month `json:"month"`
+	Day   int        `json:"day"`
+}
+
+// Season is a yearly window including both days, it may span
+// the new year, e.g. from November to February.
+type Season struct {
+	From MonthDay `json:"from"`
+	To   MonthDay `json:"to"`
+}
+
+// Valid reports whether both days of the season exist in some year,
+// February 29 exists in leap years.
+func (season Season) Valid() bool {
+	for _, md := range []MonthDay{season.From, season.To} {
+		if md.Month < time.January || md.Month > time.December || md.Day < 1 {
+			return false
+		}
+
+		// Day zero of the next month is the last day of the month.
+		last := time.Date(leapYear, md.Month+1, 0, 0, 0, 0, 0, time.UTC)
+		if md.Day > last.Day() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Contains reports whether the day falls into the season.
+func (season Season) Contains(day time.Time) bool {
+	cur := int(day.Month())*100 + day.Day()
+	from := int(season.From.Month)*100 + season.From.Day
+	to := int(season.To.Month)*100 + season.To.Day
+
+	if from <= to {
+		return cur >= from && cur <= to
+	}
+
+	return cur >= from || cur <= to
+}
+
+// Exception opens or closes the days [From, To) regardless of
+// the weekdays and seasons.
+type Exception struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Open bool      `json:"open"`
+}
+
+// AvailabilityRules are days the lot is open on. Empty weekdays or
+// seasons don't restrict the days, the last matching exception wins.
+type AvailabilityRules struct {
+	Weekdays   []time.Weekday `json:"weekdays"`
+	Seasons    []Season       `json:"seasons"`
+	Exceptions []Exception    `json:"exceptions"`
+}
+
+func (rules AvailabilityRules) validate() error {
+	for _, day := range rules.Weekdays {
+		if day < time.Sunday || day > time.Saturday {
+			return fmt.Errorf("weekday %d, %w", day, ErrInvalidRules)
+		}
+	}
+
+	for _, season := range rules.Seasons {
+		if !season.Valid() {
+			return fmt.Errorf("season %v, %w", season, ErrInvalidRules)
+		}
+	}
+
+	for _, exception := range rules.Exceptions {
+		if !exception.From.Before(exception.To) {
+			return fmt.Errorf(
+				"exception from %s must be before to, %w",
+				exception.From,
+				ErrInvalidRules,
+			)
+		}
+	}
+
+	return nil
+}
+
+// open reports whether the lot is open on the day starting at midnight.
+func (unit *Scheduler) open(rules AvailabilityRules, day time.Time) bool {
+	for idx := len(rules.Exceptions) - 1; idx >= 0; idx-- {
+		exception := rules.Exceptions[idx]
+
+		if !day.Before(unit.startOfDay(exception.From)) &&
+			day.Before(unit.startOfDay(exception.To)) {
+			return exception.Open
+		}
+	}
+
+	if len(rules.Weekdays) > 0 {
+		found := false
+
+		for _, weekday := range rules.Weekdays {
+			if day.Weekday() == weekday {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(rules.Seasons) == 0 {
+		return true
+	}
+
+	for _, season := range rules.Seasons {
+		if season.Contains(day) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetAvailability replaces the rules of the lot of the slot and
+// materialises them into free intervals.
+func (unit *Scheduler) SetAvailability(
+	ctx context.Context,
+	slot TimeSlot,
+	rules AvailabilityRules,
+) error {
+	slot, err := unit.resolve(slot)
+	if err != nil {
+		return err
+	}
+
+	if err := rules.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rules, %w", err)
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	now := time.Now()
+	rec := mysqldb.RulesRecord{
+		Slot:      slot2record(slot, 0, 0),
+		Rules:     string(data),
+		UpdatedAt: now.Unix(),
+	}
+
+	prev, err := mysqldb.GetRules(ctx, txw, rec.Slot.NodeID, rec.Slot.LotID)
+	if errors.Is(err, sql.ErrNoRows) {
+		prev, err = nil, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("failed to get rules, %w", err)
+	}
+
+	if err == nil {
+		err = unit.materialise(ctx, txw, slot, rules, prev, now)
+	}
+
+	if err == nil {
+		err = mysqldb.SetRules(ctx, txw, rec)
+	}
+
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to set availability, %w", err)
+	}
+
+	unit.changed(slot)
+
+	return nil
+}
+
+// RefreshError reports lots whose availability failed to be refreshed,
+// the other lots are refreshed regardless.
+type RefreshError struct {
+	Errs []error
+}
+
+func (e *RefreshError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for idx, err := range e.Errs {
+		msgs[idx] = err.Error()
+	}
+
+	return fmt.Sprintf(
+		"failed to refresh %d lots, %s", len(e.Errs), strings.Join(msgs, "; "),
+	)
+}
+
+// Is reports whether any of the errors matches the target.
+func (e *RefreshError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RefreshAvailability materialises the rules of all lots of the node
+// again, so the materialised days move forward with time. It returns
+// the number of refreshed lots. A lot failing to be refreshed doesn't
+// stop the rest, failures are reported with RefreshError.
+func (unit *Scheduler) RefreshAvailability(
+	ctx context.Context,
+	node CodeID,
+) (int, error) {
+	records, err := unit.connector.ListRules(ctx, mysqldb.CodeID(node))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rules, %w", err)
+	}
+
+	refreshed := 0
+	failed := &RefreshError{}
+
+	for _, rec := range records {
+		if err := unit.refreshLot(ctx, rec); err != nil {
+			failed.Errs = append(
+				failed.Errs,
+				fmt.Errorf("lot %d, %w", rec.Slot.LotID, err),
+			)
+
+			continue
+		}
+
+		refreshed++
+	}
+
+	if len(failed.Errs) > 0 {
+		return refreshed, failed
+	}
+
+	return refreshed, nil
+}
+
+// refreshLot materialises the stored rules of the lot again.
+func (unit *Scheduler) refreshLot(
+	ctx context.Context,
+	rec mysqldb.RulesRecord,
+) error {
+	var rules AvailabilityRules
+	if err := json.Unmarshal([]byte(rec.Rules), &rules); err != nil {
+		return fmt.Errorf("failed to unmarshal rules, %w", err)
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	now := time.Now()
+	slot := unit.record2timeSlot(rec.Slot)
+	prev := rec
+
+	err = unit.materialise(ctx, txw, slot, rules, &prev, now)
+	if err == nil {
+		rec.UpdatedAt = now.Unix()
+		err = mysqldb.SetRules(ctx, txw, rec)
+	}
+
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to refresh, %w", err)
+	}
+
+	unit.changed(slot)
+
+	return nil
+}
+
+// RunRefresher refreshes the availability of the lots of every node
+// every interval until the context is done.
+func (unit *Scheduler) RunRefresher(
+	ctx context.Context,
+	interval time.Duration,
+	onError func(error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			nodes, err := unit.Nodes(ctx)
+			if err != nil {
+				onError(err)
+
+				continue
+			}
+
+			for _, node := range nodes {
+				if _, err := unit.RefreshAvailability(ctx, node); err != nil {
+					onError(fmt.Errorf("node %s, %w", node, err))
+				}
+			}
+		}
+	}
+}
+
+// materialise replaces free intervals of the lot from today on with
+// the open days of the rules. Free intervals before today are kept.
+//
+// Rows of free intervals are the only record of bookings made before
+// the ledger, so open days stay taken where no free interval is. Only
+// the hours the previous rules closed, or that were after the days they
+// were materialised for, are opened unless a booking, hold or block
+// takes them.
+func (unit *Scheduler) materialise(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	rules AvailabilityRules,
+	prev *mysqldb.RulesRecord,
+	now time.Time,
+) error {
+	open, windowStart, windowEnd, err := unit.openSpans(rules, now)
+	if err != nil {
+		return err
+	}
+
+	opened, err := unit.openedBefore(prev)
+	if err != nil {
+		return err
+	}
+
+	qry := mysqldb.Query{
+		NodeID: mysqldb.CodeID(slot.NodeID),
+		Region: mysqldb.CodeID(slot.Region),
+		LotID:  uint64(slot.LotID),
+		From:   minDay,
+		To:     maxDay,
+	}
+
+	records, err := unit.connector.ListOverlappingForUpdate(ctx, txw, qry)
+	if err != nil {
+		return fmt.Errorf("failed to get free slots, %w", err)
+	}
+
+	result, free := []span{}, []span{}
+
+	for _, rec := range records {
+		if rec.StartAt < windowStart {
+			endAt := rec.EndAt
+			if endAt > windowStart {
+				endAt = windowStart
+			}
+
+			result = append(result, span{startAt: rec.StartAt, endAt: endAt})
+		}
+
+		if rec.EndAt > windowStart {
+			free = append(free, span{startAt: rec.StartAt, endAt: rec.EndAt})
+		}
+	}
+
+	taken, err := unit.takenSpans(ctx, txw, slot, windowStart, windowEnd)
+	if err != nil {
+		return err
+	}
+
+	kept := intersectSpans(open, mergeSpans(free))
+	added := subtractSpans(open, opened)
+
+	result = append(result, subtractSpans(mergeSpans(append(kept, added...)), taken)...)
+	result = mergeSpans(result)
+
+	if err := mysqldb.Del(ctx, txw, qry); err != nil {
+		return fmt.Errorf("failed to delete free slots, %w", err)
+	}
+
+	for _, free := range result {
+		err := mysqldb.Add(ctx, txw, slot2record(slot, free.startAt, free.endAt))
+		if err != nil {
+			return fmt.Errorf("failed to add a slot, %w", err)
+		}
+	}
+
+	return nil
+}
+
+// openedBefore returns the hours the previous rules opened when they
+// were materialised, all hours are open for a lot without rules.
+func (unit *Scheduler) openedBefore(prev *mysqldb.RulesRecord) ([]span, error) {
+	if prev == nil {
+		return []span{{startAt: minDay, endAt: maxDay}}, nil
+	}
+
+	var rules AvailabilityRules
+	if err := json.Unmarshal([]byte(prev.Rules), &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rules, %w", err)
+	}
+
+	open, _, _, err := unit.openSpans(rules, time.Unix(prev.UpdatedAt, 0))
+
+	return open, err
+}
+
+// openSpans returns the open days of the rules in the window of
+// materialised days starting today and the window itself.
+func (unit *Scheduler) openSpans(
+	rules AvailabilityRules,
+	now time.Time,
+) ([]span, uint32, uint32, error) {
+	today := unit.startOfDay(now)
+	if today.Before(unit.firstDay) {
+		today = unit.startOfDay(unit.firstDay).AddDate(0, 0, 1)
+	}
+
+	windowStart, err := unit.numberHoursAfterFirstDay(today)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	open := []span{}
+	windowEnd := windowStart
+	last := today.AddDate(0, 0, availabilityDays)
+
+	for day := today; day.Before(last); day = day.AddDate(0, 0, 1) {
+		endAt, err := unit.numberHoursAfterFirstDay(day.AddDate(0, 0, 1))
+		if err != nil {
+			break
+		}
+
+		if unit.open(rules, day) {
+			open = append(open, span{startAt: windowEnd, endAt: endAt})
+		}
+
+		windowEnd = endAt
+	}
+
+	return mergeSpans(open), windowStart, windowEnd, nil
+}
+
+// releasable clips the interval released by the lot with its rules the
+// way materialise does: hours before today are returned as they are,
+// closed days and days after the window stay taken. The interval of
+// a lot without rules is returned whole.
+func (unit *Scheduler) releasable(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	startAt uint32,
+	endAt uint32,
+) ([]span, error) {
+	released := []span{{startAt: startAt, endAt: endAt}}
+
+	rec, rules, err := unit.lotRules(ctx, txw, slot)
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		return released, nil
+	}
+
+	closed, err := unit.closedSpans(rules, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return subtractSpans(released, closed), nil
+}
+
+// lotRules returns the rules of the lot, the record is nil if the lot
+// has no rules.
+func (unit *Scheduler) lotRules(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	slot TimeSlot,
+) (*mysqldb.RulesRecord, AvailabilityRules, error) {
+	var rules AvailabilityRules
+
+	rec, err := mysqldb.GetRules(
+		ctx,
+		stmt,
+		mysqldb.CodeID(slot.NodeID),
+		uint64(slot.LotID),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, rules, nil
+	}
+
+	if err != nil {
+		return nil, rules, fmt.Errorf("failed to get rules, %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(rec.Rules), &rules); err != nil {
+		return nil, rules, fmt.Errorf("failed to unmarshal rules, %w", err)
+	}
+
+	return rec, rules, nil
+}
+
+// closedSpans returns the hours the rules close from the day they are
+// materialised for on: closed days and days after the window.
+func (unit *Scheduler) closedSpans(
+	rules AvailabilityRules,
+	now time.Time,
+) ([]span, error) {
+	open, windowStart, windowEnd, err := unit.openSpans(rules, now)
+	if err != nil {
+		return nil, err
+	}
+
+	closed := subtractSpans([]span{{startAt: windowStart, endAt: windowEnd}}, open)
+
+	return append(closed, span{startAt: windowEnd, endAt: maxDay}), nil
+}
+
+// takenSpans returns intervals of active bookings, holds and blocks of
+// the lot overlapping the range.
+func (unit *Scheduler) takenSpans(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	slot TimeSlot,
+	from uint32,
+	to uint32,
+) ([]span, error) {
+	qry := mysqldb.Query{
+		NodeID: mysqldb.CodeID(slot.NodeID),
+		LotID:  uint64(slot.LotID),
+		From:   from,
+		To:     to,
+	}
+
+	booked, err := mysqldb.ListBookedIntervals(ctx, stmt, qry, []uint8{
+		uint8(BookingStatusConfirmed),
+		uint8(BookingStatusHeld),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bookings, %w", err)
+	}
+
+	blocks, err := unit.connector.ListBlocks(
+		ctx,
+		stmt,
+		qry,
+		uint8(BlockStatusActive),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blocks, %w", err)
+	}
+
+	result := make([]span, 0, len(booked)+len(blocks))
+
+	for _, rec := range booked {
+		result = append(result, span{startAt: rec.StartAt, endAt: rec.EndAt})
+	}
+
+	for _, rec := range blocks {
+		result = append(result, span{startAt: rec.Slot.StartAt, endAt: rec.Slot.EndAt})
+	}
+
+	return result, nil
+}
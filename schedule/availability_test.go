@@ -0,0 +1,370 @@
+package schedule_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SetAvailability(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	monday := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	for monday.Weekday() != time.Monday {
+		monday = monday.AddDate(0, 0, 1)
+	}
+
+	saturday := slot
+	saturday.StartAt = monday.AddDate(0, 0, 5)
+	saturday.EndAt = monday.AddDate(0, 0, 6)
+
+	booking, err := scheduler.Book(ctx, saturday, newGuest())
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID: slot.NodeID,
+		Region: slot.Region,
+		LotID:  slot.LotID,
+		From:   monday,
+		To:     monday.AddDate(0, 0, 14),
+	}
+
+	var (
+		free   = schedule.DayStatusFree
+		booked = schedule.DayStatusBooked
+		closed = schedule.DayStatusClosed
+	)
+
+	t.Run("only weekends are open", func(t *testing.T) {
+		rules := schedule.AvailabilityRules{
+			Weekdays: []time.Weekday{time.Saturday, time.Sunday},
+			Exceptions: []schedule.Exception{
+				{From: monday.AddDate(0, 0, 12), To: monday.AddDate(0, 0, 13)},
+			},
+		}
+
+		err := scheduler.SetAvailability(ctx, slot, rules)
+		require.NoError(t, err)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{
+			closed, closed, closed, closed, closed, booked, free,
+			closed, closed, closed, closed, closed, closed, free,
+		}
+		assert.Equal(t, expected, actual.Days)
+	})
+
+	t.Run("rules are re-applied", func(t *testing.T) {
+		err := scheduler.SetAvailability(ctx, slot, schedule.AvailabilityRules{})
+		require.NoError(t, err)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{
+			free, free, free, free, free, booked, free,
+			free, free, free, free, free, free, free,
+		}
+		assert.Equal(t, expected, actual.Days)
+
+		refreshed, err := scheduler.RefreshAvailability(ctx, slot.NodeID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, refreshed)
+	})
+
+	t.Run("booking is kept and can be cancelled", func(t *testing.T) {
+		err := scheduler.Cancel(ctx, booking.ID)
+		require.NoError(t, err)
+
+		query := query
+		query.From = saturday.StartAt
+		query.To = saturday.EndAt
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Len(t, slots, 1)
+	})
+
+	t.Run("seasons", func(t *testing.T) {
+		from := monday.AddDate(0, 0, 2)
+		to := monday.AddDate(0, 0, 3)
+
+		rules := schedule.AvailabilityRules{
+			Seasons: []schedule.Season{{
+				From: schedule.MonthDay{Month: from.Month(), Day: from.Day()},
+				To:   schedule.MonthDay{Month: to.Month(), Day: to.Day()},
+			}},
+		}
+
+		err := scheduler.SetAvailability(ctx, slot, rules)
+		require.NoError(t, err)
+
+		query := query
+		query.To = monday.AddDate(0, 0, 5)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{closed, closed, free, free, closed}
+		assert.Equal(t, expected, actual.Days)
+	})
+
+	t.Run("cancelled booking doesn't open closed days", func(t *testing.T) {
+		err := scheduler.SetAvailability(ctx, slot, schedule.AvailabilityRules{})
+		require.NoError(t, err)
+
+		stay := slot
+		stay.StartAt = monday.AddDate(0, 0, 1)
+		stay.EndAt = monday.AddDate(0, 0, 4)
+
+		booking, err := scheduler.Book(ctx, stay, newGuest())
+		require.NoError(t, err)
+
+		rules := schedule.AvailabilityRules{
+			Exceptions: []schedule.Exception{
+				{From: monday.AddDate(0, 0, 2), To: monday.AddDate(0, 0, 3)},
+			},
+		}
+
+		err = scheduler.SetAvailability(ctx, slot, rules)
+		require.NoError(t, err)
+
+		err = scheduler.Cancel(ctx, booking.ID)
+		require.NoError(t, err)
+
+		query := query
+		query.To = monday.AddDate(0, 0, 5)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{free, free, closed, free, free}
+		assert.Equal(t, expected, actual.Days)
+	})
+
+	t.Run("invalid rules", func(t *testing.T) {
+		rules := schedule.AvailabilityRules{Weekdays: []time.Weekday{7}}
+
+		err := scheduler.SetAvailability(ctx, slot, rules)
+		assert.ErrorIs(t, err, schedule.ErrInvalidRules)
+	})
+}
+
+func Test_SetAvailability_legacy_gap(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	scheduler := schedule.New(today, mysqldb.New(curDB))
+	ctx := context.Background()
+
+	// The lot was booked for the days 2 and 3 before bookings were
+	// recorded in the ledger, only the gap of free intervals is left.
+	for _, cur := range [][2]uint32{{0, 48}, {96, 876_000}} {
+		err := mysqldb.Add(ctx, curDB, mysqldb.Record{
+			NodeID:    mysqldb.CodeID(timeslot.NodeID),
+			Region:    mysqldb.CodeID(timeslot.Region),
+			HousingID: uint64(timeslot.HousingID),
+			LotID:     uint64(timeslot.LotID),
+			StartAt:   cur[0],
+			EndAt:     cur[1],
+		})
+		require.NoError(t, err)
+	}
+
+	query := schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		LotID:  timeslot.LotID,
+		From:   today,
+		To:     today.AddDate(0, 0, 7),
+	}
+
+	var (
+		free   = schedule.DayStatusFree
+		booked = schedule.DayStatusBooked
+		closed = schedule.DayStatusClosed
+	)
+
+	t.Run("open days keep the gap", func(t *testing.T) {
+		err := scheduler.SetAvailability(ctx, timeslot, schedule.AvailabilityRules{})
+		require.NoError(t, err)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{free, free, booked, booked, free, free, free}
+		assert.Equal(t, expected, actual.Days)
+	})
+
+	t.Run("reopened days keep the gap", func(t *testing.T) {
+		rules := schedule.AvailabilityRules{
+			Exceptions: []schedule.Exception{
+				{From: today.AddDate(0, 0, 4), To: today.AddDate(0, 0, 6)},
+			},
+		}
+
+		err := scheduler.SetAvailability(ctx, timeslot, rules)
+		require.NoError(t, err)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{free, free, booked, booked, closed, closed, free}
+		assert.Equal(t, expected, actual.Days)
+
+		err = scheduler.SetAvailability(ctx, timeslot, schedule.AvailabilityRules{})
+		require.NoError(t, err)
+
+		_, err = scheduler.RefreshAvailability(ctx, timeslot.NodeID)
+		require.NoError(t, err)
+
+		actual, err = scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected = []schedule.DayStatus{free, free, booked, booked, free, free, free}
+		assert.Equal(t, expected, actual.Days)
+	})
+}
+
+func Test_Nodes(t *testing.T) {
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, "ab")
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	registry := schedule.NewRegistry()
+	registry.Set(schedule.CodeID{'c', 'd'}, schedule.CodeID{'e', 'f'})
+
+	scheduler := schedule.New(
+		time.Now(),
+		mysqldb.New(curDB),
+		schedule.WithRegistry(registry),
+	)
+
+	actual, err := scheduler.Nodes(context.Background())
+	require.NoError(t, err)
+
+	expected := []schedule.CodeID{{'a', 'b'}, {'e', 'f'}}
+	assert.Equal(t, expected, actual)
+}
+
+func Test_Season_Valid(t *testing.T) {
+	tests := map[string]struct {
+		day      schedule.MonthDay
+		expected bool
+	}{
+		"first day":   {day: schedule.MonthDay{Month: time.January, Day: 1}, expected: true},
+		"last day":    {day: schedule.MonthDay{Month: time.December, Day: 31}, expected: true},
+		"leap day":    {day: schedule.MonthDay{Month: time.February, Day: 29}, expected: true},
+		"february 30": {day: schedule.MonthDay{Month: time.February, Day: 30}},
+		"february 31": {day: schedule.MonthDay{Month: time.February, Day: 31}},
+		"april 31":    {day: schedule.MonthDay{Month: time.April, Day: 31}},
+		"day zero":    {day: schedule.MonthDay{Month: time.May, Day: 0}},
+		"month 13":    {day: schedule.MonthDay{Month: 13, Day: 1}},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+
+		t.Run(name, func(t *testing.T) {
+			season := schedule.Season{
+				From: schedule.MonthDay{Month: time.January, Day: 1},
+				To:   tt.day,
+			}
+			assert.Equal(t, tt.expected, season.Valid())
+
+			season.From, season.To = tt.day, season.From
+			assert.Equal(t, tt.expected, season.Valid())
+		})
+	}
+}
+
+func Test_RefreshAvailability_with_broken_rules(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	scheduler := schedule.New(time.Now(), mysqldb.New(curDB))
+	ctx := context.Background()
+
+	broken := timeslot
+	broken.LotID++
+
+	err = mysqldb.SetRules(ctx, curDB, mysqldb.RulesRecord{
+		Slot: mysqldb.Record{
+			NodeID: mysqldb.CodeID(broken.NodeID),
+			Region: mysqldb.CodeID(broken.Region),
+			LotID:  uint64(broken.LotID),
+		},
+		Rules: "{",
+	})
+	require.NoError(t, err)
+
+	err = scheduler.RegisterLot(ctx, timeslot)
+	require.NoError(t, err)
+
+	err = scheduler.SetAvailability(ctx, timeslot, schedule.AvailabilityRules{})
+	require.NoError(t, err)
+
+	refreshed, err := scheduler.RefreshAvailability(ctx, timeslot.NodeID)
+	assert.Equal(t, 1, refreshed)
+
+	var refreshErr *schedule.RefreshError
+	require.ErrorAs(t, err, &refreshErr)
+	assert.Len(t, refreshErr.Errs, 1)
+}
@@ -0,0 +1,214 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+type BlockStatus uint8
+
+const (
+	BlockStatusActive BlockStatus = iota + 1
+	BlockStatusRemoved
+)
+
+const maxReasonLength = 255
+
+// Block is a period the owner closed the lot for, it isn't a booking.
+type Block struct {
+	ID     LongID
+	Status BlockStatus
+	Author domain.AccessSubject
+	Reason string
+
+	Slot TimeSlot
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Block takes the interval of the slot like Book does and records
+// the block with the reason and the author.
+func (unit *Scheduler) Block(
+	ctx context.Context,
+	slot TimeSlot,
+	reason string,
+	author domain.AccessSubject,
+) (Block, error) {
+	if len(reason) > maxReasonLength {
+		return Block{}, fmt.Errorf("reason is too long, %w", ErrInvalidSlot)
+	}
+
+	slot, startAt, endAt, err := unit.interval(slot)
+	if err != nil {
+		return Block{}, err
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return Block{}, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	block, err := unit.block(ctx, txw, slot, reason, author, startAt, endAt)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return Block{}, fmt.Errorf("failed to block a slot, %w", err)
+	}
+
+	unit.changed(block.Slot)
+
+	return block, nil
+}
+
+func (unit *Scheduler) block(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	reason string,
+	author domain.AccessSubject,
+	startAt uint32,
+	endAt uint32,
+) (Block, error) {
+	if err := unit.take(ctx, txw, slot, startAt, endAt); err != nil {
+		return Block{}, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	block := Block{
+		Status: BlockStatusActive,
+		Author: author,
+		Reason: reason,
+
+		Slot: slot,
+
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	id, err := mysqldb.AddBlock(ctx, txw, block2record(block, startAt, endAt))
+	if err != nil {
+		return Block{}, fmt.Errorf("failed to add a block, %w", err)
+	}
+
+	block.ID = LongID(id)
+
+	return block, nil
+}
+
+// FindBlock returns the block by its id.
+func (unit *Scheduler) FindBlock(ctx context.Context, id LongID) (Block, error) {
+	rec, err := unit.connector.GetBlock(ctx, unit.connector.DB(), uint64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Block{}, fmt.Errorf("failed to find a block %d, %w", id, ErrNotFound)
+	}
+
+	if err != nil {
+		return Block{}, fmt.Errorf("failed to get a block, %w", err)
+	}
+
+	return unit.record2block(*rec), nil
+}
+
+// Unblock returns the interval of the block to the free pool.
+func (unit *Scheduler) Unblock(ctx context.Context, id LongID) error {
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	slot, err := unit.unblock(ctx, txw, id)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to unblock a slot, %w", err)
+	}
+
+	unit.changed(slot)
+
+	return nil
+}
+
+// unblock releases the block and returns its slot.
+func (unit *Scheduler) unblock(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	id LongID,
+) (TimeSlot, error) {
+	rec, err := unit.connector.GetBlockForUpdate(ctx, txw, uint64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TimeSlot{}, fmt.Errorf("failed to find a block %d, %w", id, ErrNotFound)
+	}
+
+	if err != nil {
+		return TimeSlot{}, fmt.Errorf("failed to get a block, %w", err)
+	}
+
+	if BlockStatus(rec.Status) != BlockStatusActive {
+		return TimeSlot{}, fmt.Errorf("block %d is not active, %w", id, ErrNotFound)
+	}
+
+	block := unit.record2block(*rec)
+	err = unit.release(ctx, txw, block.Slot, rec.Slot.StartAt, rec.Slot.EndAt)
+	if err != nil {
+		return TimeSlot{}, err
+	}
+
+	rec.Status = uint8(BlockStatusRemoved)
+	rec.UpdatedAt = time.Now().Unix()
+
+	if err := mysqldb.UpdBlockStatus(ctx, txw, *rec); err != nil {
+		return TimeSlot{}, fmt.Errorf("failed to update a block, %w", err)
+	}
+
+	return block.Slot, nil
+}
+
+func block2record(block Block, startAt, endAt uint32) mysqldb.BlockRecord {
+	return mysqldb.BlockRecord{
+		ID:     uint64(block.ID),
+		Status: uint8(block.Status),
+		Author: uint64(block.Author),
+		Reason: block.Reason,
+
+		Slot: slot2record(block.Slot, startAt, endAt),
+
+		CreatedAt: block.CreatedAt.Unix(),
+		UpdatedAt: block.UpdatedAt.Unix(),
+	}
+}
+
+func (unit *Scheduler) record2block(rec mysqldb.BlockRecord) Block {
+	return Block{
+		ID:     LongID(rec.ID),
+		Status: BlockStatus(rec.Status),
+		Author: domain.AccessSubject(rec.Author),
+		Reason: rec.Reason,
+
+		Slot: unit.record2timeSlot(rec.Slot),
+
+		CreatedAt: time.Unix(rec.CreatedAt, 0),
+		UpdatedAt: time.Unix(rec.UpdatedAt, 0),
+	}
+}
@@ -0,0 +1,156 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Block(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	slot.StartAt = day.AddDate(0, 0, 1)
+	slot.EndAt = day.AddDate(0, 0, 3)
+
+	author := newGuest()
+
+	block, err := scheduler.Block(ctx, slot, "renovation", author)
+	require.NoError(t, err)
+
+	assert.Equal(t, schedule.BlockStatusActive, block.Status)
+	assert.Equal(t, author, block.Author)
+	assert.Equal(t, "renovation", block.Reason)
+
+	query := schedule.Query{
+		NodeID: slot.NodeID,
+		Region: slot.Region,
+		LotID:  slot.LotID,
+		From:   slot.StartAt,
+		To:     slot.EndAt,
+	}
+
+	t.Run("block is found by id", func(t *testing.T) {
+		found, err := scheduler.FindBlock(ctx, block.ID)
+		require.NoError(t, err)
+
+		assert.Equal(t, author, found.Author)
+		assert.Equal(t, slot.LotID, found.Slot.LotID)
+
+		_, err = scheduler.FindBlock(ctx, block.ID+1)
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
+	})
+
+	t.Run("blocked interval is unavailable", func(t *testing.T) {
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Empty(t, slots)
+
+		_, err = scheduler.Book(ctx, slot, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
+	})
+
+	t.Run("calendar shows blocked days", func(t *testing.T) {
+		query := query
+		query.From = day
+		query.To = day.AddDate(0, 0, 4)
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.DayStatus{
+			schedule.DayStatusFree,
+			schedule.DayStatusBlocked,
+			schedule.DayStatusBlocked,
+			schedule.DayStatusFree,
+		}
+		assert.Equal(t, expected, actual.Days)
+	})
+
+	t.Run("unblocked interval is free", func(t *testing.T) {
+		err := scheduler.Unblock(ctx, block.ID)
+		require.NoError(t, err)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Len(t, slots, 1)
+
+		err = scheduler.Unblock(ctx, block.ID)
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
+	})
+}
+
+func Test_Block_part_of_day(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	// The morning of the first day is blocked, the rest of it is
+	// closed by the rules.
+	morning := slot
+	morning.StartAt = day
+	morning.EndAt = day.Add(12 * time.Hour)
+
+	_, err = scheduler.Block(ctx, morning, "repair", newGuest())
+	require.NoError(t, err)
+
+	rules := schedule.AvailabilityRules{
+		Exceptions: []schedule.Exception{{From: day, To: day.AddDate(0, 0, 1)}},
+	}
+
+	err = scheduler.SetAvailability(ctx, slot, rules)
+	require.NoError(t, err)
+
+	// The morning of the second day is booked, the rest of it is
+	// blocked.
+	booked := slot
+	booked.StartAt = day.AddDate(0, 0, 1)
+	booked.EndAt = day.AddDate(0, 0, 1).Add(12 * time.Hour)
+
+	_, err = scheduler.Book(ctx, booked, newGuest())
+	require.NoError(t, err)
+
+	evening := slot
+	evening.StartAt = booked.EndAt
+	evening.EndAt = day.AddDate(0, 0, 2)
+
+	_, err = scheduler.Block(ctx, evening, "repair", newGuest())
+	require.NoError(t, err)
+
+	actual, err := scheduler.Calendar(ctx, schedule.Query{
+		NodeID: slot.NodeID,
+		Region: slot.Region,
+		LotID:  slot.LotID,
+		From:   day,
+		To:     day.AddDate(0, 0, 3),
+	})
+	require.NoError(t, err)
+
+	expected := []schedule.DayStatus{
+		schedule.DayStatusBlocked,
+		schedule.DayStatusBooked,
+		schedule.DayStatusFree,
+	}
+	assert.Equal(t, expected, actual.Days)
+}
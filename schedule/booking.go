@@ -0,0 +1,327 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+type BookingStatus uint8
+
+const (
+	BookingStatusConfirmed BookingStatus = iota + 1
+	BookingStatusCancelled
+	BookingStatusHeld
+	BookingStatusExpired
+)
+
+type Booking struct {
+	ID     LongID
+	Status BookingStatus
+	Guest  domain.AccessSubject
+
+	Slot TimeSlot
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Redeemer counts a redemption of a promo code by the booking within
+// the transaction of the booking.
+type Redeemer interface {
+	Redeem(context.Context, isql.ContextStatement, string, Booking) error
+}
+
+// Book takes the interval of the slot and records the booking of the guest.
+func (unit *Scheduler) Book(
+	ctx context.Context,
+	slot TimeSlot,
+	guest domain.AccessSubject,
+) (Booking, error) {
+	return unit.BookWithCode(ctx, slot, guest, "")
+}
+
+// BookWithCode books the slot and redeems the promo code, the booking
+// is not made if the code can't be redeemed.
+func (unit *Scheduler) BookWithCode(
+	ctx context.Context,
+	slot TimeSlot,
+	guest domain.AccessSubject,
+	code string,
+) (Booking, error) {
+	if code != "" && unit.redeemer == nil {
+		return Booking{}, fmt.Errorf("promo codes are not accepted, %w", ErrInvalidSlot)
+	}
+
+	slot, startAt, endAt, err := unit.interval(slot)
+	if err != nil {
+		return Booking{}, err
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return Booking{}, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	booking, err := unit.book(ctx, txw, slot, guest, startAt, endAt)
+	if err == nil && code != "" {
+		err = unit.redeemer.Redeem(ctx, txw, code, booking)
+	}
+
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return Booking{}, fmt.Errorf("failed to book a slot, %w", err)
+	}
+
+	unit.changed(booking.Slot)
+
+	return booking, nil
+}
+
+func (unit *Scheduler) book(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	guest domain.AccessSubject,
+	startAt uint32,
+	endAt uint32,
+) (Booking, error) {
+	if err := unit.take(ctx, txw, slot, startAt, endAt); err != nil {
+		return Booking{}, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	booking := Booking{
+		Status:    BookingStatusConfirmed,
+		Guest:     guest,
+		Slot:      slot,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	id, err := mysqldb.AddBooking(ctx, txw, booking2record(booking, startAt, endAt))
+	if err != nil {
+		return Booking{}, fmt.Errorf("failed to add a booking, %w", err)
+	}
+
+	booking.ID = LongID(id)
+
+	return booking, nil
+}
+
+// SlotError reports the slot of a batch that failed.
+type SlotError struct {
+	Index int
+	Slot  TimeSlot
+	Err   error
+}
+
+func (e *SlotError) Error() string {
+	return fmt.Sprintf("slot %d, %s", e.Index, e.Err)
+}
+
+func (e *SlotError) Unwrap() error {
+	return e.Err
+}
+
+// BookMany books all slots for the guest in a single transaction, so
+// either every slot is booked or none. The failed slot is reported
+// with SlotError.
+func (unit *Scheduler) BookMany(
+	ctx context.Context,
+	slots []TimeSlot,
+	guest domain.AccessSubject,
+) ([]Booking, error) {
+	if len(slots) == 0 {
+		return nil, fmt.Errorf("slots are required, %w", ErrInvalidSlot)
+	}
+
+	// Slots are resolved into a copy, the slice of the caller is kept.
+	slots = append([]TimeSlot(nil), slots...)
+	startAt := make([]uint32, len(slots))
+	endAt := make([]uint32, len(slots))
+
+	for idx, slot := range slots {
+		var err error
+
+		slots[idx], startAt[idx], endAt[idx], err = unit.interval(slot)
+		if err != nil {
+			return nil, &SlotError{Index: idx, Slot: slot, Err: err}
+		}
+	}
+
+	// Slots are locked in the same order by every batch to avoid deadlocks.
+	order := make([]int, len(slots))
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := slots[order[i]], slots[order[j]]
+		if a.NodeID != b.NodeID {
+			return string(a.NodeID[:]) < string(b.NodeID[:])
+		}
+
+		if a.LotID != b.LotID {
+			return a.LotID < b.LotID
+		}
+
+		return startAt[order[i]] < startAt[order[j]]
+	})
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	bookings := make([]Booking, len(slots))
+
+	for _, idx := range order {
+		booking, err := unit.book(
+			ctx,
+			txw,
+			slots[idx],
+			guest,
+			startAt[idx],
+			endAt[idx],
+		)
+		if err != nil {
+			txw.Error(&SlotError{Index: idx, Slot: slots[idx], Err: err})
+
+			break
+		}
+
+		bookings[idx] = booking
+	}
+
+	if err := txw.TransactionEnd(); err != nil {
+		return nil, fmt.Errorf("failed to book slots, %w", err)
+	}
+
+	for _, booking := range bookings {
+		unit.changed(booking.Slot)
+	}
+
+	return bookings, nil
+}
+
+// FindBooking returns the booking by its id.
+func (unit *Scheduler) FindBooking(ctx context.Context, id LongID) (Booking, error) {
+	rec, err := unit.connector.GetBooking(ctx, unit.connector.DB(), uint64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Booking{}, fmt.Errorf("failed to find a booking %d, %w", id, ErrNotFound)
+	}
+
+	if err != nil {
+		return Booking{}, fmt.Errorf("failed to get a booking, %w", err)
+	}
+
+	return unit.record2booking(*rec), nil
+}
+
+// Cancel returns the interval of the booking to the free pool.
+func (unit *Scheduler) Cancel(ctx context.Context, id LongID) error {
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	slot, err := unit.cancel(ctx, txw, id)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return fmt.Errorf("failed to cancel a booking, %w", err)
+	}
+
+	unit.changed(slot)
+
+	return nil
+}
+
+// cancel releases the booking and returns its slot.
+func (unit *Scheduler) cancel(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	id LongID,
+) (TimeSlot, error) {
+	rec, err := unit.connector.GetBookingForUpdate(ctx, txw, uint64(id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return TimeSlot{}, fmt.Errorf("failed to find a booking %d, %w", id, ErrNotFound)
+	}
+
+	if err != nil {
+		return TimeSlot{}, fmt.Errorf("failed to get a booking, %w", err)
+	}
+
+	if BookingStatus(rec.Status) != BookingStatusConfirmed {
+		return TimeSlot{}, fmt.Errorf("booking %d is not active, %w", id, ErrNotFound)
+	}
+
+	booking := unit.record2booking(*rec)
+	err = unit.release(ctx, txw, booking.Slot, rec.Slot.StartAt, rec.Slot.EndAt)
+	if err != nil {
+		return TimeSlot{}, err
+	}
+
+	rec.Status = uint8(BookingStatusCancelled)
+	rec.UpdatedAt = time.Now().Unix()
+
+	if err := mysqldb.UpdBookingStatus(ctx, txw, *rec); err != nil {
+		return TimeSlot{}, fmt.Errorf("failed to update a booking, %w", err)
+	}
+
+	return booking.Slot, nil
+}
+
+func booking2record(
+	booking Booking,
+	startAt uint32,
+	endAt uint32,
+) mysqldb.BookingRecord {
+	return mysqldb.BookingRecord{
+		ID:     uint64(booking.ID),
+		Status: uint8(booking.Status),
+		Guest:  uint64(booking.Guest),
+
+		Slot: slot2record(booking.Slot, startAt, endAt),
+
+		CreatedAt: booking.CreatedAt.Unix(),
+		UpdatedAt: booking.UpdatedAt.Unix(),
+	}
+}
+
+func (unit *Scheduler) record2booking(rec mysqldb.BookingRecord) Booking {
+	return Booking{
+		ID:     LongID(rec.ID),
+		Status: BookingStatus(rec.Status),
+		Guest:  domain.AccessSubject(rec.Guest),
+
+		Slot: unit.record2timeSlot(rec.Slot),
+
+		CreatedAt: time.Unix(rec.CreatedAt, 0),
+		UpdatedAt: time.Unix(rec.UpdatedAt, 0),
+	}
+}
@@ -0,0 +1,99 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_BookMany(t *testing.T) {
+	first := newTimeslot()
+	second := first
+	second.LotID++
+	third := first
+	third.LotID += 2
+
+	scheduler, now, close := newScheduler(t, first.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	for _, slot := range []schedule.TimeSlot{first, second, third} {
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+	}
+
+	for _, slot := range []*schedule.TimeSlot{&first, &second, &third} {
+		slot.StartAt = now.AddDate(0, 0, 1)
+		slot.EndAt = now.AddDate(0, 0, 3)
+	}
+
+	query := schedule.Query{
+		NodeID: first.NodeID,
+		Region: first.Region,
+		From:   first.StartAt,
+		To:     first.EndAt,
+	}
+
+	t.Run("all slots are booked", func(t *testing.T) {
+		guest := newGuest()
+
+		bookings, err := scheduler.BookMany(
+			ctx,
+			[]schedule.TimeSlot{second, first},
+			guest,
+		)
+		require.NoError(t, err)
+		require.Len(t, bookings, 2)
+
+		assert.Equal(t, second.LotID, bookings[0].Slot.LotID)
+		assert.Equal(t, first.LotID, bookings[1].Slot.LotID)
+		assert.Equal(t, guest, bookings[0].Guest)
+
+		found, err := scheduler.FindBooking(ctx, bookings[1].ID)
+		require.NoError(t, err)
+		assert.Equal(t, guest, found.Guest)
+		assert.Equal(t, first.LotID, found.Slot.LotID)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+		assert.Equal(t, third.LotID, slots[0].LotID)
+	})
+
+	t.Run("none of slots is booked on a conflict", func(t *testing.T) {
+		_, err := scheduler.BookMany(
+			ctx,
+			[]schedule.TimeSlot{third, first},
+			newGuest(),
+		)
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
+
+		var slotErr *schedule.SlotError
+		require.True(t, errors.As(err, &slotErr))
+		assert.Equal(t, 1, slotErr.Index)
+		assert.Equal(t, first.LotID, slotErr.Slot.LotID)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+		assert.Equal(t, third.LotID, slots[0].LotID)
+	})
+
+	t.Run("the same slot twice in a batch", func(t *testing.T) {
+		_, err := scheduler.BookMany(
+			ctx,
+			[]schedule.TimeSlot{third, third},
+			newGuest(),
+		)
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Len(t, slots, 1)
+	})
+}
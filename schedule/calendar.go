@@ -0,0 +1,205 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+type DayStatus uint8
+
+const (
+	DayStatusFree DayStatus = iota + 1
+	// DayStatusPartial is a day with both free and occupied hours,
+	// e.g. a day of check-in or check-out.
+	DayStatusPartial
+	DayStatusBooked
+	// DayStatusBlocked is a day the owner closed the lot for.
+	DayStatusBlocked
+	// DayStatusClosed is a day the availability rules of the lot close.
+	DayStatusClosed
+)
+
+const hoursInDay = 24
+
+type Calendar struct {
+	LotID LongID
+	From  time.Time
+	Days  []DayStatus
+}
+
+// Calendar returns the status of every day of the lot in the range
+// [query.From, query.To). Days are aligned to midnight in the location
+// of the first day, hours outside free intervals are occupied. A day
+// without free hours is blocked if blocks of the owner take all of its
+// hours the rules of the lot don't close, a day the rules close is
+// closed otherwise.
+func (unit *Scheduler) Calendar(ctx context.Context, query Query) (Calendar, error) {
+	if query.LotID == 0 {
+		return Calendar{}, fmt.Errorf("lot is required, %w", ErrInvalidSlot)
+	}
+
+	node, err := unit.node(query.NodeID, query.Region)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	query.NodeID = node
+
+	fromDay := unit.startOfDay(query.From)
+	toDay := unit.startOfDay(query.To)
+
+	if toDay.Before(query.To) {
+		toDay = toDay.AddDate(0, 0, 1)
+	}
+
+	from, err := unit.numberHoursAfterFirstDay(fromDay)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	to, err := unit.numberHoursAfterFirstDay(toDay)
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	if from >= to {
+		return Calendar{}, fmt.Errorf("from must be before to, %w", ErrInvalidSlot)
+	}
+
+	records, err := unit.connector.ListOverlapping(ctx, mysqldb.Query{
+		NodeID: mysqldb.CodeID(query.NodeID),
+		Region: mysqldb.CodeID(query.Region),
+		LotID:  uint64(query.LotID),
+		From:   from,
+		To:     to,
+	})
+	if err != nil {
+		return Calendar{}, fmt.Errorf("failed to get records, %w", err)
+	}
+
+	days := (to - from + hoursInDay - 1) / hoursInDay
+	freeHours := make([]uint32, days)
+
+	for _, rec := range records {
+		countHours(freeHours, from, to, rec.StartAt, rec.EndAt)
+	}
+
+	blocks, err := unit.connector.ListBlocks(
+		ctx,
+		unit.connector.DB(),
+		mysqldb.Query{
+			NodeID: mysqldb.CodeID(query.NodeID),
+			LotID:  uint64(query.LotID),
+			From:   from,
+			To:     to,
+		},
+		uint8(BlockStatusActive),
+	)
+	if err != nil {
+		return Calendar{}, fmt.Errorf("failed to get blocks, %w", err)
+	}
+
+	blockedHours := make([]uint32, days)
+
+	for _, rec := range blocks {
+		countHours(blockedHours, from, to, rec.Slot.StartAt, rec.Slot.EndAt)
+	}
+
+	closedHours := make([]uint32, days)
+
+	rec, rules, err := unit.lotRules(ctx, unit.connector.DB(), TimeSlot{
+		NodeID: query.NodeID,
+		LotID:  query.LotID,
+	})
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	if rec != nil {
+		closed, err := unit.closedSpans(rules, time.Unix(rec.UpdatedAt, 0))
+		if err != nil {
+			return Calendar{}, err
+		}
+
+		for _, cur := range closed {
+			countHours(closedHours, from, to, cur.startAt, cur.endAt)
+		}
+	}
+
+	result := Calendar{
+		LotID: query.LotID,
+		From:  fromDay,
+		Days:  make([]DayStatus, len(freeHours)),
+	}
+
+	for day, hours := range freeHours {
+		switch {
+		case hours == 0 && blockedHours[day] > 0 &&
+			blockedHours[day]+closedHours[day] >= hoursInDay:
+			result.Days[day] = DayStatusBlocked
+		case hours == 0 && closedHours[day] == hoursInDay:
+			result.Days[day] = DayStatusClosed
+		case hours == 0:
+			result.Days[day] = DayStatusBooked
+		case hours < hoursInDay:
+			result.Days[day] = DayStatusPartial
+		default:
+			result.Days[day] = DayStatusFree
+		}
+	}
+
+	return result, nil
+}
+
+// countHours adds hours of the interval clipped to [from, to) to
+// the days they fall on.
+func countHours(days []uint32, from, to, startAt, endAt uint32) {
+	if startAt < from {
+		startAt = from
+	}
+
+	if endAt > to {
+		endAt = to
+	}
+
+	for startAt < endAt {
+		day := (startAt - from) / hoursInDay
+
+		dayEnd := from + (day+1)*hoursInDay
+		if dayEnd > endAt {
+			dayEnd = endAt
+		}
+
+		days[day] += dayEnd - startAt
+		startAt = dayEnd
+	}
+}
+
+func (unit *Scheduler) startOfDay(point time.Time) time.Time {
+	point = point.In(unit.firstDay.Location())
+
+	return time.Date(
+		point.Year(),
+		point.Month(),
+		point.Day(),
+		0, 0, 0, 0,
+		point.Location(),
+	)
+}
@@ -0,0 +1,66 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Calendar(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	slot.StartAt = day.AddDate(0, 0, 1).Add(14 * time.Hour)
+	slot.EndAt = day.AddDate(0, 0, 3).Add(12 * time.Hour)
+
+	_, err = scheduler.Book(ctx, slot, newGuest())
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID: slot.NodeID,
+		Region: slot.Region,
+		LotID:  slot.LotID,
+		From:   day.Add(10 * time.Hour),
+		To:     day.AddDate(0, 0, 5),
+	}
+
+	actual, err := scheduler.Calendar(ctx, query)
+	require.NoError(t, err)
+
+	expected := schedule.Calendar{
+		LotID: slot.LotID,
+		From:  day,
+		Days: []schedule.DayStatus{
+			schedule.DayStatusFree,
+			schedule.DayStatusPartial,
+			schedule.DayStatusBooked,
+			schedule.DayStatusPartial,
+			schedule.DayStatusFree,
+		},
+	}
+	assert.Equal(t, expected, actual)
+
+	t.Run("unknown lot is occupied", func(t *testing.T) {
+		query.LotID++
+
+		actual, err := scheduler.Calendar(ctx, query)
+		require.NoError(t, err)
+
+		for _, status := range actual.Days {
+			assert.Equal(t, schedule.DayStatusBooked, status)
+		}
+	})
+}
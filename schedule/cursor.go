@@ -0,0 +1,121 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the key of the last slot of a page. Slots are ordered by
+// the key of the sort, lot, node and row of the node table, so the next
+// page costs the same whatever page it is.
+type cursor struct {
+	by     Sort
+	key    uint32
+	lotID  LongID
+	nodeID CodeID
+	id     LongID
+}
+
+func record2cursor(rec mysqldb.Record, by Sort) cursor {
+	return cursor{
+		by:     by,
+		key:    by.key(rec),
+		lotID:  LongID(rec.LotID),
+		nodeID: CodeID(rec.NodeID),
+		id:     LongID(rec.ID),
+	}
+}
+
+// String returns the opaque token of the cursor.
+func (c cursor) String() string {
+	val := fmt.Sprintf(
+		"%d.%d.%d.%s.%d",
+		c.by,
+		c.key,
+		c.lotID,
+		c.nodeID[:],
+		c.id,
+	)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(val))
+}
+
+func parseCursor(token string) (cursor, error) {
+	val, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, fmt.Errorf("failed to decode, %w", ErrInvalidCursor)
+	}
+
+	parts := strings.Split(string(val), ".")
+	if len(parts) != 5 || len(parts[3]) != len(CodeID{}) {
+		return cursor{}, fmt.Errorf("malformed token, %w", ErrInvalidCursor)
+	}
+
+	nums := make([]uint64, 0, 4)
+
+	for _, part := range []string{parts[0], parts[1], parts[2], parts[4]} {
+		num, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return cursor{}, fmt.Errorf("malformed token, %w", ErrInvalidCursor)
+		}
+
+		nums = append(nums, num)
+	}
+
+	if nums[0] > uint64(SortByTightest) || nums[1] > maxDay {
+		return cursor{}, fmt.Errorf("malformed token, %w", ErrInvalidCursor)
+	}
+
+	result := cursor{
+		by:    Sort(nums[0]),
+		key:   uint32(nums[1]),
+		lotID: LongID(nums[2]),
+		id:    LongID(nums[3]),
+	}
+	copy(result.nodeID[:], parts[3])
+
+	return result, nil
+}
+
+// after returns the key the node lists rows after. Rows of the lot
+// and the key of the cursor are already listed on the nodes before
+// the node of the cursor and not yet on the nodes after it.
+func (c cursor) after(node CodeID) *mysqldb.Cursor {
+	switch {
+	case node == c.nodeID:
+		return &mysqldb.Cursor{
+			Key:   c.key,
+			LotID: uint64(c.lotID),
+			ID:    uint64(c.id),
+		}
+	case nodeLess(node, c.nodeID):
+		return &mysqldb.Cursor{Key: c.key, LotID: uint64(c.lotID) + 1}
+	}
+
+	return &mysqldb.Cursor{Key: c.key, LotID: uint64(c.lotID)}
+}
+
+func nodeLess(a, b CodeID) bool {
+	return string(a[:]) < string(b[:])
+}
@@ -0,0 +1,140 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+// Level is a level of the geographic hierarchy within a region.
+type Level uint8
+
+const (
+	LevelArea Level = iota + 1
+	LevelLocality
+	LevelSublocality
+)
+
+var levelColumns = map[Level]string{
+	LevelArea:        "area",
+	LevelLocality:    "locality",
+	LevelSublocality: "sublocality",
+}
+
+// Facet is the number of lots available in the area, locality or
+// sublocality. IDs are unique within their parents only, so Area and
+// Locality are the parents of the facet, they are zero at its level
+// and below.
+type Facet struct {
+	ID       ID
+	Area     ID
+	Locality ID
+	Count    uint64
+}
+
+// Facets counts lots available for the range of the query grouped by
+// the level. Filters of the query narrow the counted lots. If the node
+// of the query isn't set, lots of all nodes of the region are counted.
+func (unit *Scheduler) Facets(
+	ctx context.Context,
+	query Query,
+	level Level,
+) ([]Facet, error) {
+	column, ok := levelColumns[level]
+	if !ok {
+		return nil, fmt.Errorf("unknown level %d, %w", level, ErrInvalidQuery)
+	}
+
+	from, err := unit.numberHoursAfterFirstDay(query.From)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := unit.numberHoursAfterFirstDay(query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	qry := mysqldb.Query{
+		From: from,
+		To:   to,
+
+		Region:      mysqldb.CodeID(query.Region),
+		Area:        uint16(query.Area),
+		Locality:    uint16(query.Locality),
+		Sublocality: uint16(query.Sublocality),
+	}
+
+	counts := make(map[Facet]uint64)
+	result := []Facet{}
+
+	// A lot is stored on one node only, so counts of nodes are summed.
+	for _, node := range unit.nodes(query.NodeID, query.Region) {
+		qry.NodeID = mysqldb.CodeID(node)
+
+		records, err := unit.connector.CountAvailable(ctx, qry, column)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count records, %w", err)
+		}
+
+		for _, rec := range records {
+			key := record2facet(rec, level)
+			if _, ok := counts[key]; !ok {
+				result = append(result, key)
+			}
+
+			counts[key] += rec.Count
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Area != b.Area {
+			return a.Area < b.Area
+		}
+
+		if a.Locality != b.Locality {
+			return a.Locality < b.Locality
+		}
+
+		return a.ID < b.ID
+	})
+
+	for idx := range result {
+		result[idx].Count = counts[result[idx]]
+	}
+
+	return result, nil
+}
+
+// record2facet returns the facet of the group without the count.
+func record2facet(rec mysqldb.Facet, level Level) Facet {
+	switch level {
+	case LevelLocality:
+		return Facet{ID: ID(rec.Locality), Area: ID(rec.Area)}
+	case LevelSublocality:
+		return Facet{
+			ID:       ID(rec.Sublocality),
+			Area:     ID(rec.Area),
+			Locality: ID(rec.Locality),
+		}
+	}
+
+	return Facet{ID: ID(rec.Area)}
+}
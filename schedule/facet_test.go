@@ -0,0 +1,107 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Facets(t *testing.T) {
+	first := newTimeslot()
+	first.Area = 1
+	first.Locality = 10
+
+	second := first
+	second.LotID++
+	second.Locality = 11
+
+	// IDs are unique within the parent, the third locality has the ID
+	// of the first one in another area.
+	third := first
+	third.LotID += 2
+	third.Area = 2
+	third.Locality = 10
+
+	scheduler, now, close := newScheduler(t, first.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	for _, slot := range []schedule.TimeSlot{first, second, third} {
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+	}
+
+	first.StartAt = now.AddDate(0, 0, 1)
+	first.EndAt = now.AddDate(0, 0, 3)
+
+	_, err := scheduler.Book(ctx, first, newGuest())
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID: first.NodeID,
+		Region: first.Region,
+		From:   first.StartAt,
+		To:     first.EndAt,
+	}
+
+	t.Run("booked lot is not counted", func(t *testing.T) {
+		actual, err := scheduler.Facets(ctx, query, schedule.LevelArea)
+		require.NoError(t, err)
+
+		expected := []schedule.Facet{{ID: 1, Count: 1}, {ID: 2, Count: 1}}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("lot is counted once", func(t *testing.T) {
+		query := query
+		query.From = now.AddDate(0, 0, 4)
+		query.To = now.AddDate(0, 0, 5)
+
+		actual, err := scheduler.Facets(ctx, query, schedule.LevelArea)
+		require.NoError(t, err)
+
+		expected := []schedule.Facet{{ID: 1, Count: 2}, {ID: 2, Count: 1}}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("localities within area", func(t *testing.T) {
+		query := query
+		query.Area = 1
+
+		actual, err := scheduler.Facets(ctx, query, schedule.LevelLocality)
+		require.NoError(t, err)
+
+		expected := []schedule.Facet{{ID: 11, Area: 1, Count: 1}}
+		assert.Equal(t, expected, actual)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+		assert.Equal(t, second.LotID, slots[0].LotID)
+	})
+
+	t.Run("localities of different areas", func(t *testing.T) {
+		query := query
+		query.From = now.AddDate(0, 0, 4)
+		query.To = now.AddDate(0, 0, 5)
+
+		actual, err := scheduler.Facets(ctx, query, schedule.LevelLocality)
+		require.NoError(t, err)
+
+		expected := []schedule.Facet{
+			{ID: 10, Area: 1, Count: 1},
+			{ID: 11, Area: 1, Count: 1},
+			{ID: 10, Area: 2, Count: 1},
+		}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("unknown level", func(t *testing.T) {
+		_, err := scheduler.Facets(ctx, query, 0)
+		assert.ErrorIs(t, err, schedule.ErrInvalidQuery)
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+// Alternative is the range of the query shifted by Shift days having
+// free intervals of Lots lots.
+type Alternative struct {
+	From  time.Time
+	To    time.Time
+	Shift int
+	Lots  int
+}
+
+// alternatives looks for ranges of the same length as [from, to) shifted
+// by up to flex days having free intervals. Ranges don't start before
+// today and are ordered by distance, an earlier range goes first.
+// Nodes failing to be counted are returned, their lots are missing
+// from the counts.
+func (unit *Scheduler) alternatives(
+	ctx context.Context,
+	nodes []CodeID,
+	qry mysqldb.Query,
+	flex int,
+) ([]Alternative, []CodeID, error) {
+	from, to := qry.From, qry.To
+
+	earliest, err := unit.numberHoursAfterFirstDay(unit.startOfDay(time.Now()))
+	if err != nil {
+		earliest = minDay
+	}
+
+	type nodeCounts struct {
+		counts map[int]int
+		err    error
+	}
+
+	pages := make([]nodeCounts, len(nodes))
+
+	var wg sync.WaitGroup
+
+	for idx, node := range nodes {
+		wg.Add(1)
+
+		go func(idx int, node CodeID) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, unit.nodeTimeout)
+			defer cancel()
+
+			qry := qry
+			qry.NodeID = mysqldb.CodeID(node)
+
+			pages[idx].counts, pages[idx].err = unit.countShifts(
+				ctx, qry, from, to, earliest, flex,
+			)
+		}(idx, node)
+	}
+
+	wg.Wait()
+
+	var (
+		counts  = map[int]int{}
+		failed  []CodeID
+		lastErr error
+	)
+
+	for idx, page := range pages {
+		if page.err != nil {
+			failed = append(failed, nodes[idx])
+			lastErr = page.err
+
+			continue
+		}
+
+		for shift, count := range page.counts {
+			counts[shift] += count
+		}
+	}
+
+	if len(nodes) > 0 && len(failed) == len(nodes) {
+		return nil, nil, fmt.Errorf("failed to count nodes, %w", lastErr)
+	}
+
+	result := make([]Alternative, 0, len(counts))
+
+	for shift, count := range counts {
+		offset := time.Duration(shift*hoursInDay) * time.Hour
+
+		result = append(result, Alternative{
+			From:  unit.timeAfterFirstDay(from).Add(offset),
+			To:    unit.timeAfterFirstDay(to).Add(offset),
+			Shift: shift,
+			Lots:  count,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := abs(result[i].Shift), abs(result[j].Shift)
+		if a != b {
+			return a < b
+		}
+
+		return result[i].Shift < result[j].Shift
+	})
+
+	return result, failed, nil
+}
+
+// countShifts counts lots of the node having free intervals enclosing
+// [from, to) shifted by every day up to flex days except the range
+// itself. Shifted ranges starting before the earliest hour are skipped.
+func (unit *Scheduler) countShifts(
+	ctx context.Context,
+	qry mysqldb.Query,
+	from uint32,
+	to uint32,
+	earliest uint32,
+	flex int,
+) (map[int]int, error) {
+	shifts := []int{}
+
+	for shift := -flex; shift <= flex; shift++ {
+		hours := shift * hoursInDay
+		if shift == 0 || int(from)+hours < int(earliest) ||
+			int(to)+hours > maxDay {
+			continue
+		}
+
+		shifts = append(shifts, hours)
+	}
+
+	counts, err := unit.connector.CountShifts(ctx, qry, shifts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count lots, %w", err)
+	}
+
+	result := make(map[int]int, len(counts))
+	for hours, count := range counts {
+		result[hours/hoursInDay] = int(count)
+	}
+
+	return result, nil
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+
+	return val
+}
@@ -0,0 +1,154 @@
+package schedule_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Search_flexible(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	first := now.Truncate(time.Hour)
+	day := func(num int) time.Time {
+		return first.AddDate(0, 0, num)
+	}
+
+	booked := slot
+	booked.StartAt = day(1)
+	booked.EndAt = day(5)
+
+	_, err = scheduler.Book(ctx, booked, newGuest())
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID:   slot.NodeID,
+		Region:   slot.Region,
+		From:     day(2),
+		To:       day(3),
+		FlexDays: 3,
+	}
+
+	t.Run("nearest ranges are offered", func(t *testing.T) {
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+		assert.Empty(t, result.Slots)
+
+		expected := []schedule.Alternative{
+			{From: day(0), To: day(1), Shift: -2, Lots: 1},
+			{From: day(5), To: day(6), Shift: 3, Lots: 1},
+		}
+		assert.Equal(t, expected, result.Alternatives)
+	})
+
+	t.Run("ranges are limited by the tolerance", func(t *testing.T) {
+		query := query
+		query.FlexDays = 1
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+		assert.Empty(t, result.Alternatives)
+	})
+
+	t.Run("nothing is offered if the range is free", func(t *testing.T) {
+		query := query
+		query.From = day(6)
+		query.To = day(7)
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+		assert.Len(t, result.Slots, 1)
+		assert.Empty(t, result.Alternatives)
+	})
+
+	t.Run("lots are counted per range", func(t *testing.T) {
+		other := slot
+		other.LotID++
+
+		err := scheduler.RegisterLot(ctx, other)
+		require.NoError(t, err)
+
+		other.StartAt = day(0)
+		other.EndAt = day(5)
+
+		_, err = scheduler.Book(ctx, other, newGuest())
+		require.NoError(t, err)
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		expected := []schedule.Alternative{
+			{From: day(0), To: day(1), Shift: -2, Lots: 1},
+			{From: day(5), To: day(6), Shift: 3, Lots: 2},
+		}
+		assert.Equal(t, expected, result.Alternatives)
+	})
+}
+
+func Test_Search_flexible_from_today(t *testing.T) {
+	slot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(slot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	// Hours are counted from days before today, they are free too.
+	scheduler := schedule.New(today.AddDate(0, 0, -10), mysqldb.New(curDB))
+	ctx := context.Background()
+
+	err = scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	booked := slot
+	booked.StartAt = today
+	booked.EndAt = today.AddDate(0, 0, 3)
+
+	_, err = scheduler.Book(ctx, booked, newGuest())
+	require.NoError(t, err)
+
+	result, err := scheduler.Search(ctx, schedule.Query{
+		NodeID:   slot.NodeID,
+		Region:   slot.Region,
+		From:     today.AddDate(0, 0, 1),
+		To:       today.AddDate(0, 0, 2),
+		FlexDays: 3,
+	})
+	require.NoError(t, err)
+
+	expected := []schedule.Alternative{
+		{From: today.AddDate(0, 0, 3), To: today.AddDate(0, 0, 4), Shift: 2, Lots: 1},
+		{From: today.AddDate(0, 0, 4), To: today.AddDate(0, 0, 5), Shift: 3, Lots: 1},
+	}
+	assert.Equal(t, expected, result.Alternatives)
+	assert.False(t, result.Partial)
+}
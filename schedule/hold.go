@@ -0,0 +1,361 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/findbed/app/domain"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+var ErrExpired = errors.New("hold is expired")
+
+const (
+	tokenLength    = 16
+	sweepBatchSize = 100
+)
+
+type Hold struct {
+	Token     string
+	BookingID LongID
+	Slot      TimeSlot
+	ExpiresAt time.Time
+}
+
+// Hold takes the interval of the slot like Book does, but it returns
+// to the free pool unless the hold is confirmed within the ttl.
+func (unit *Scheduler) Hold(
+	ctx context.Context,
+	slot TimeSlot,
+	ttl time.Duration,
+) (Hold, error) {
+	if ttl <= 0 {
+		return Hold{}, fmt.Errorf("ttl must be positive, %w", ErrInvalidSlot)
+	}
+
+	slot, startAt, endAt, err := unit.interval(slot)
+	if err != nil {
+		return Hold{}, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return Hold{}, err
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return Hold{}, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	hold, err := unit.hold(ctx, txw, slot, token, ttl, startAt, endAt)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return Hold{}, fmt.Errorf("failed to hold a slot, %w", err)
+	}
+
+	unit.changed(hold.Slot)
+
+	return hold, nil
+}
+
+func (unit *Scheduler) hold(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	token string,
+	ttl time.Duration,
+	startAt uint32,
+	endAt uint32,
+) (Hold, error) {
+	if err := unit.take(ctx, txw, slot, startAt, endAt); err != nil {
+		return Hold{}, err
+	}
+
+	now := time.Now().Truncate(time.Second)
+	hold := Hold{
+		Token:     token,
+		Slot:      slot,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	booking := Booking{
+		Status:    BookingStatusHeld,
+		Slot:      slot,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	rec := booking2record(booking, startAt, endAt)
+	rec.Token = token
+	rec.ExpiresAt = hold.ExpiresAt.Unix()
+
+	id, err := mysqldb.AddBooking(ctx, txw, rec)
+	if err != nil {
+		return Hold{}, fmt.Errorf("failed to add a hold, %w", err)
+	}
+
+	hold.BookingID = LongID(id)
+
+	return hold, nil
+}
+
+// Confirm turns the hold into a booking of the guest.
+func (unit *Scheduler) Confirm(
+	ctx context.Context,
+	token string,
+	guest domain.AccessSubject,
+) (Booking, error) {
+	if token == "" {
+		return Booking{}, fmt.Errorf("token is required, %w", ErrNotFound)
+	}
+
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return Booking{}, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	booking, err := unit.confirm(ctx, txw, token, guest)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return Booking{}, fmt.Errorf("failed to confirm a hold, %w", err)
+	}
+
+	return booking, nil
+}
+
+func (unit *Scheduler) confirm(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	token string,
+	guest domain.AccessSubject,
+) (Booking, error) {
+	rec, err := unit.connector.GetHoldForUpdate(ctx, txw, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Booking{}, fmt.Errorf("failed to find a hold, %w", ErrNotFound)
+	}
+
+	if err != nil {
+		return Booking{}, fmt.Errorf("failed to get a hold, %w", err)
+	}
+
+	now := time.Now()
+
+	switch {
+	case BookingStatus(rec.Status) == BookingStatusExpired,
+		BookingStatus(rec.Status) == BookingStatusHeld &&
+			rec.ExpiresAt <= now.Unix():
+		return Booking{}, fmt.Errorf("failed to confirm a hold, %w", ErrExpired)
+	case BookingStatus(rec.Status) != BookingStatusHeld:
+		return Booking{}, fmt.Errorf("hold is not active, %w", ErrNotFound)
+	}
+
+	rec.Status = uint8(BookingStatusConfirmed)
+	rec.Guest = uint64(guest)
+	rec.UpdatedAt = now.Unix()
+
+	if err := mysqldb.UpdBookingStatus(ctx, txw, *rec); err != nil {
+		return Booking{}, fmt.Errorf("failed to update a booking, %w", err)
+	}
+
+	return unit.record2booking(*rec), nil
+}
+
+// ReleaseError reports holds of the batch which failed to be released,
+// the other holds are released regardless.
+type ReleaseError struct {
+	Errs []error
+}
+
+func (e *ReleaseError) Error() string {
+	msgs := make([]string, len(e.Errs))
+	for idx, err := range e.Errs {
+		msgs[idx] = err.Error()
+	}
+
+	return fmt.Sprintf(
+		"failed to release %d holds, %s", len(e.Errs), strings.Join(msgs, "; "),
+	)
+}
+
+// Is reports whether any of the errors matches the target.
+func (e *ReleaseError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReleaseExpiredHolds returns intervals of holds expired by the time
+// to the free pool and reports how many holds were released. Holds are
+// listed in batches following the last listed one, so a hold failing
+// to be released doesn't stop the rest, failures are reported with
+// ReleaseError.
+func (unit *Scheduler) ReleaseExpiredHolds(
+	ctx context.Context,
+	now time.Time,
+) (int, error) {
+	released := 0
+	failed := &ReleaseError{}
+	after := mysqldb.ExpiredKey{}
+
+	for {
+		keys, err := unit.connector.ListExpired(
+			ctx,
+			uint8(BookingStatusHeld),
+			now.Unix(),
+			after,
+			sweepBatchSize,
+		)
+		if err != nil {
+			failed.Errs = append(
+				failed.Errs,
+				fmt.Errorf("failed to get expired holds, %w", err),
+			)
+
+			break
+		}
+
+		for _, key := range keys {
+			isReleased, err := unit.releaseHold(ctx, key.ID, now)
+			if err != nil {
+				failed.Errs = append(
+					failed.Errs,
+					fmt.Errorf("hold %d, %w", key.ID, err),
+				)
+
+				continue
+			}
+
+			if isReleased {
+				released++
+			}
+		}
+
+		if len(keys) < sweepBatchSize {
+			break
+		}
+
+		after = keys[len(keys)-1]
+	}
+
+	if len(failed.Errs) > 0 {
+		return released, failed
+	}
+
+	return released, nil
+}
+
+func (unit *Scheduler) releaseHold(
+	ctx context.Context,
+	id uint64,
+	now time.Time,
+) (bool, error) {
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	slot, isReleased, err := unit.expire(ctx, txw, id, now)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return false, fmt.Errorf("failed to release a hold, %w", err)
+	}
+
+	if isReleased {
+		unit.changed(slot)
+	}
+
+	return isReleased, nil
+}
+
+func (unit *Scheduler) expire(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	id uint64,
+	now time.Time,
+) (TimeSlot, bool, error) {
+	rec, err := unit.connector.GetBookingForUpdate(ctx, txw, id)
+	if err != nil {
+		return TimeSlot{}, false, fmt.Errorf("failed to get a hold, %w", err)
+	}
+
+	// The hold could be confirmed since it was listed.
+	if BookingStatus(rec.Status) != BookingStatusHeld ||
+		rec.ExpiresAt > now.Unix() {
+		return TimeSlot{}, false, nil
+	}
+
+	booking := unit.record2booking(*rec)
+	err = unit.release(ctx, txw, booking.Slot, rec.Slot.StartAt, rec.Slot.EndAt)
+	if err != nil {
+		return TimeSlot{}, false, err
+	}
+
+	rec.Status = uint8(BookingStatusExpired)
+	rec.UpdatedAt = now.Unix()
+
+	if err := mysqldb.UpdBookingStatus(ctx, txw, *rec); err != nil {
+		return TimeSlot{}, false, fmt.Errorf("failed to update a booking, %w", err)
+	}
+
+	return booking.Slot, true, nil
+}
+
+// RunSweeper releases expired holds every interval until the context
+// is done.
+func (unit *Scheduler) RunSweeper(
+	ctx context.Context,
+	interval time.Duration,
+	onError func(error),
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := unit.ReleaseExpiredHolds(ctx, time.Now()); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, tokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate a token, %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,162 @@
+package schedule_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Hold(t *testing.T) {
+	timeslot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, timeslot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, timeslot)
+	require.NoError(t, err)
+
+	timeslot.StartAt = now.AddDate(0, 0, 1)
+	timeslot.EndAt = now.AddDate(0, 0, 3)
+
+	query := schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		From:   timeslot.StartAt,
+		To:     timeslot.EndAt,
+	}
+
+	t.Run("held slot is confirmed", func(t *testing.T) {
+		hold, err := scheduler.Hold(ctx, timeslot, 10*time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, hold.Token)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Len(t, slots, 0)
+
+		guest := newGuest()
+		booking, err := scheduler.Confirm(ctx, hold.Token, guest)
+		require.NoError(t, err)
+		assert.Equal(t, hold.BookingID, booking.ID)
+		assert.Equal(t, schedule.BookingStatusConfirmed, booking.Status)
+		assert.Equal(t, guest, booking.Guest)
+
+		_, err = scheduler.Confirm(ctx, hold.Token, guest)
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
+
+		released, err := scheduler.ReleaseExpiredHolds(ctx, now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, released)
+
+		err = scheduler.Cancel(ctx, booking.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("expired hold returns to the free pool", func(t *testing.T) {
+		hold, err := scheduler.Hold(ctx, timeslot, 10*time.Minute)
+		require.NoError(t, err)
+
+		_, err = scheduler.Hold(ctx, timeslot, 10*time.Minute)
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
+
+		released, err := scheduler.ReleaseExpiredHolds(ctx, now)
+		require.NoError(t, err)
+		assert.Equal(t, 0, released)
+
+		released, err = scheduler.ReleaseExpiredHolds(ctx, now.Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, released)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Len(t, slots, 1)
+
+		_, err = scheduler.Confirm(ctx, hold.Token, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrExpired)
+	})
+
+	t.Run("unable to confirm an unknown hold", func(t *testing.T) {
+		_, err := scheduler.Confirm(ctx, "unknown", newGuest())
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
+
+		_, err = scheduler.Confirm(ctx, "", newGuest())
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
+	})
+}
+
+func Test_ReleaseExpiredHolds_failed_hold(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, closeDB, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer closeDB()
+
+	now := time.Now()
+	scheduler := schedule.New(now, mysqldb.New(curDB))
+	ctx := context.Background()
+
+	err = scheduler.RegisterLot(ctx, timeslot)
+	require.NoError(t, err)
+
+	// Holds of a node without a table expire first and can't be
+	// released, there are more of them than a batch.
+	for idx := 0; idx < 101; idx++ {
+		_, err = mysqldb.AddBooking(ctx, curDB, mysqldb.BookingRecord{
+			Status: uint8(schedule.BookingStatusHeld),
+			Slot: mysqldb.Record{
+				NodeID: mysqldb.CodeID{'z', 'z'},
+				Region: mysqldb.CodeID{'z', 'z'},
+				LotID:  1,
+				EndAt:  24,
+			},
+			Token:     fmt.Sprintf("broken-%d", idx),
+			ExpiresAt: now.Unix(),
+		})
+		require.NoError(t, err)
+	}
+
+	timeslot.StartAt = now.AddDate(0, 0, 1)
+	timeslot.EndAt = now.AddDate(0, 0, 3)
+
+	_, err = scheduler.Hold(ctx, timeslot, 10*time.Minute)
+	require.NoError(t, err)
+
+	released, err := scheduler.ReleaseExpiredHolds(ctx, now.Add(time.Hour))
+	assert.Equal(t, 1, released)
+
+	var releaseErr *schedule.ReleaseError
+	require.ErrorAs(t, err, &releaseErr)
+	assert.Len(t, releaseErr.Errs, 101)
+	assert.ErrorIs(t, err, releaseErr.Errs[0])
+
+	slots, err := search(ctx, scheduler, schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		From:   timeslot.StartAt,
+		To:     timeslot.EndAt,
+	})
+	require.NoError(t, err)
+	assert.Len(t, slots, 1)
+}
@@ -0,0 +1,320 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+type IssueKind uint8
+
+const (
+	// IssueOverlap is a free interval starting before the previous one ends.
+	IssueOverlap IssueKind = iota + 1
+	// IssueInverted is a free interval ending before it starts.
+	IssueInverted
+	// IssueEmpty is a free interval of zero length.
+	IssueEmpty
+	// IssueUnmerged is a free interval starting where the previous one ends.
+	IssueUnmerged
+	// IssueTaken is a free interval overlapping an active booking, hold
+	// or block of the lot.
+	IssueTaken
+)
+
+func (kind IssueKind) String() string {
+	switch kind {
+	case IssueOverlap:
+		return "overlap"
+	case IssueInverted:
+		return "inverted"
+	case IssueEmpty:
+		return "empty"
+	case IssueUnmerged:
+		return "unmerged"
+	case IssueTaken:
+		return "taken"
+	}
+
+	return "unknown"
+}
+
+// Issue is a defect of free intervals of the lot. IDs are rows of
+// the timeslot table it is found in, StartAt and EndAt are the range
+// they cover.
+type Issue struct {
+	Kind  IssueKind
+	LotID LongID
+	IDs   []LongID
+
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// IntegrityReport is the result of the check of the node table.
+// Fixed is the number of lots whose free intervals were rewritten.
+type IntegrityReport struct {
+	NodeID CodeID
+	Lots   int
+	Fixed  int
+	Issues []Issue
+}
+
+// CheckIntegrity scans free intervals of every lot of the node and
+// reports overlapping, inverted, empty and unmerged ones and ones taken
+// by bookings, holds or blocks. Rows are read without locks.
+func (unit *Scheduler) CheckIntegrity(
+	ctx context.Context,
+	node CodeID,
+) (IntegrityReport, error) {
+	return unit.checkIntegrity(ctx, node, unit.checkLot)
+}
+
+// RepairIntegrity is like CheckIntegrity but also rewrites free intervals
+// of every lot having issues as merged ones. Inverted and empty intervals
+// are dropped, taken hours are cut out. Each lot is locked and rewritten
+// in its own transaction.
+func (unit *Scheduler) RepairIntegrity(
+	ctx context.Context,
+	node CodeID,
+) (IntegrityReport, error) {
+	return unit.checkIntegrity(ctx, node, unit.repairLot)
+}
+
+type lotChecker func(context.Context, CodeID, uint64) ([]Issue, bool, error)
+
+func (unit *Scheduler) checkIntegrity(
+	ctx context.Context,
+	node CodeID,
+	check lotChecker,
+) (IntegrityReport, error) {
+	report := IntegrityReport{NodeID: node, Issues: []Issue{}}
+
+	lots, err := unit.connector.ListLots(ctx, mysqldb.CodeID(node))
+	if err != nil {
+		return report, fmt.Errorf("failed to get lots, %w", err)
+	}
+
+	for _, lotID := range lots {
+		issues, fixed, err := check(ctx, node, lotID)
+		if err != nil {
+			return report, fmt.Errorf("failed to check lot %d, %w", lotID, err)
+		}
+
+		report.Lots++
+		report.Issues = append(report.Issues, issues...)
+
+		if fixed {
+			report.Fixed++
+		}
+	}
+
+	return report, nil
+}
+
+func (unit *Scheduler) checkLot(
+	ctx context.Context,
+	node CodeID,
+	lotID uint64,
+) ([]Issue, bool, error) {
+	query := mysqldb.Query{
+		NodeID: mysqldb.CodeID(node),
+		LotID:  lotID,
+	}
+
+	records, err := unit.connector.ListLot(ctx, query)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get slots, %w", err)
+	}
+
+	slot := TimeSlot{NodeID: node, LotID: LongID(lotID)}
+
+	taken, err := unit.takenSpans(ctx, unit.connector.DB(), slot, minDay, maxDay)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return unit.inspect(records, taken), false, nil
+}
+
+func (unit *Scheduler) repairLot(
+	ctx context.Context,
+	node CodeID,
+	lotID uint64,
+) ([]Issue, bool, error) {
+	txw, err := unit.connector.Transaction(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to make tx, %w", err)
+	}
+
+	issues, slot, err := unit.fixLot(ctx, txw, node, lotID)
+	txw.Error(err)
+
+	if err := txw.TransactionEnd(); err != nil {
+		return nil, false, err
+	}
+
+	if len(issues) == 0 {
+		return issues, false, nil
+	}
+
+	unit.changed(slot)
+
+	return issues, true, nil
+}
+
+// fixLot rewrites free intervals of the lot having issues and returns
+// the issues and the slot of the lot.
+func (unit *Scheduler) fixLot(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	node CodeID,
+	lotID uint64,
+) ([]Issue, TimeSlot, error) {
+	query := mysqldb.Query{
+		NodeID: mysqldb.CodeID(node),
+		LotID:  lotID,
+	}
+
+	records, err := unit.connector.ListLotForUpdate(ctx, txw, query)
+	if err != nil {
+		return nil, TimeSlot{}, fmt.Errorf("failed to get slots, %w", err)
+	}
+
+	taken, err := unit.takenSpans(
+		ctx,
+		txw,
+		TimeSlot{NodeID: node, LotID: LongID(lotID)},
+		minDay,
+		maxDay,
+	)
+	if err != nil {
+		return nil, TimeSlot{}, err
+	}
+
+	issues := unit.inspect(records, taken)
+	if len(issues) == 0 {
+		return issues, TimeSlot{}, nil
+	}
+
+	spans := make([]span, 0, len(records))
+	for _, rec := range records {
+		spans = append(spans, span{startAt: rec.StartAt, endAt: rec.EndAt})
+	}
+
+	for _, rec := range records {
+		if err := mysqldb.Remove(ctx, txw, rec); err != nil {
+			return nil, TimeSlot{}, fmt.Errorf("failed to remove a slot, %w", err)
+		}
+	}
+
+	// Lot attributes are the same in every row, the first one is used.
+	slot := unit.record2timeSlot(records[0])
+
+	for _, cur := range subtractSpans(mergeSpans(spans), taken) {
+		rec := slot2record(slot, cur.startAt, cur.endAt)
+		if err := mysqldb.Add(ctx, txw, rec); err != nil {
+			return nil, TimeSlot{}, fmt.Errorf("failed to add a slot, %w", err)
+		}
+	}
+
+	return issues, slot, nil
+}
+
+// inspect finds issues in free intervals of the lot ordered by start
+// and the hours of them the taken spans overlap.
+func (unit *Scheduler) inspect(records []mysqldb.Record, taken []span) []Issue {
+	issues := []Issue{}
+
+	newIssue := func(kind IssueKind, recs ...mysqldb.Record) Issue {
+		endAt := recs[0].EndAt
+		ids := make([]LongID, len(recs))
+
+		for idx, rec := range recs {
+			ids[idx] = LongID(rec.ID)
+
+			if rec.EndAt > endAt {
+				endAt = rec.EndAt
+			}
+		}
+
+		return Issue{
+			Kind:    kind,
+			LotID:   LongID(recs[0].LotID),
+			IDs:     ids,
+			StartAt: unit.timeAfterFirstDay(recs[0].StartAt),
+			EndAt:   unit.timeAfterFirstDay(endAt),
+		}
+	}
+
+	// Ledgers of a broken lot may overlap too, spans are joined to report
+	// an hour once.
+	taken = mergeSpans(taken)
+
+	// prev is the interval reaching the furthest so far.
+	var prev *mysqldb.Record
+
+	for idx := range records {
+		cur := records[idx]
+
+		switch {
+		case cur.StartAt > cur.EndAt:
+			issues = append(issues, newIssue(IssueInverted, cur))
+
+			continue
+		case cur.StartAt == cur.EndAt:
+			issues = append(issues, newIssue(IssueEmpty, cur))
+
+			continue
+		}
+
+		if prev != nil {
+			switch {
+			case cur.StartAt < prev.EndAt:
+				issues = append(issues, newIssue(IssueOverlap, *prev, cur))
+			case cur.StartAt == prev.EndAt:
+				issues = append(issues, newIssue(IssueUnmerged, *prev, cur))
+			}
+		}
+
+		if prev == nil || cur.EndAt > prev.EndAt {
+			prev = &records[idx]
+		}
+
+		for _, cut := range taken {
+			if cut.endAt <= cur.StartAt || cut.startAt >= cur.EndAt {
+				continue
+			}
+
+			issue := newIssue(IssueTaken, cur)
+			if cut.startAt > cur.StartAt {
+				issue.StartAt = unit.timeAfterFirstDay(cut.startAt)
+			}
+
+			if cut.endAt < cur.EndAt {
+				issue.EndAt = unit.timeAfterFirstDay(cut.endAt)
+			}
+
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,139 @@
+package schedule_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_CheckIntegrity(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	now := time.Now().Truncate(time.Hour)
+	scheduler := schedule.New(now, mysqldb.New(curDB))
+	ctx := context.Background()
+
+	spans := [][2]uint32{
+		{0, 10},
+		{10, 20},
+		{15, 25},
+		{30, 30},
+		{50, 40},
+		{60, 70},
+	}
+
+	for _, cur := range spans {
+		err := mysqldb.Add(ctx, curDB, mysqldb.Record{
+			NodeID:    mysqldb.CodeID(timeslot.NodeID),
+			Region:    mysqldb.CodeID(timeslot.Region),
+			HousingID: uint64(timeslot.HousingID),
+			LotID:     uint64(timeslot.LotID),
+			StartAt:   cur[0],
+			EndAt:     cur[1],
+		})
+		require.NoError(t, err)
+	}
+
+	// The booking is missing from free intervals, e.g. after a failed
+	// manual edit.
+	_, err = mysqldb.AddBooking(ctx, curDB, mysqldb.BookingRecord{
+		Status: uint8(schedule.BookingStatusConfirmed),
+		Guest:  1,
+		Slot: mysqldb.Record{
+			NodeID:    mysqldb.CodeID(timeslot.NodeID),
+			Region:    mysqldb.CodeID(timeslot.Region),
+			HousingID: uint64(timeslot.HousingID),
+			LotID:     uint64(timeslot.LotID),
+			StartAt:   62,
+			EndAt:     65,
+		},
+	})
+	require.NoError(t, err)
+
+	hour := func(num int) time.Time {
+		return now.Add(time.Duration(num) * time.Hour)
+	}
+
+	query := schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		From:   hour(5),
+		To:     hour(22),
+	}
+
+	t.Run("issues are reported", func(t *testing.T) {
+		report, err := scheduler.CheckIntegrity(ctx, timeslot.NodeID)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, report.Lots)
+		assert.Equal(t, 0, report.Fixed)
+
+		kinds := []schedule.IssueKind{}
+		for _, issue := range report.Issues {
+			kinds = append(kinds, issue.Kind)
+		}
+
+		expected := []schedule.IssueKind{
+			schedule.IssueUnmerged,
+			schedule.IssueOverlap,
+			schedule.IssueEmpty,
+			schedule.IssueInverted,
+			schedule.IssueTaken,
+		}
+		assert.Equal(t, expected, kinds)
+
+		assert.Equal(t, []schedule.LongID{2, 3}, report.Issues[1].IDs)
+		assert.Equal(t, hour(10), report.Issues[1].StartAt)
+		assert.Equal(t, hour(25), report.Issues[1].EndAt)
+
+		assert.Equal(t, []schedule.LongID{6}, report.Issues[4].IDs)
+		assert.Equal(t, hour(62), report.Issues[4].StartAt)
+		assert.Equal(t, hour(65), report.Issues[4].EndAt)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		assert.Empty(t, slots)
+	})
+
+	t.Run("issues are fixed", func(t *testing.T) {
+		report, err := scheduler.RepairIntegrity(ctx, timeslot.NodeID)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, report.Fixed)
+		assert.Len(t, report.Issues, 5)
+
+		slots, err := search(ctx, scheduler, query)
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+		assert.Equal(t, hour(0), slots[0].StartAt)
+		assert.Equal(t, hour(25), slots[0].EndAt)
+		assert.Equal(t, timeslot.LotID, slots[0].LotID)
+
+		report, err = scheduler.CheckIntegrity(ctx, timeslot.NodeID)
+		require.NoError(t, err)
+		assert.Empty(t, report.Issues)
+	})
+}
@@ -0,0 +1,172 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+)
+
+// RulesRecord is the availability rules of the lot. StartAt and EndAt
+// of the slot aren't used, UpdatedAt is when the rules were
+// materialised last.
+type RulesRecord struct {
+	Slot      Record
+	Rules     string
+	UpdatedAt int64
+}
+
+// SetRules replaces the rules of the lot.
+func SetRules(ctx context.Context, stmt isql.ContextStatement, rec RulesRecord) error {
+	query, args, err := squirrel.Delete("availability_rules").
+		Where(squirrel.Eq{
+			"node":   string(rec.Slot.NodeID[:]),
+			"lot_id": rec.Slot.LotID,
+		}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete a record, %w", err)
+	}
+
+	query = `insert into availability_rules(
+		node,
+		region,
+		area,
+		locality,
+		sublocality,
+		housing_id,
+		lot_id,
+		rules,
+		updated_at)values(?,?,?,?,?,?,?,?,?)`
+
+	_, err = stmt.ExecContext(
+		ctx,
+		query,
+		string(rec.Slot.NodeID[:]),
+		string(rec.Slot.Region[:]),
+		rec.Slot.Area,
+		rec.Slot.Locality,
+		rec.Slot.Sublocality,
+		rec.Slot.HousingID,
+		rec.Slot.LotID,
+		rec.Rules,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert, %w", err)
+	}
+
+	return nil
+}
+
+// GetRules returns the rules of the lot without the slot, sql.ErrNoRows
+// is returned for a lot without rules.
+func GetRules(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	node CodeID,
+	lotID uint64,
+) (*RulesRecord, error) {
+	query, args, err := squirrel.Select("rules", "updated_at").
+		From("availability_rules").
+		Where(squirrel.Eq{"node": string(node[:]), "lot_id": lotID}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	var rec RulesRecord
+
+	err = stmt.QueryRowContext(ctx, query, args...).Scan(&rec.Rules, &rec.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	return &rec, nil
+}
+
+// ListRules returns the rules of all lots of the node.
+func (conn *Connector) ListRules(
+	ctx context.Context,
+	node CodeID,
+) ([]RulesRecord, error) {
+	query, args, err := squirrel.Select(
+		"region",
+		"area",
+		"locality",
+		"sublocality",
+		"housing_id",
+		"lot_id",
+		"rules",
+		"updated_at").
+		From("availability_rules").
+		Where(squirrel.Eq{"node": string(node[:])}).
+		OrderBy("lot_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []RulesRecord{}
+	for rows.Next() {
+		var (
+			rec    RulesRecord
+			region string
+		)
+
+		err := rows.Scan(
+			&region,
+			&rec.Slot.Area,
+			&rec.Slot.Locality,
+			&rec.Slot.Sublocality,
+			&rec.Slot.HousingID,
+			&rec.Slot.LotID,
+			&rec.Rules,
+			&rec.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		copy(rec.Slot.Region[:], region)
+		rec.Slot.NodeID = node
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,264 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+)
+
+type BlockRecord struct {
+	ID     uint64
+	Status uint8
+	Author uint64
+	Reason string
+
+	Slot Record
+
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+func AddBlock(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	rec BlockRecord,
+) (uint64, error) {
+	query := `insert into blocks(
+		node,
+		region,
+		area,
+		locality,
+		sublocality,
+		housing_id,
+		lot_id,
+		start_at,
+		end_at,
+		author,
+		reason,
+		status,
+		created_at,
+		updated_at)values(?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := stmt.ExecContext(
+		ctx,
+		query,
+		string(rec.Slot.NodeID[:]),
+		string(rec.Slot.Region[:]),
+		rec.Slot.Area,
+		rec.Slot.Locality,
+		rec.Slot.Sublocality,
+		rec.Slot.HousingID,
+		rec.Slot.LotID,
+		rec.Slot.StartAt,
+		rec.Slot.EndAt,
+		rec.Author,
+		rec.Reason,
+		rec.Status,
+		rec.CreatedAt,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert, %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get an id, %w", err)
+	}
+
+	return uint64(id), nil
+}
+
+func UpdBlockStatus(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	rec BlockRecord,
+) error {
+	query, args, err := squirrel.Update("blocks").
+		Set("status", rec.Status).
+		Set("updated_at", rec.UpdatedAt).
+		Where(squirrel.Eq{"id": rec.ID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	res, err := stmt.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update a record, %w", err)
+	}
+
+	if num, err := res.RowsAffected(); num != 1 || err != nil {
+		return fmt.Errorf("failed to affect row, %w", err)
+	}
+
+	return nil
+}
+
+func blockBuilder() squirrel.SelectBuilder {
+	return squirrel.Select(
+		"id",
+		"node",
+		"region",
+		"area",
+		"locality",
+		"sublocality",
+		"housing_id",
+		"lot_id",
+		"start_at",
+		"end_at",
+		"author",
+		"reason",
+		"status",
+		"created_at",
+		"updated_at").
+		From("blocks")
+}
+
+// GetBlock returns the block without locking it.
+func (conn *Connector) GetBlock(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	id uint64,
+) (*BlockRecord, error) {
+	return conn.getBlock(ctx, stmt, id, false)
+}
+
+// GetBlockForUpdate returns the block and locks it until
+// the transaction ends.
+func (conn *Connector) GetBlockForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	id uint64,
+) (*BlockRecord, error) {
+	return conn.getBlock(ctx, stmt, id, true)
+}
+
+func (conn *Connector) getBlock(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	id uint64,
+	lock bool,
+) (*BlockRecord, error) {
+	builder := blockBuilder().Where(squirrel.Eq{"id": id})
+
+	if lock && conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rec, err := scanBlock(stmt.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+// ListBlocks returns blocks of the lot in the status that overlap
+// the range [From, To) ordered by start.
+func (conn *Connector) ListBlocks(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+	status uint8,
+) ([]BlockRecord, error) {
+	query, args, err := blockBuilder().
+		Where(squirrel.Eq{
+			"node":   string(qry.NodeID[:]),
+			"lot_id": qry.LotID,
+			"status": status,
+		}).
+		Where(squirrel.Lt{"start_at": qry.To}).
+		Where(squirrel.Gt{"end_at": qry.From}).
+		OrderBy("start_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []BlockRecord{}
+	for rows.Next() {
+		rec, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBlock(row scanner) (BlockRecord, error) {
+	var (
+		rec    BlockRecord
+		node   string
+		region string
+	)
+
+	err := row.Scan(
+		&rec.ID,
+		&node,
+		&region,
+		&rec.Slot.Area,
+		&rec.Slot.Locality,
+		&rec.Slot.Sublocality,
+		&rec.Slot.HousingID,
+		&rec.Slot.LotID,
+		&rec.Slot.StartAt,
+		&rec.Slot.EndAt,
+		&rec.Author,
+		&rec.Reason,
+		&rec.Status,
+		&rec.CreatedAt,
+		&rec.UpdatedAt,
+	)
+	if err != nil {
+		return rec, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	copy(rec.Slot.NodeID[:], node)
+	copy(rec.Slot.Region[:], region)
+
+	return rec, nil
+}
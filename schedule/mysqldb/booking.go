@@ -0,0 +1,338 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+)
+
+type BookingRecord struct {
+	ID     uint64
+	Status uint8
+	Guest  uint64
+
+	Slot Record
+
+	// Token and ExpiresAt are set for a hold only.
+	Token     string
+	ExpiresAt int64
+
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+func AddBooking(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	rec BookingRecord,
+) (uint64, error) {
+	query := `insert into bookings(
+		node,
+		region,
+		area,
+		locality,
+		sublocality,
+		housing_id,
+		lot_id,
+		start_at,
+		end_at,
+		guest,
+		status,
+		token,
+		expires_at,
+		created_at,
+		updated_at)values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := stmt.ExecContext(
+		ctx,
+		query,
+		string(rec.Slot.NodeID[:]),
+		string(rec.Slot.Region[:]),
+		rec.Slot.Area,
+		rec.Slot.Locality,
+		rec.Slot.Sublocality,
+		rec.Slot.HousingID,
+		rec.Slot.LotID,
+		rec.Slot.StartAt,
+		rec.Slot.EndAt,
+		rec.Guest,
+		rec.Status,
+		rec.Token,
+		rec.ExpiresAt,
+		rec.CreatedAt,
+		rec.UpdatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert, %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get an id, %w", err)
+	}
+
+	return uint64(id), nil
+}
+
+// UpdBookingStatus sets the status and the guest if it isn't zero.
+func UpdBookingStatus(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	rec BookingRecord,
+) error {
+	builder := squirrel.Update("bookings").
+		Set("status", rec.Status).
+		Set("updated_at", rec.UpdatedAt)
+
+	if rec.Guest > 0 {
+		builder = builder.Set("guest", rec.Guest)
+	}
+
+	query, args, err := builder.Where(squirrel.Eq{"id": rec.ID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	res, err := stmt.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update a record, %w", err)
+	}
+
+	if num, err := res.RowsAffected(); num != 1 || err != nil {
+		return fmt.Errorf("failed to affect row, %w", err)
+	}
+
+	return nil
+}
+
+// GetBooking returns the booking without locking it.
+func (conn *Connector) GetBooking(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	id uint64,
+) (*BookingRecord, error) {
+	return conn.getBooking(ctx, stmt, squirrel.Eq{"id": id}, false)
+}
+
+// GetBookingForUpdate returns the booking and locks it until
+// the transaction ends.
+func (conn *Connector) GetBookingForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	id uint64,
+) (*BookingRecord, error) {
+	return conn.getBooking(ctx, stmt, squirrel.Eq{"id": id}, true)
+}
+
+// GetHoldForUpdate is like GetBookingForUpdate but looks for the token
+// of a hold.
+func (conn *Connector) GetHoldForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	token string,
+) (*BookingRecord, error) {
+	return conn.getBooking(ctx, stmt, squirrel.Eq{"token": token}, true)
+}
+
+func (conn *Connector) getBooking(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	where squirrel.Eq,
+	lock bool,
+) (*BookingRecord, error) {
+	builder := squirrel.Select(
+		"id",
+		"node",
+		"region",
+		"area",
+		"locality",
+		"sublocality",
+		"housing_id",
+		"lot_id",
+		"start_at",
+		"end_at",
+		"guest",
+		"status",
+		"token",
+		"expires_at",
+		"created_at",
+		"updated_at").
+		From("bookings").
+		Where(where)
+
+	if lock && conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	var (
+		rec    BookingRecord
+		node   string
+		region string
+	)
+
+	err = stmt.QueryRowContext(ctx, query, args...).Scan(
+		&rec.ID,
+		&node,
+		&region,
+		&rec.Slot.Area,
+		&rec.Slot.Locality,
+		&rec.Slot.Sublocality,
+		&rec.Slot.HousingID,
+		&rec.Slot.LotID,
+		&rec.Slot.StartAt,
+		&rec.Slot.EndAt,
+		&rec.Guest,
+		&rec.Status,
+		&rec.Token,
+		&rec.ExpiresAt,
+		&rec.CreatedAt,
+		&rec.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan, %w", err)
+	}
+
+	copy(rec.Slot.NodeID[:], node)
+	copy(rec.Slot.Region[:], region)
+
+	return &rec, nil
+}
+
+// ExpiredKey is the position of a booking in the order of expiry.
+type ExpiredKey struct {
+	ExpiresAt int64
+	ID        uint64
+}
+
+// ListExpired returns keys of bookings in the status which expired
+// before the time, ordered by expiry and following the key.
+func (conn *Connector) ListExpired(
+	ctx context.Context,
+	status uint8,
+	before int64,
+	after ExpiredKey,
+	limit uint64,
+) ([]ExpiredKey, error) {
+	query, args, err := squirrel.Select("expires_at", "id").
+		From("bookings").
+		Where(squirrel.Eq{"status": status}).
+		Where(squirrel.LtOrEq{"expires_at": before}).
+		Where(squirrel.Or{
+			squirrel.Gt{"expires_at": after.ExpiresAt},
+			squirrel.And{
+				squirrel.Eq{"expires_at": after.ExpiresAt},
+				squirrel.Gt{"id": after.ID},
+			},
+		}).
+		OrderBy("expires_at", "id").
+		Limit(limit).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []ExpiredKey{}
+	for rows.Next() {
+		var key ExpiredKey
+		if err := rows.Scan(&key.ExpiresAt, &key.ID); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
+
+// ListBookedIntervals returns intervals of bookings of the lot in
+// the statuses that overlap the range [From, To).
+func ListBookedIntervals(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+	statuses []uint8,
+) ([]Record, error) {
+	// []uint8 is bound as a single blob, the list needs to be converted.
+	in := make([]interface{}, len(statuses))
+	for idx, status := range statuses {
+		in[idx] = status
+	}
+
+	query, args, err := squirrel.Select("start_at", "end_at").
+		From("bookings").
+		Where(squirrel.Eq{
+			"node":   string(qry.NodeID[:]),
+			"lot_id": qry.LotID,
+			"status": in,
+		}).
+		Where(squirrel.Lt{"start_at": qry.To}).
+		Where(squirrel.Gt{"end_at": qry.From}).
+		OrderBy("start_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []Record{}
+	for rows.Next() {
+		rec := Record{NodeID: qry.NodeID, LotID: qry.LotID}
+		if err := rows.Scan(&rec.StartAt, &rec.EndAt); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, rec)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
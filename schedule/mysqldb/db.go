@@ -17,10 +17,13 @@ package mysqldb
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/findbed/app/isql"
 	"github.com/findbed/app/txwrapper"
+	"github.com/go-sql-driver/mysql"
 )
 
 type Connector struct {
@@ -44,8 +47,8 @@ type Record struct {
 	Locality    uint16
 	Sublocality uint16
 
-	StartAt uint16
-	EndAt   uint16
+	StartAt uint32
+	EndAt   uint32
 }
 
 type Query struct {
@@ -54,6 +57,8 @@ type Query struct {
 
 	Offset uint64
 	Limit  uint64
+	Order  Order
+	After  *Cursor
 
 	NodeID      CodeID
 	Region      CodeID
@@ -61,8 +66,43 @@ type Query struct {
 	Locality    uint16
 	Sublocality uint16
 
-	From uint16
-	To   uint16
+	From uint32
+	To   uint32
+	// MinDuration is the least length of free intervals in hours.
+	MinDuration uint32
+}
+
+// Order is the order List returns rows in. Rows are ordered by the column
+// of the order, then by lot and id.
+type Order uint8
+
+const (
+	OrderLot Order = iota
+	OrderStart
+	OrderDuration
+)
+
+func (order Order) column() string {
+	switch order {
+	case OrderStart:
+		return "start_at"
+	case OrderDuration:
+		return "duration"
+	}
+
+	return ""
+}
+
+// Cursor is the key of the last row of the previous page, List returns
+// rows after it. Key is the value of the column of the order.
+type Cursor struct {
+	Key   uint32
+	LotID uint64
+	ID    uint64
+}
+
+func (conn *Connector) DB() isql.DB {
+	return conn.db
 }
 
 func (conn *Connector) Transaction(
@@ -78,7 +118,37 @@ func (conn *Connector) Transaction(
 
 const defaultLimit = 100
 
+// timeslotPrefix is the prefix of timeslot tables, the node follows it.
+const timeslotPrefix = "timeslot_"
+
 func (conn *Connector) List(ctx context.Context, qry Query) ([]Record, error) {
+	return list(ctx, conn.db, qry, listBuilder(qry))
+}
+
+// ListForUpdate is like List but runs in the transaction and locks
+// the selected rows until the transaction ends.
+func (conn *Connector) ListForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+) ([]Record, error) {
+	builder := listBuilder(qry)
+
+	// SQLite has no row locks, a write transaction locks the whole database.
+	if conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+
+	return list(ctx, stmt, qry, builder)
+}
+
+func (conn *Connector) supportsLocking() bool {
+	_, ok := conn.db.Driver().(*mysql.MySQLDriver)
+
+	return ok
+}
+
+func listBuilder(qry Query) squirrel.SelectBuilder {
 	if qry.Limit == 0 {
 		qry.Limit = defaultLimit
 	}
@@ -95,10 +165,64 @@ func (conn *Connector) List(ctx context.Context, qry Query) ([]Record, error) {
 		"end_at").
 		From("timeslot_" + string(qry.NodeID[:]))
 
-	builder = builder.Where("region = ?", string(qry.Region[:]))
+	builder = whereAvailable(builder, qry).Limit(qry.Limit)
+
+	column := qry.Order.column()
+	if column != "" {
+		builder = builder.OrderBy(column)
+	}
+
+	builder = builder.OrderBy("lot_id", "id")
+
+	if qry.After != nil {
+		var after squirrel.Sqlizer = squirrel.Or{
+			squirrel.Gt{"lot_id": qry.After.LotID},
+			squirrel.And{
+				squirrel.Eq{"lot_id": qry.After.LotID},
+				squirrel.Gt{"id": qry.After.ID},
+			},
+		}
+
+		if column != "" {
+			after = squirrel.Or{
+				squirrel.Gt{column: qry.After.Key},
+				squirrel.And{
+					squirrel.Eq{column: qry.After.Key},
+					after,
+				},
+			}
+		}
+
+		builder = builder.Where(after)
+	}
+
+	if qry.Offset > 0 {
+		builder = builder.Offset(qry.Offset)
+	}
+
+	return builder
+}
+
+// whereAvailable filters free intervals enclosing the range [From, To]
+// and not shorter than MinDuration.
+func whereAvailable(
+	builder squirrel.SelectBuilder,
+	qry Query,
+) squirrel.SelectBuilder {
 	builder = builder.Where("start_at <= ?", qry.From)
 	builder = builder.Where("end_at >= ?", qry.To)
 
+	return whereLot(builder, qry)
+}
+
+// whereLot filters free intervals of the lots of the query not shorter
+// than MinDuration whatever their range is.
+func whereLot(
+	builder squirrel.SelectBuilder,
+	qry Query,
+) squirrel.SelectBuilder {
+	builder = builder.Where("region = ?", string(qry.Region[:]))
+
 	if qry.Area > 0 {
 		builder = builder.Where("area = ?", qry.Area)
 	}
@@ -111,6 +235,10 @@ func (conn *Connector) List(ctx context.Context, qry Query) ([]Record, error) {
 		builder = builder.Where("sublocality = ?", qry.Sublocality)
 	}
 
+	if qry.MinDuration > 0 {
+		builder = builder.Where("duration >= ?", qry.MinDuration)
+	}
+
 	if qry.HousingID > 0 {
 		builder = builder.Where("housing_id = ?", qry.HousingID)
 	}
@@ -119,18 +247,86 @@ func (conn *Connector) List(ctx context.Context, qry Query) ([]Record, error) {
 		builder = builder.Where("lot_id = ?", qry.LotID)
 	}
 
-	builder = builder.Limit(qry.Limit)
+	return builder
+}
+
+// ListOverlapping returns free intervals of the lot that overlap
+// the range [From, To) ordered by start.
+func (conn *Connector) ListOverlapping(
+	ctx context.Context,
+	qry Query,
+) ([]Record, error) {
+	return list(ctx, conn.db, qry, overlappingBuilder(qry))
+}
 
-	if qry.Offset > 0 {
-		builder = builder.Offset(qry.Offset)
+// ListOverlappingForUpdate is like ListOverlapping but runs in
+// the transaction and locks the selected rows until the transaction ends.
+func (conn *Connector) ListOverlappingForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+) ([]Record, error) {
+	builder := overlappingBuilder(qry)
+
+	if conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
 	}
 
+	return list(ctx, stmt, qry, builder)
+}
+
+func overlappingBuilder(qry Query) squirrel.SelectBuilder {
+	builder := squirrel.Select(
+		"id",
+		"region",
+		"area",
+		"locality",
+		"sublocality",
+		"housing_id",
+		"lot_id",
+		"start_at",
+		"end_at").
+		From("timeslot_" + string(qry.NodeID[:]))
+
+	builder = builder.Where("region = ?", string(qry.Region[:]))
+	builder = builder.Where("lot_id = ?", qry.LotID)
+	builder = builder.Where("start_at < ?", qry.To)
+	builder = builder.Where("end_at > ?", qry.From)
+
+	return builder.OrderBy("start_at")
+}
+
+// Del deletes free intervals of the lot that overlap the range [From, To).
+func Del(ctx context.Context, stmt isql.ContextStatement, qry Query) error {
+	query, args, err := squirrel.Delete("timeslot_"+string(qry.NodeID[:])).
+		Where("region = ?", string(qry.Region[:])).
+		Where("lot_id = ?", qry.LotID).
+		Where("start_at < ?", qry.To).
+		Where("end_at > ?", qry.From).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete records, %w", err)
+	}
+
+	return nil
+}
+
+func list(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+	builder squirrel.SelectBuilder,
+) ([]Record, error) {
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build select query, %w", err)
 	}
 
-	rows, err := conn.db.QueryContext(ctx, query, args...)
+	rows, err := stmt.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query, %w", err)
 	}
@@ -160,6 +356,7 @@ func (conn *Connector) List(ctx context.Context, qry Query) ([]Record, error) {
 		}
 
 		copy(rec.Region[:], region)
+		rec.NodeID = qry.NodeID
 
 		result = append(result, rec)
 	}
@@ -246,15 +443,9 @@ func Add(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
 }
 
 func Upd(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
-	builder := squirrel.Update("timeslot_" + string(rec.NodeID[:]))
-
-	if rec.StartAt > 0 {
-		builder = builder.Set("start_at", rec.StartAt)
-	}
-
-	if rec.EndAt > 0 {
-		builder = builder.Set("end_at", rec.EndAt)
-	}
+	builder := squirrel.Update("timeslot_"+string(rec.NodeID[:])).
+		Set("start_at", rec.StartAt).
+		Set("end_at", rec.EndAt)
 
 	builder = builder.Where("housing_id = ?", rec.HousingID)
 	builder = builder.Where("lot_id = ?", rec.LotID)
@@ -278,11 +469,36 @@ func Upd(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
 	return nil
 }
 
-func Get(
+// Remove deletes the free interval.
+func Remove(ctx context.Context, stmt isql.ContextStatement, rec Record) error {
+	query, args, err := squirrel.Delete("timeslot_"+string(rec.NodeID[:])).
+		Where("lot_id = ?", rec.LotID).
+		Where("id = ?", rec.ID).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	res, err := stmt.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete a record, %w", err)
+	}
+
+	if num, err := res.RowsAffected(); num != 1 || err != nil {
+		return fmt.Errorf("failed to affect row, %w", err)
+	}
+
+	return nil
+}
+
+// GetNeighboursForUpdate returns free intervals of the lot ending at From
+// and starting at To, either of them is nil if there is none. The rows
+// are locked until the transaction ends.
+func (conn *Connector) GetNeighboursForUpdate(
 	ctx context.Context,
 	stmt isql.ContextStatement,
 	qry Query,
-) (*Record, error) {
+) (*Record, *Record, error) {
 	builder := squirrel.Select(
 		"id",
 		"region",
@@ -298,47 +514,164 @@ func Get(
 	builder = builder.Where(
 		squirrel.And{
 			squirrel.Eq{"region": string(qry.Region[:])},
-			squirrel.Eq{"area": qry.Area},
-			squirrel.Eq{"locality": qry.Locality},
-			squirrel.Eq{"sublocality": qry.Sublocality},
-			squirrel.Eq{"housing_id": qry.HousingID},
 			squirrel.Eq{"lot_id": qry.LotID},
 
 			squirrel.Or{
-				squirrel.Eq{"start_at": qry.To},
 				squirrel.Eq{"end_at": qry.From},
+				squirrel.Eq{"start_at": qry.To},
 			},
 		},
 	)
 
+	if conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+
+	records, err := list(ctx, stmt, qry, builder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var left, right *Record
+
+	for idx := range records {
+		switch {
+		case records[idx].EndAt == qry.From && left == nil:
+			left = &records[idx]
+		case records[idx].StartAt == qry.To && right == nil:
+			right = &records[idx]
+		}
+	}
+
+	return left, right, nil
+}
+
+// WidenOffsets converts the start_at and end_at columns of the node table
+// created with 16-bit offsets and moves open-ended intervals from oldMax
+// to newMax. The default of end_at stays oldMax until the intervals are
+// moved, so an interrupted run is resumed by the next one and a table
+// already widened is left as it is.
+func (conn *Connector) WidenOffsets(
+	ctx context.Context,
+	node CodeID,
+	oldMax uint32,
+	newMax uint32,
+) error {
+	table := "timeslot_" + string(node[:])
+
+	dataType, dflt, err := conn.columnType(ctx, table, "end_at")
+	if err != nil {
+		return err
+	}
+
+	oldDefault := strconv.FormatUint(uint64(oldMax), 10)
+
+	if dataType == "smallint" {
+		query := `alter table ` + table + `
+			modify start_at int(10) unsigned default 0,
+			modify end_at int(10) unsigned default ` + oldDefault
+
+		if _, err := conn.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("failed to alter table %s, %w", table, err)
+		}
+	} else if dflt != oldDefault {
+		return nil
+	}
+
+	// Under the old horizon only open-ended intervals could end at oldMax.
+	query, args, err := squirrel.Update(table).
+		Set("end_at", newMax).
+		Where(squirrel.Eq{"end_at": oldMax}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	if _, err := conn.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to update records, %w", err)
+	}
+
+	query = `alter table ` + table + `
+		alter end_at set default ` + strconv.FormatUint(uint64(newMax), 10)
+
+	if _, err := conn.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to alter table %s, %w", table, err)
+	}
+
+	return nil
+}
+
+// columnType returns the data type and the default of the column.
+func (conn *Connector) columnType(
+	ctx context.Context,
+	table string,
+	column string,
+) (string, string, error) {
+	query, args, err := squirrel.Select("data_type", "coalesce(column_default, '')").
+		From("information_schema.columns").
+		Where(squirrel.Expr("table_schema = database()")).
+		Where(squirrel.Eq{"table_name": table, "column_name": column}).
+		ToSql()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build an query, %w", err)
+	}
+
+	var dataType, dflt string
+
+	row := conn.db.QueryRowContext(ctx, query, args...)
+	if err := row.Scan(&dataType, &dflt); err != nil {
+		return "", "", fmt.Errorf("failed to get column %s.%s, %w", table, column, err)
+	}
+
+	return dataType, dflt, nil
+}
+
+// ListNodes returns the nodes timeslot tables exist for.
+func (conn *Connector) ListNodes(ctx context.Context) ([]CodeID, error) {
+	builder := squirrel.Select("name").
+		From("sqlite_master").
+		Where(squirrel.Eq{"type": "table"})
+
+	if conn.supportsLocking() {
+		builder = squirrel.Select("table_name").
+			From("information_schema.tables").
+			Where(squirrel.Expr("table_schema = database()"))
+	}
+
 	query, args, err := builder.ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build select query, %w", err)
 	}
 
-	row := stmt.QueryRowContext(ctx, query, args...)
-
-	var (
-		region string
-		rec    Record
-	)
-	err = row.Scan(
-		&rec.ID,
-		&region,
-		&rec.Area,
-		&rec.Locality,
-		&rec.Sublocality,
-		&rec.HousingID,
-		&rec.LotID,
-		&rec.StartAt,
-		&rec.EndAt,
-	)
+	rows, err := conn.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan, %w", err)
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []CodeID{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		node := strings.TrimPrefix(table, timeslotPrefix)
+		if node == table || len(node) != len(CodeID{}) {
+			continue
+		}
+
+		result = append(result, CodeID{node[0], node[1]})
 	}
 
-	copy(rec.Region[:], region)
-	rec.NodeID = qry.NodeID
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
 
-	return &rec, nil
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
 }
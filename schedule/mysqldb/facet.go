@@ -0,0 +1,99 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+)
+
+var ErrUnknownColumn = errors.New("unknown column")
+
+// Facet is the number of lots of the group, levels below the column
+// of the group are zero.
+type Facet struct {
+	Area        uint16
+	Locality    uint16
+	Sublocality uint16
+	Count       uint64
+}
+
+// facetColumns are the columns lots are grouped by for the column. IDs
+// are unique within their parents only, so the parents are grouped by too.
+var facetColumns = map[string][]string{
+	"area":        {"area"},
+	"locality":    {"area", "locality"},
+	"sublocality": {"area", "locality", "sublocality"},
+}
+
+// CountAvailable returns the number of lots available for the range
+// grouped by the column and its parents.
+func (conn *Connector) CountAvailable(
+	ctx context.Context,
+	qry Query,
+	column string,
+) ([]Facet, error) {
+	columns, ok := facetColumns[column]
+	if !ok {
+		return nil, fmt.Errorf("%s, %w", column, ErrUnknownColumn)
+	}
+
+	builder := squirrel.Select(columns...).
+		Column("count(distinct lot_id)").
+		From("timeslot_" + string(qry.NodeID[:]))
+
+	builder = whereAvailable(builder, qry).
+		GroupBy(columns...).
+		OrderBy(columns...)
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []Facet{}
+	for rows.Next() {
+		var facet Facet
+
+		dest := []interface{}{&facet.Area, &facet.Locality, &facet.Sublocality}
+		dest = append(dest[:len(columns)], &facet.Count)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, facet)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,93 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// CountShifts returns the number of lots available for the range
+// [From, To) shifted by every of the shifts in hours, keyed by the shift.
+// Shifts without lots are missing. Shifted ranges must be within
+// the horizon.
+func (conn *Connector) CountShifts(
+	ctx context.Context,
+	qry Query,
+	shifts []int,
+) (map[int]uint64, error) {
+	result := map[int]uint64{}
+	if len(shifts) == 0 {
+		return result, nil
+	}
+
+	selects := make([]string, len(shifts))
+	args := make([]interface{}, 0, len(shifts)+2)
+
+	for idx, shift := range shifts {
+		selects[idx] = "select ? as shift"
+		args = append(args, shift)
+	}
+
+	args = append(args, qry.From, qry.To)
+
+	builder := squirrel.Select("shifts.shift", "count(distinct lot_id)").
+		From("timeslot_"+string(qry.NodeID[:])).
+		JoinClause(
+			"join ("+strings.Join(selects, " union all ")+") as shifts"+
+				" on start_at <= ? + shifts.shift and end_at >= ? + shifts.shift",
+			args...,
+		)
+
+	builder = whereLot(builder, qry).GroupBy("shifts.shift")
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			shift int
+			count uint64
+		)
+
+		if err := rows.Scan(&shift, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result[shift] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/findbed/app/isql"
+)
+
+// ListLots returns ids of all lots having free intervals on the node.
+func (conn *Connector) ListLots(ctx context.Context, node CodeID) ([]uint64, error) {
+	query, args, err := squirrel.Select("lot_id").
+		Distinct().
+		From("timeslot_" + string(node[:])).
+		OrderBy("lot_id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query, %w", err)
+	}
+
+	rows, err := conn.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query, %w", err)
+	}
+
+	defer rows.Close()
+
+	result := []uint64{}
+	for rows.Next() {
+		var lotID uint64
+		if err := rows.Scan(&lotID); err != nil {
+			return nil, fmt.Errorf("failed to scan, %w", err)
+		}
+
+		result = append(result, lotID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("an error occurred during iteration, %w", err)
+	}
+
+	if err := rows.Close(); err != nil {
+		return result, fmt.Errorf("failed to close row, %w", err)
+	}
+
+	return result, nil
+}
+
+// ListLot returns all free intervals of the lot, whatever their bounds
+// are, ordered by start.
+func (conn *Connector) ListLot(ctx context.Context, qry Query) ([]Record, error) {
+	return list(ctx, conn.db, qry, lotBuilder(qry))
+}
+
+// ListLotForUpdate is like ListLot but runs in the transaction and locks
+// the rows until the transaction ends.
+func (conn *Connector) ListLotForUpdate(
+	ctx context.Context,
+	stmt isql.ContextStatement,
+	qry Query,
+) ([]Record, error) {
+	builder := lotBuilder(qry)
+
+	if conn.supportsLocking() {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+
+	return list(ctx, stmt, qry, builder)
+}
+
+func lotBuilder(qry Query) squirrel.SelectBuilder {
+	return squirrel.Select(
+		"id",
+		"region",
+		"area",
+		"locality",
+		"sublocality",
+		"housing_id",
+		"lot_id",
+		"start_at",
+		"end_at").
+		From("timeslot_"+string(qry.NodeID[:])).
+		Where("lot_id = ?", qry.LotID).
+		OrderBy("start_at", "end_at", "id")
+}
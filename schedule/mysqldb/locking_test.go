@@ -0,0 +1,104 @@
+package mysqldb_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/findbed/app/isql"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+var errStop = errors.New("stop")
+
+// fakeDB reports the driver only, the queries go to the statement.
+type fakeDB struct {
+	isql.DB
+	driver driver.Driver
+}
+
+func (db fakeDB) Driver() driver.Driver {
+	return db.driver
+}
+
+// recorder records queries and fails them, so no rows are scanned.
+type recorder struct {
+	isql.ContextStatement
+	queries []string
+}
+
+func (rec *recorder) QueryContext(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) (*sql.Rows, error) {
+	rec.queries = append(rec.queries, query)
+
+	return nil, errStop
+}
+
+type otherDriver struct {
+	driver.Driver
+}
+
+func Test_locking(t *testing.T) {
+	ctx := context.Background()
+	qry := mysqldb.Query{
+		NodeID: mysqldb.CodeID{'F', 'I'},
+		Region: mysqldb.CodeID{'F', 'I'},
+		LotID:  10,
+		From:   24,
+		To:     48,
+	}
+
+	calls := map[string]func(*mysqldb.Connector, *recorder) error{
+		"ListForUpdate": func(conn *mysqldb.Connector, stmt *recorder) error {
+			_, err := conn.ListForUpdate(ctx, stmt, qry)
+
+			return err
+		},
+		"GetNeighboursForUpdate": func(conn *mysqldb.Connector, stmt *recorder) error {
+			_, _, err := conn.GetNeighboursForUpdate(ctx, stmt, qry)
+
+			return err
+		},
+		"ListOverlappingForUpdate": func(conn *mysqldb.Connector, stmt *recorder) error {
+			_, err := conn.ListOverlappingForUpdate(ctx, stmt, qry)
+
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		call := call
+
+		t.Run(name+" locks rows on MySQL", func(t *testing.T) {
+			conn := mysqldb.New(fakeDB{driver: &mysql.MySQLDriver{}})
+			stmt := &recorder{}
+
+			err := call(conn, stmt)
+			assert.ErrorIs(t, err, errStop)
+
+			if assert.Len(t, stmt.queries, 1) {
+				assert.True(t, strings.HasSuffix(stmt.queries[0], "FOR UPDATE"))
+			}
+		})
+
+		t.Run(name+" doesn't lock rows on other drivers", func(t *testing.T) {
+			conn := mysqldb.New(fakeDB{driver: otherDriver{}})
+			stmt := &recorder{}
+
+			err := call(conn, stmt)
+			assert.ErrorIs(t, err, errStop)
+
+			if assert.Len(t, stmt.queries, 1) {
+				assert.NotContains(t, stmt.queries[0], "FOR UPDATE")
+			}
+		})
+	}
+}
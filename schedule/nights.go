@@ -0,0 +1,194 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+const (
+	// nightPage is the number of free intervals read at once
+	// while free nights are looked for.
+	nightPage = 1000
+
+	// checkInHour is the hour of the day a night starts at, the night
+	// ends at the same hour of the next day.
+	checkInHour = 12
+
+	// maxNightDays is the longest range free nights are looked for in.
+	maxNightDays = 366
+)
+
+// FreeNights is the availability of lots by nights, Lots[lot][day]
+// is true if the lot is free the night of the day after From.
+type FreeNights struct {
+	From time.Time
+	Days int
+	Lots map[LongID][]bool
+}
+
+// FreeNights returns the nights of every day of the range
+// [query.From, query.To) the lots matching the query are free. A night
+// is free if a free interval encloses it from noon to noon. Lots which
+// are not free any night of the range are left out.
+func (unit *Scheduler) FreeNights(ctx context.Context, query Query) (FreeNights, error) {
+	if query.Region == (CodeID{}) {
+		return FreeNights{}, fmt.Errorf("region is required, %w", ErrInvalidQuery)
+	}
+
+	fromDay := unit.startOfDay(query.From)
+	toDay := unit.startOfDay(query.To)
+
+	days := 0
+	for day := fromDay; day.Before(toDay); day = day.AddDate(0, 0, 1) {
+		if days++; days > maxNightDays {
+			return FreeNights{}, fmt.Errorf(
+				"range is longer than %d days, %w", maxNightDays, ErrInvalidQuery,
+			)
+		}
+	}
+
+	if days == 0 {
+		return FreeNights{}, fmt.Errorf("from must be before to, %w", ErrInvalidQuery)
+	}
+
+	first, err := unit.numberHoursAfterFirstDay(fromDay.Add(checkInHour * time.Hour))
+	if err != nil {
+		return FreeNights{}, err
+	}
+
+	last := first + uint32((days-1)*hoursInDay)
+	if last+hoursInDay > maxDay {
+		return FreeNights{}, fmt.Errorf("%s, %w", query.To, ErrOutOfHorizon)
+	}
+
+	// A free interval encloses a night of the range if it starts before
+	// the last night and ends after the first one.
+	qry := mysqldb.Query{
+		Region:      mysqldb.CodeID(query.Region),
+		Area:        uint16(query.Area),
+		Locality:    uint16(query.Locality),
+		Sublocality: uint16(query.Sublocality),
+		LotID:       uint64(query.LotID),
+		From:        last,
+		To:          first + hoursInDay,
+		MinDuration: hoursInDay,
+		Order:       mysqldb.OrderLot,
+		Limit:       nightPage,
+	}
+
+	nodes := unit.nodes(query.NodeID, query.Region)
+
+	type nodeNights struct {
+		lots map[LongID][]bool
+		err  error
+	}
+
+	pages := make([]nodeNights, len(nodes))
+
+	var wg sync.WaitGroup
+
+	for idx, node := range nodes {
+		wg.Add(1)
+
+		go func(idx int, node CodeID) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, unit.nodeTimeout)
+			defer cancel()
+
+			qry := qry
+			qry.NodeID = mysqldb.CodeID(node)
+
+			pages[idx].lots, pages[idx].err = unit.markNights(ctx, qry, first, days)
+		}(idx, node)
+	}
+
+	wg.Wait()
+
+	result := FreeNights{
+		From: fromDay,
+		Days: days,
+		Lots: map[LongID][]bool{},
+	}
+
+	for idx, page := range pages {
+		if page.err != nil {
+			return FreeNights{}, fmt.Errorf(
+				"failed to look for nights on node %s, %w", nodes[idx][:], page.err,
+			)
+		}
+
+		for lotID, nights := range page.lots {
+			result.Lots[lotID] = nights
+		}
+	}
+
+	return result, nil
+}
+
+// markNights reads all free intervals of the node matching the query
+// and marks the nights starting at first and every day after it
+// the intervals enclose.
+func (unit *Scheduler) markNights(
+	ctx context.Context,
+	qry mysqldb.Query,
+	first uint32,
+	days int,
+) (map[LongID][]bool, error) {
+	lots := map[LongID][]bool{}
+
+	for {
+		records, err := unit.connector.List(ctx, qry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get records, %w", err)
+		}
+
+		for _, rec := range records {
+			// The first and the last night the interval encloses.
+			from := 0
+			if rec.StartAt > first {
+				from = int((rec.StartAt - first + hoursInDay - 1) / hoursInDay)
+			}
+
+			to := (int(rec.EndAt) - hoursInDay - int(first)) / hoursInDay
+			if to >= days {
+				to = days - 1
+			}
+
+			nights, ok := lots[LongID(rec.LotID)]
+			if !ok {
+				nights = make([]bool, days)
+				lots[LongID(rec.LotID)] = nights
+			}
+
+			for day := from; day <= to; day++ {
+				nights[day] = true
+			}
+		}
+
+		if uint64(len(records)) < qry.Limit {
+			return lots, nil
+		}
+
+		last := records[len(records)-1]
+		qry.After = &mysqldb.Cursor{LotID: last.LotID, ID: last.ID}
+	}
+}
@@ -0,0 +1,72 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FreeNights(t *testing.T) {
+	slot := newTimeslot()
+
+	scheduler, now, close := newScheduler(t, slot.NodeID)
+	defer close()
+
+	ctx := context.Background()
+
+	err := scheduler.RegisterLot(ctx, slot)
+	require.NoError(t, err)
+
+	first := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	day := func(num int) time.Time {
+		return first.AddDate(0, 0, num)
+	}
+
+	// The booking takes the night of the 3rd day only.
+	booked := slot
+	booked.StartAt = day(3).Add(12 * time.Hour)
+	booked.EndAt = day(4).Add(12 * time.Hour)
+
+	_, err = scheduler.Book(ctx, booked, newGuest())
+	require.NoError(t, err)
+
+	query := schedule.Query{
+		NodeID: slot.NodeID,
+		Region: slot.Region,
+		From:   day(2),
+		To:     day(6),
+	}
+
+	t.Run("nights are marked", func(t *testing.T) {
+		nights, err := scheduler.FreeNights(ctx, query)
+		require.NoError(t, err)
+
+		assert.Equal(t, day(2), nights.From)
+		assert.Equal(t, 4, nights.Days)
+		assert.Equal(
+			t,
+			map[schedule.LongID][]bool{slot.LotID: {true, false, true, true}},
+			nights.Lots,
+		)
+	})
+
+	t.Run("region is required", func(t *testing.T) {
+		query := query
+		query.Region = schedule.CodeID{}
+
+		_, err := scheduler.FreeNights(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidQuery)
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		query := query
+		query.To = query.From
+
+		_, err := scheduler.FreeNights(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidQuery)
+	})
+}
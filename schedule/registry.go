@@ -0,0 +1,151 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var ErrInvalidRegistry = errors.New("invalid node registry")
+
+// Registry maps regions to the nodes storing their timeslots. A region
+// that isn't registered is stored on the node of the same name.
+type Registry struct {
+	mu    sync.RWMutex
+	nodes map[CodeID][]CodeID
+}
+
+func NewRegistry() *Registry {
+	return &Registry{nodes: make(map[CodeID][]CodeID)}
+}
+
+// Set replaces the nodes of the region.
+func (r *Registry) Set(region CodeID, nodes ...CodeID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nodes[region] = append([]CodeID(nil), nodes...)
+}
+
+// Nodes returns the nodes of the region.
+func (r *Registry) Nodes(region CodeID) []CodeID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes, ok := r.nodes[region]
+	if !ok || len(nodes) == 0 {
+		return []CodeID{region}
+	}
+
+	return append([]CodeID(nil), nodes...)
+}
+
+// All returns the nodes of all regions.
+func (r *Registry) All() []CodeID {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[CodeID]struct{})
+	result := []CodeID{}
+
+	for _, nodes := range r.nodes {
+		for _, node := range nodes {
+			if _, ok := seen[node]; ok {
+				continue
+			}
+
+			seen[node] = struct{}{}
+			result = append(result, node)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return string(result[i][:]) < string(result[j][:])
+	})
+
+	return result
+}
+
+// Load replaces the registry with the comma-separated list of
+// region:node pairs, e.g. "ru:r1,ru:r2,fi:fi".
+func (r *Registry) Load(val string) error {
+	nodes := make(map[CodeID][]CodeID)
+
+	for _, pair := range strings.Split(val, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.Split(pair, ":")
+		if len(parts) != 2 ||
+			len(parts[0]) != len(CodeID{}) ||
+			len(parts[1]) != len(CodeID{}) {
+			return fmt.Errorf("%q, %w", pair, ErrInvalidRegistry)
+		}
+
+		var region, node CodeID
+
+		copy(region[:], parts[0])
+		copy(node[:], parts[1])
+
+		nodes[region] = append(nodes[region], node)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nodes = nodes
+
+	return nil
+}
+
+// Nodes returns the nodes of the registry and the nodes timeslot tables
+// exist for, regions missing from the registry are stored on those.
+func (unit *Scheduler) Nodes(ctx context.Context) ([]CodeID, error) {
+	tables, err := unit.connector.ListNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes, %w", err)
+	}
+
+	seen := make(map[CodeID]struct{})
+	result := []CodeID{}
+
+	for _, node := range unit.registry.All() {
+		seen[node] = struct{}{}
+		result = append(result, node)
+	}
+
+	for _, table := range tables {
+		node := CodeID(table)
+		if _, ok := seen[node]; ok {
+			continue
+		}
+
+		seen[node] = struct{}{}
+		result = append(result, node)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return string(result[i][:]) < string(result[j][:])
+	})
+
+	return result, nil
+}
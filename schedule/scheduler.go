@@ -16,21 +16,84 @@ package schedule
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/txwrapper"
+)
+
+var (
+	ErrUnavailable  = errors.New("timeslot is unavailable")
+	ErrNotFound     = errors.New("not found")
+	ErrInvalidSlot  = errors.New("invalid timeslot")
+	ErrInvalidQuery = errors.New("invalid query")
+
+	ErrOutOfHorizon = errors.New("date is out of the scheduling horizon")
 )
 
 type Scheduler struct {
 	connector *mysqldb.Connector
 	firstDay  time.Time
+
+	registry    *Registry
+	nodeTimeout time.Duration
+	redeemer    Redeemer
+	onChange    func(TimeSlot)
+}
+
+type Option func(*Scheduler)
+
+// WithRegistry sets the registry of nodes searched for a region.
+func WithRegistry(registry *Registry) Option {
+	return func(s *Scheduler) {
+		s.registry = registry
+	}
+}
+
+// WithNodeTimeout limits the time a node is searched for.
+func WithNodeTimeout(timeout time.Duration) Option {
+	return func(s *Scheduler) {
+		s.nodeTimeout = timeout
+	}
 }
 
-func New(firstDay time.Time, conn *mysqldb.Connector) *Scheduler {
-	return &Scheduler{connector: conn, firstDay: firstDay.Truncate(time.Hour)}
+// WithRedeemer lets bookings redeem promo codes.
+func WithRedeemer(redeemer Redeemer) Option {
+	return func(s *Scheduler) {
+		s.redeemer = redeemer
+	}
+}
+
+// WithOnChange sets the function called with the slot of the lot after
+// every committed change of its free intervals: a booking, hold or block
+// made or released, new rules, a registration or a repair.
+func WithOnChange(onChange func(TimeSlot)) Option {
+	return func(s *Scheduler) {
+		s.onChange = onChange
+	}
+}
+
+const defaultNodeTimeout = 2 * time.Second
+
+func New(
+	firstDay time.Time,
+	conn *mysqldb.Connector,
+	opts ...Option,
+) *Scheduler {
+	scheduler := &Scheduler{
+		connector:   conn,
+		firstDay:    firstDay.Truncate(time.Hour),
+		registry:    NewRegistry(),
+		nodeTimeout: defaultNodeTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(scheduler)
+	}
+
+	return scheduler
 }
 
 type LongID uint64
@@ -39,12 +102,22 @@ type CodeID [2]byte
 
 type Query struct {
 	NodeID CodeID
+	LotID  LongID
 
 	From time.Time
 	To   time.Time
 
 	Offset uint64
 	Limit  uint64
+	// Cursor is the token of the previous page, the page starts after it.
+	Cursor string
+	Sort   Sort
+	// FlexDays is the number of days the range may be shifted by
+	// if there are no free intervals enclosing it.
+	FlexDays int
+	// Stay turns the range into a window, free intervals a stay of this
+	// length fits into somewhere in the window are searched.
+	Stay time.Duration
 
 	Region      CodeID
 	Area        ID
@@ -67,54 +140,277 @@ type TimeSlot struct {
 	Sublocality ID
 }
 
+// SearchResult is a page of free intervals merged from the nodes of
+// the query. Partial is set if some of the nodes failed, their slots
+// and alternatives are missing from the page. NextCursor is set if
+// the page is full. Alternatives are set if the first page of a flexible
+// query is empty.
+type SearchResult struct {
+	Slots        []TimeSlot
+	Partial      bool
+	FailedNodes  []CodeID
+	NextCursor   string
+	Alternatives []Alternative
+}
+
+// Search returns free intervals enclosing the range of the query. If
+// the node of the query isn't set, all nodes of the region are searched
+// concurrently. If the stay of the query is set, the earliest stays
+// fitting into the range are returned instead.
 func (unit *Scheduler) Search(
 	ctx context.Context,
 	query Query,
-) ([]TimeSlot, error) {
+) (SearchResult, error) {
+	from, err := unit.numberHoursAfterFirstDay(query.From)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	to, err := unit.numberHoursAfterFirstDay(query.To)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	order, err := query.Sort.order()
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	// Nodes without the cursor list from the beginning.
+	after := func(CodeID) *mysqldb.Cursor { return nil }
+
+	if query.Cursor != "" {
+		cur, err := parseCursor(query.Cursor)
+		if err != nil {
+			return SearchResult{}, err
+		}
+
+		if cur.by != query.Sort {
+			return SearchResult{}, fmt.Errorf(
+				"cursor of another sort, %w", ErrInvalidCursor,
+			)
+		}
+
+		after = cur.after
+	}
+
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultLimit
+	}
+
 	qry := mysqldb.Query{
-		NodeID: mysqldb.CodeID(query.NodeID),
-		Region: mysqldb.CodeID(query.Region),
-		From:   unit.numberHoursAfterFirstDay(query.From),
-		To:     unit.numberHoursAfterFirstDay(query.To),
+		LotID:  uint64(query.LotID),
+		From:   from,
+		To:     to,
 		Offset: query.Offset,
-		Limit:  query.Limit,
+		Limit:  limit,
+		Order:  order,
+
+		Region:      mysqldb.CodeID(query.Region),
+		Area:        uint16(query.Area),
+		Locality:    uint16(query.Locality),
+		Sublocality: uint16(query.Sublocality),
 	}
 
-	records, err := unit.connector.List(ctx, qry)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get records, %w", err)
+	var stay uint32
+
+	if query.Stay > 0 {
+		if stay, err = stayHours(query.Stay, from, to); err != nil {
+			return SearchResult{}, err
+		}
+
+		qry = whereStayFits(qry, stay)
 	}
 
-	result := make([]TimeSlot, len(records))
+	nodes := unit.nodes(query.NodeID, query.Region)
+	if len(nodes) > 1 {
+		// Any node may hold a part of the page, so each of them returns
+		// everything up to the end of the page.
+		qry.Limit += qry.Offset
+		qry.Offset = 0
+	}
+
+	pages := unit.fanOut(ctx, nodes, qry, after)
+
+	var (
+		result  SearchResult
+		records []mysqldb.Record
+		healthy []CodeID
+		lastErr error
+	)
+
+	for idx, page := range pages {
+		if page.err != nil {
+			result.FailedNodes = append(result.FailedNodes, nodes[idx])
+			lastErr = page.err
+
+			continue
+		}
+
+		records = append(records, page.records...)
+		healthy = append(healthy, nodes[idx])
+	}
+
+	if len(result.FailedNodes) == len(nodes) {
+		return SearchResult{}, fmt.Errorf("failed to get records, %w", lastErr)
+	}
+
+	result.Partial = len(result.FailedNodes) > 0
+
+	if len(nodes) > 1 {
+		records = paginate(records, query.Sort, query.Offset, limit)
+	}
+
+	result.Slots = make([]TimeSlot, len(records))
 	for idx, rec := range records {
-		result[idx] = TimeSlot{
-			HousingID: LongID(rec.HousingID),
-			LotID:     LongID(rec.LotID),
-
-			Region:      CodeID(rec.Region),
-			Area:        ID(rec.Area),
-			Locality:    ID(rec.Locality),
-			Sublocality: ID(rec.Sublocality),
+		if stay > 0 {
+			result.Slots[idx] = unit.earliestStay(rec, from, stay)
+
+			continue
 		}
+
+		result.Slots[idx] = unit.record2timeSlot(rec)
+	}
+
+	// A full page may be followed by another one.
+	if uint64(len(records)) == limit {
+		last := records[len(records)-1]
+		result.NextCursor = record2cursor(last, query.Sort).String()
+	}
+
+	// The window of a stay is flexible already.
+	if query.FlexDays > 0 && stay == 0 && len(records) == 0 &&
+		query.Offset == 0 && query.Cursor == "" {
+		alternatives, failed, err := unit.alternatives(
+			ctx, healthy, qry, query.FlexDays,
+		)
+		if err != nil {
+			return SearchResult{}, err
+		}
+
+		result.Alternatives = alternatives
+		result.FailedNodes = append(result.FailedNodes, failed...)
+		result.Partial = len(result.FailedNodes) > 0
 	}
 
 	return result, nil
 }
 
-func (unit *Scheduler) numberHoursAfterFirstDay(point time.Time) uint16 {
+func slot2record(slot TimeSlot, startAt, endAt uint32) mysqldb.Record {
+	return mysqldb.Record{
+		NodeID:      mysqldb.CodeID(slot.NodeID),
+		HousingID:   uint64(slot.HousingID),
+		LotID:       uint64(slot.LotID),
+		Region:      mysqldb.CodeID(slot.Region),
+		Area:        uint16(slot.Area),
+		Locality:    uint16(slot.Locality),
+		Sublocality: uint16(slot.Sublocality),
+		StartAt:     startAt,
+		EndAt:       endAt,
+	}
+}
+
+func (unit *Scheduler) record2timeSlot(rec mysqldb.Record) TimeSlot {
+	return TimeSlot{
+		NodeID: CodeID(rec.NodeID),
+
+		HousingID: LongID(rec.HousingID),
+		LotID:     LongID(rec.LotID),
+
+		StartAt: unit.timeAfterFirstDay(rec.StartAt),
+		EndAt:   unit.timeAfterFirstDay(rec.EndAt),
+
+		Region:      CodeID(rec.Region),
+		Area:        ID(rec.Area),
+		Locality:    ID(rec.Locality),
+		Sublocality: ID(rec.Sublocality),
+	}
+}
+
+const hourInSeconds = int64(time.Hour / time.Second)
+
+func (unit *Scheduler) numberHoursAfterFirstDay(point time.Time) (uint32, error) {
+	if point.Before(unit.firstDay) {
+		return 0, fmt.Errorf("%s is before the first day, %w", point, ErrOutOfHorizon)
+	}
+
 	cur := point.Truncate(time.Hour).Unix()
 	first := unit.firstDay.Unix()
-	hourInSeconds := time.Duration(time.Hour).Seconds()
 
-	return uint16((cur - first) / int64(hourInSeconds))
+	hours := (cur - first) / hourInSeconds
+	if hours > maxDay {
+		return 0, fmt.Errorf("%s is after the last day, %w", point, ErrOutOfHorizon)
+	}
+
+	return uint32(hours), nil
+}
+
+// timeAfterFirstDay is the inverse of numberHoursAfterFirstDay, the result
+// is in the location of the first day.
+func (unit *Scheduler) timeAfterFirstDay(hours uint32) time.Time {
+	return time.Unix(unit.firstDay.Unix()+int64(hours)*hourInSeconds, 0).
+		In(unit.firstDay.Location())
 }
 
-func (unit *Scheduler) Book(ctx context.Context, slot TimeSlot) error {
-	txw, err := unit.connector.Transaction(ctx)
+func (unit *Scheduler) validateSlot(slot TimeSlot) error {
+	if slot.NodeID == (CodeID{}) || slot.Region == (CodeID{}) {
+		return fmt.Errorf("node and region are required, %w", ErrInvalidSlot)
+	}
+
+	if slot.LotID == 0 {
+		return fmt.Errorf("lot is required, %w", ErrInvalidSlot)
+	}
+
+	return nil
+}
+
+// resolve sets the node of the slot from the registry unless it is set
+// and validates the slot.
+func (unit *Scheduler) resolve(slot TimeSlot) (TimeSlot, error) {
+	node, err := unit.node(slot.NodeID, slot.Region)
 	if err != nil {
-		return fmt.Errorf("failed to make tx, %w", err)
+		return slot, err
 	}
 
+	slot.NodeID = node
+
+	return slot, unit.validateSlot(slot)
+}
+
+// interval resolves the slot and returns it with its bounds in hours
+// after the first day.
+func (unit *Scheduler) interval(slot TimeSlot) (TimeSlot, uint32, uint32, error) {
+	slot, err := unit.resolve(slot)
+	if err != nil {
+		return slot, 0, 0, err
+	}
+
+	startAt, err := unit.numberHoursAfterFirstDay(slot.StartAt)
+	if err != nil {
+		return slot, 0, 0, err
+	}
+
+	endAt, err := unit.numberHoursAfterFirstDay(slot.EndAt)
+	if err != nil {
+		return slot, 0, 0, err
+	}
+
+	if startAt >= endAt {
+		return slot, 0, 0, fmt.Errorf("start must be before end, %w", ErrInvalidSlot)
+	}
+
+	return slot, startAt, endAt, nil
+}
+
+// take carves the interval out of the enclosing free slot of the lot.
+func (unit *Scheduler) take(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	startAt uint32,
+	endAt uint32,
+) error {
 	query := mysqldb.Query{
 		NodeID: mysqldb.CodeID(slot.NodeID),
 
@@ -124,24 +420,24 @@ func (unit *Scheduler) Book(ctx context.Context, slot TimeSlot) error {
 		Area:        uint16(slot.Area),
 		Locality:    uint16(slot.Locality),
 		Sublocality: uint16(slot.Sublocality),
-		From:        unit.numberHoursAfterFirstDay(slot.StartAt),
-		To:          unit.numberHoursAfterFirstDay(slot.EndAt),
+		From:        startAt,
+		To:          endAt,
 		Limit:       1,
 	}
 
-	result, err := unit.connector.List(ctx, query)
+	// The enclosing free slot stays locked until the split is committed,
+	// so a concurrent booking of the same interval can't see it.
+	result, err := unit.connector.ListForUpdate(ctx, txw, query)
 	if err != nil {
 		return fmt.Errorf("failed to get the previous slot, %w", err)
 	}
 
 	if len(result) != 1 {
-		return fmt.Errorf("result has not , %w", err)
+		return fmt.Errorf("failed to find a free slot, %w", ErrUnavailable)
 	}
 
 	prevSlot := result[0]
 
-	slotStartAt := unit.numberHoursAfterFirstDay(slot.StartAt)
-	slotEndAt := unit.numberHoursAfterFirstDay(slot.EndAt)
 	rec := mysqldb.Record{
 		ID:     prevSlot.ID,
 		NodeID: mysqldb.CodeID(slot.NodeID),
@@ -155,102 +451,129 @@ func (unit *Scheduler) Book(ctx context.Context, slot TimeSlot) error {
 		Sublocality: uint16(slot.Sublocality),
 
 		StartAt: prevSlot.StartAt,
-		EndAt:   slotStartAt,
+		EndAt:   startAt,
 	}
 
-	if slotStartAt == prevSlot.StartAt {
-		rec.StartAt = slotEndAt
-		rec.EndAt = prevSlot.EndAt
-	}
+	// The whole free interval is taken.
+	if startAt == prevSlot.StartAt && endAt == prevSlot.EndAt {
+		if err := mysqldb.Remove(ctx, txw, rec); err != nil {
+			return fmt.Errorf("failed to remove a slot, %w", err)
+		}
 
-	err = mysqldb.Upd(ctx, txw, rec)
-	txw.Error(err)
+		return nil
+	}
 
-	if slotEndAt != prevSlot.EndAt && slotStartAt != prevSlot.StartAt {
-		rec.StartAt = slotEndAt
+	if startAt == prevSlot.StartAt {
+		rec.StartAt = endAt
 		rec.EndAt = prevSlot.EndAt
+	}
 
-		err = mysqldb.Add(ctx, txw, rec)
-		txw.Error(err)
+	if err := mysqldb.Upd(ctx, txw, rec); err != nil {
+		return fmt.Errorf("failed to update a slot, %w", err)
 	}
 
-	if err := txw.TransactionEnd(); err != nil {
-		return fmt.Errorf("failed to add record, %w", err)
+	if endAt != prevSlot.EndAt && startAt != prevSlot.StartAt {
+		rec.StartAt = endAt
+		rec.EndAt = prevSlot.EndAt
+
+		if err := mysqldb.Add(ctx, txw, rec); err != nil {
+			return fmt.Errorf("failed to add a slot, %w", err)
+		}
 	}
 
 	return nil
 }
 
-func (unit *Scheduler) Cancel(ctx context.Context, slot TimeSlot) error {
-	txw, err := unit.connector.Transaction(ctx)
+// release returns the interval to the free pool of the lot, hours the
+// availability rules of the lot close stay taken.
+func (unit *Scheduler) release(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	startAt uint32,
+	endAt uint32,
+) error {
+	spans, err := unit.releasable(ctx, txw, slot, startAt, endAt)
 	if err != nil {
-		return fmt.Errorf("failed to make tx, %w", err)
+		return err
 	}
 
-	defer func() error {
-		if err := txw.TransactionEnd(); err != nil {
-			return fmt.Errorf("failed to cancel a slot, %w", err)
+	for _, free := range spans {
+		if err := unit.releaseSpan(ctx, txw, slot, free.startAt, free.endAt); err != nil {
+			return err
 		}
+	}
 
-		return nil
-	}()
+	return nil
+}
 
+// releaseSpan joins the interval with the free intervals next to it, so
+// the lot keeps one row per continuous free interval.
+func (unit *Scheduler) releaseSpan(
+	ctx context.Context,
+	txw *txwrapper.TxWrapper,
+	slot TimeSlot,
+	startAt uint32,
+	endAt uint32,
+) error {
 	query := mysqldb.Query{
-		HousingID:   uint64(slot.HousingID),
-		LotID:       uint64(slot.LotID),
-		NodeID:      mysqldb.CodeID(slot.NodeID),
-		Region:      mysqldb.CodeID(slot.Region),
-		Area:        uint16(slot.Area),
-		Locality:    uint16(slot.Locality),
-		Sublocality: uint16(slot.Sublocality),
-		From:        unit.numberHoursAfterFirstDay(slot.StartAt),
-		To:          unit.numberHoursAfterFirstDay(slot.EndAt),
+		NodeID: mysqldb.CodeID(slot.NodeID),
+		Region: mysqldb.CodeID(slot.Region),
+		LotID:  uint64(slot.LotID),
+		From:   startAt,
+		To:     endAt,
 	}
 
-	rec, err := mysqldb.Get(ctx, txw, query)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return fmt.Errorf("failed to get a record, %w", err)
+	left, right, err := unit.connector.GetNeighboursForUpdate(ctx, txw, query)
+	if err != nil {
+		return fmt.Errorf("failed to get neighbours, %w", err)
 	}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		err = mysqldb.Add(ctx, txw, mysqldb.Record{
-			NodeID:      mysqldb.CodeID(slot.NodeID),
-			HousingID:   uint64(slot.HousingID),
-			LotID:       uint64(slot.LotID),
-			Region:      mysqldb.CodeID(slot.Region),
-			Area:        uint16(slot.Area),
-			Locality:    uint16(slot.Locality),
-			Sublocality: uint16(slot.Sublocality),
-			StartAt:     unit.numberHoursAfterFirstDay(slot.StartAt),
-			EndAt:       unit.numberHoursAfterFirstDay(slot.EndAt),
-		})
-		txw.Error(err)
+	switch {
+	case left != nil && right != nil:
+		left.EndAt = right.EndAt
 
-		return nil
-	}
+		if err := mysqldb.Upd(ctx, txw, *left); err != nil {
+			return fmt.Errorf("failed to update a slot, %w", err)
+		}
 
-	if rec.EndAt == query.From {
-		rec.StartAt = 0
-		rec.EndAt = query.To
-	}
+		if err := mysqldb.Remove(ctx, txw, *right); err != nil {
+			return fmt.Errorf("failed to remove a slot, %w", err)
+		}
+	case left != nil:
+		left.EndAt = endAt
 
-	if rec.StartAt == query.To {
-		rec.StartAt = query.From
-		rec.EndAt = 0
-	}
+		if err := mysqldb.Upd(ctx, txw, *left); err != nil {
+			return fmt.Errorf("failed to update a slot, %w", err)
+		}
+	case right != nil:
+		right.StartAt = startAt
 
-	err = mysqldb.Upd(ctx, txw, *rec)
-	txw.Error(err)
+		if err := mysqldb.Upd(ctx, txw, *right); err != nil {
+			return fmt.Errorf("failed to update a slot, %w", err)
+		}
+	default:
+		if err := mysqldb.Add(ctx, txw, slot2record(slot, startAt, endAt)); err != nil {
+			return fmt.Errorf("failed to add a slot, %w", err)
+		}
+	}
 
 	return nil
 }
 
+// maxDay is the scheduling horizon in hours after the first day, about
+// a hundred years. A free interval ending at maxDay is open-ended.
 const (
 	minDay = 0
-	maxDay = 65535
+	maxDay = 876_000
 )
 
 func (unit *Scheduler) RegisterLot(ctx context.Context, slot TimeSlot) error {
+	slot, err := unit.resolve(slot)
+	if err != nil {
+		return err
+	}
+
 	rec := mysqldb.Record{
 		HousingID: uint64(slot.HousingID),
 		LotID:     uint64(slot.LotID),
@@ -264,10 +587,37 @@ func (unit *Scheduler) RegisterLot(ctx context.Context, slot TimeSlot) error {
 		EndAt:   maxDay,
 	}
 
-	err := unit.connector.Add(ctx, mysqldb.CodeID(slot.NodeID), rec)
+	err = unit.connector.Add(ctx, mysqldb.CodeID(slot.NodeID), rec)
 	if err != nil {
 		return fmt.Errorf("failed to add record, %w", err)
 	}
 
+	unit.changed(slot)
+
+	return nil
+}
+
+// legacyMaxDay is the open end of intervals stored with 16-bit offsets.
+const legacyMaxDay = 65535
+
+// MigrateHorizon rewrites the node table created with 16-bit offsets
+// to the current horizon.
+func (unit *Scheduler) MigrateHorizon(ctx context.Context, node CodeID) error {
+	err := unit.connector.WidenOffsets(
+		ctx,
+		mysqldb.CodeID(node),
+		legacyMaxDay,
+		maxDay,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to widen offsets, %w", err)
+	}
+
 	return nil
 }
+
+func (unit *Scheduler) changed(slot TimeSlot) {
+	if unit.onChange != nil {
+		unit.onChange(slot)
+	}
+}
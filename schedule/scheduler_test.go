@@ -3,10 +3,12 @@ package schedule_test
 import (
 	"context"
 	"database/sql"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/findbed/app/domain"
 	"github.com/findbed/app/schedule"
 	"github.com/findbed/app/schedule/mysqldb"
 	"github.com/findbed/app/tests/helper"
@@ -25,6 +27,9 @@ func Test_RegisterLot(t *testing.T) {
 		err := helper.CreateTimeslotTable(ctx, tx, node)
 		require.NoError(t, err)
 
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
 		return nil
 	}
 
@@ -46,7 +51,7 @@ func Test_RegisterLot(t *testing.T) {
 		To:     now.AddDate(0, 0, 3),
 	}
 
-	slots, err := scheduler.Search(ctx, query)
+	slots, err := search(ctx, scheduler, query)
 	assert.NoError(t, err)
 	assert.Equal(t, []schedule.TimeSlot{}, slots)
 
@@ -62,10 +67,11 @@ func Test_RegisterLot(t *testing.T) {
 	err = scheduler.RegisterLot(ctx, slot)
 	assert.NoError(t, err)
 
-	slots, err = scheduler.Search(ctx, query)
+	slots, err = search(ctx, scheduler, query)
 	assert.NoError(t, err)
 
-	slot.NodeID = [2]byte{}
+	slot.StartAt = now.Truncate(time.Hour)
+	slot.EndAt = slot.StartAt.Add(876_000 * time.Hour)
 	assert.Equal(t, slot, slots[0])
 }
 
@@ -76,6 +82,9 @@ func Test_Book(t *testing.T) {
 		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
 		require.NoError(t, err)
 
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
 		return nil
 	}
 
@@ -100,18 +109,44 @@ func Test_Book(t *testing.T) {
 		To:     to,
 	}
 
-	slots, err := scheduler.Search(ctx, query)
+	slots, err := search(ctx, scheduler, query)
 	assert.NoError(t, err)
 	assert.Equal(t, len(slots), 1)
 
 	timeslot.StartAt = from
 	timeslot.EndAt = to
 
-	err = scheduler.Book(ctx, timeslot)
+	_, err = scheduler.Book(ctx, timeslot, newGuest())
 	assert.NoError(t, err)
 
+	t.Run("free intervals around the booked slot", func(t *testing.T) {
+		slots, err := search(ctx, scheduler, schedule.Query{
+			NodeID: timeslot.NodeID,
+			Region: timeslot.Region,
+			From:   to,
+			To:     to.Add(time.Hour),
+		})
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+
+		assert.Equal(t, timeslot.NodeID, slots[0].NodeID)
+		assert.True(t, slots[0].StartAt.Equal(to.Truncate(time.Hour)))
+
+		slots, err = search(ctx, scheduler, schedule.Query{
+			NodeID: timeslot.NodeID,
+			Region: timeslot.Region,
+			From:   from.Add(-time.Hour),
+			To:     from,
+		})
+		require.NoError(t, err)
+		require.Len(t, slots, 1)
+
+		assert.True(t, slots[0].StartAt.Equal(now.Truncate(time.Hour)))
+		assert.True(t, slots[0].EndAt.Equal(from.Truncate(time.Hour)))
+	})
+
 	t.Run("trying to book the same slot", func(t *testing.T) {
-		slots, err = scheduler.Search(ctx, query)
+		slots, err = search(ctx, scheduler, query)
 		assert.NoError(t, err)
 		assert.Equal(t, len(slots), 0)
 	})
@@ -119,7 +154,7 @@ func Test_Book(t *testing.T) {
 	t.Run(
 		"unable to book a slot an hour early but ends at the same time",
 		func(t *testing.T) {
-			slots, err = scheduler.Search(ctx, schedule.Query{
+			slots, err = search(ctx, scheduler, schedule.Query{
 				NodeID: timeslot.NodeID,
 				Region: timeslot.Region,
 				From:   from.Add(-1 * time.Hour),
@@ -134,7 +169,7 @@ func Test_Book(t *testing.T) {
 	t.Run(
 		"unable to book a slot an hour later but start at the same time",
 		func(t *testing.T) {
-			slots, err = scheduler.Search(ctx, schedule.Query{
+			slots, err = search(ctx, scheduler, schedule.Query{
 				NodeID: timeslot.NodeID,
 				Region: timeslot.Region,
 				From:   from,
@@ -149,7 +184,7 @@ func Test_Book(t *testing.T) {
 	t.Run(
 		"unable to book a slot an hour early and ends an hour later",
 		func(t *testing.T) {
-			slots, err = scheduler.Search(ctx, schedule.Query{
+			slots, err = search(ctx, scheduler, schedule.Query{
 				NodeID: timeslot.NodeID,
 				Region: timeslot.Region,
 				From:   from.Add(-1 * time.Hour),
@@ -164,7 +199,7 @@ func Test_Book(t *testing.T) {
 	t.Run(
 		"it's possible to book a slot an hour later and ends an two hour later",
 		func(t *testing.T) {
-			slots, err = scheduler.Search(ctx, schedule.Query{
+			slots, err = search(ctx, scheduler, schedule.Query{
 				NodeID: timeslot.NodeID,
 				Region: timeslot.Region,
 				From:   to.Add(time.Hour),
@@ -181,10 +216,10 @@ func Test_Book(t *testing.T) {
 		slot.StartAt = timeslot.StartAt.Add(-1 * time.Hour)
 		slot.EndAt = timeslot.StartAt
 
-		err = scheduler.Book(ctx, slot)
+		_, err = scheduler.Book(ctx, slot, newGuest())
 		assert.NoError(t, err)
 
-		slots, err = scheduler.Search(ctx, schedule.Query{
+		slots, err = search(ctx, scheduler, schedule.Query{
 			NodeID: slot.NodeID,
 			Region: slot.Region,
 			From:   slot.StartAt,
@@ -199,10 +234,10 @@ func Test_Book(t *testing.T) {
 		slot.StartAt = timeslot.EndAt
 		slot.EndAt = timeslot.EndAt.Add(1 * time.Hour)
 
-		err = scheduler.Book(ctx, slot)
+		_, err = scheduler.Book(ctx, slot, newGuest())
 		assert.NoError(t, err)
 
-		slots, err = scheduler.Search(ctx, schedule.Query{
+		slots, err = search(ctx, scheduler, schedule.Query{
 			NodeID: slot.NodeID,
 			Region: slot.Region,
 			From:   slot.StartAt,
@@ -222,6 +257,9 @@ func Test_Book_with_two_lots(t *testing.T) {
 		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
 		require.NoError(t, err)
 
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
 		return nil
 	}
 
@@ -249,21 +287,103 @@ func Test_Book_with_two_lots(t *testing.T) {
 		To:     to,
 	}
 
-	slots, err := scheduler.Search(ctx, query)
+	slots, err := search(ctx, scheduler, query)
 	assert.NoError(t, err)
 	assert.Equal(t, len(slots), 2)
 
 	timeslot.StartAt = from
 	timeslot.EndAt = to
 
-	err = scheduler.Book(ctx, timeslot)
+	_, err = scheduler.Book(ctx, timeslot, newGuest())
 	assert.NoError(t, err)
 
-	slots, err = scheduler.Search(ctx, query)
+	slots, err = search(ctx, scheduler, query)
 	assert.NoError(t, err)
 	assert.Equal(t, len(slots), 1)
 }
 
+// Test_Book_concurrently runs on SQLite, which serialises write
+// transactions, so it checks the outcome of racing bookings only. Row
+// locks sent to MySQL are checked by the tests of mysqldb.
+func Test_Book_concurrently(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, closeDB, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer closeDB()
+
+	now := time.Now()
+	scheduler := schedule.New(now, mysqldb.New(curDB))
+	ctx := context.Background()
+
+	err = scheduler.RegisterLot(ctx, timeslot)
+	require.NoError(t, err)
+
+	timeslot.StartAt = now.AddDate(0, 0, 1)
+	timeslot.EndAt = now.AddDate(0, 0, 3)
+
+	const attempts = 20
+
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+		errs  = make(chan error, attempts)
+	)
+
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			<-start
+
+			_, err := scheduler.Book(ctx, timeslot, newGuest())
+			errs <- err
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	wins := 0
+	for err := range errs {
+		if err == nil {
+			wins++
+		}
+	}
+
+	assert.Equal(t, 1, wins)
+
+	slots, err := search(ctx, scheduler, schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		From:   now,
+		To:     timeslot.StartAt,
+	})
+	require.NoError(t, err)
+	assert.Len(t, slots, 1)
+
+	slots, err = search(ctx, scheduler, schedule.Query{
+		NodeID: timeslot.NodeID,
+		Region: timeslot.Region,
+		From:   timeslot.EndAt,
+		To:     timeslot.EndAt.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Len(t, slots, 1)
+}
+
 func Test_Cancel(t *testing.T) {
 	timeslot := newTimeslot()
 
@@ -271,6 +391,9 @@ func Test_Cancel(t *testing.T) {
 		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
 		require.NoError(t, err)
 
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
 		return nil
 	}
 
@@ -295,71 +418,187 @@ func Test_Cancel(t *testing.T) {
 		To:     to,
 	}
 
-	slots, err := scheduler.Search(ctx, query)
+	slots, err := search(ctx, scheduler, query)
 	assert.NoError(t, err)
 	assert.Equal(t, len(slots), 1)
 
-	timeslot.StartAt = from
-	timeslot.EndAt = to
+	book := func(startAt, endAt time.Time) schedule.Booking {
+		slot := timeslot
+		slot.StartAt = startAt
+		slot.EndAt = endAt
 
-	err = scheduler.Book(ctx, timeslot)
-	assert.NoError(t, err)
+		booking, err := scheduler.Book(ctx, slot, newGuest())
+		require.NoError(t, err)
+		require.NotZero(t, booking.ID)
+		require.Equal(t, schedule.BookingStatusConfirmed, booking.Status)
 
-	t.Run("to cancel a slot an hour early", func(t *testing.T) {
-		slot := timeslot
-		slot.StartAt = timeslot.StartAt
-		slot.EndAt = timeslot.StartAt.Add(time.Hour)
+		return booking
+	}
 
-		err = scheduler.Cancel(ctx, slot)
-		assert.NoError(t, err)
+	early := book(from, from.Add(time.Hour))
+	middle := book(from.Add(5*time.Hour), to.Add(-5*time.Hour))
+	later := book(to.Add(-time.Hour), to)
+
+	for name, booking := range map[string]schedule.Booking{
+		"to cancel a booking an hour early": early,
+		"to cancel a booking an hour later": later,
+		"to cancel the middle booking":      middle,
+	} {
+		booking := booking
+
+		t.Run(name, func(t *testing.T) {
+			query := schedule.Query{
+				NodeID: booking.Slot.NodeID,
+				Region: booking.Slot.Region,
+				From:   booking.Slot.StartAt,
+				To:     booking.Slot.EndAt,
+			}
+
+			slots, err := search(ctx, scheduler, query)
+			assert.NoError(t, err)
+			assert.Equal(t, len(slots), 0)
 
-		slots, err = scheduler.Search(ctx, schedule.Query{
-			NodeID: slot.NodeID,
-			Region: slot.Region,
-			From:   slot.StartAt,
-			To:     slot.EndAt,
+			err = scheduler.Cancel(ctx, booking.ID)
+			assert.NoError(t, err)
+
+			slots, err = search(ctx, scheduler, query)
+			assert.NoError(t, err)
+			assert.Equal(t, len(slots), 1)
+
+			err = scheduler.Cancel(ctx, booking.ID)
+			assert.ErrorIs(t, err, schedule.ErrNotFound)
 		})
+	}
+
+	t.Run("free intervals are merged into one", func(t *testing.T) {
+		slots, err := search(ctx, scheduler, query)
 		assert.NoError(t, err)
-		assert.Equal(t, len(slots), 1)
+		require.Len(t, slots, 1)
+		assert.True(t, slots[0].StartAt.Before(from))
+		assert.True(t, slots[0].EndAt.After(to))
+	})
+}
+
+func Test_Scheduler_errors(t *testing.T) {
+	timeslot := newTimeslot()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(timeslot.NodeID[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+	defer close()
+
+	now := time.Now()
+	scheduler := schedule.New(now, mysqldb.New(curDB))
+	ctx := context.Background()
+
+	timeslot.StartAt = now.AddDate(0, 0, 1)
+	timeslot.EndAt = now.AddDate(0, 0, 3)
+
+	t.Run("unable to cancel an unknown booking", func(t *testing.T) {
+		err := scheduler.Cancel(ctx, schedule.LongID(gofakeit.Uint32()))
+		assert.ErrorIs(t, err, schedule.ErrNotFound)
 	})
 
-	t.Run("to cancel a slot an hour later", func(t *testing.T) {
+	t.Run("unable to book a slot of unknown lot", func(t *testing.T) {
+		_, err := scheduler.Book(ctx, timeslot, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
+	})
+
+	t.Run("unable to book a slot ending before it starts", func(t *testing.T) {
 		slot := timeslot
-		slot.StartAt = timeslot.EndAt.Add(-time.Hour)
-		slot.EndAt = timeslot.EndAt
+		slot.StartAt, slot.EndAt = timeslot.EndAt, timeslot.StartAt
 
-		err = scheduler.Cancel(ctx, slot)
-		assert.NoError(t, err)
+		_, err := scheduler.Book(ctx, slot, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrInvalidSlot)
+	})
 
-		slots, err = scheduler.Search(ctx, schedule.Query{
-			NodeID: slot.NodeID,
-			Region: slot.Region,
-			From:   slot.StartAt,
-			To:     slot.EndAt,
+	t.Run("unable to book a slot past the horizon", func(t *testing.T) {
+		slot := timeslot
+		slot.EndAt = now.AddDate(101, 0, 0)
+
+		_, err := scheduler.Book(ctx, slot, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrOutOfHorizon)
+	})
+
+	t.Run("unable to search before the first day", func(t *testing.T) {
+		_, err := search(ctx, scheduler, schedule.Query{
+			NodeID: timeslot.NodeID,
+			Region: timeslot.Region,
+			From:   now.AddDate(0, 0, -1),
+			To:     now.AddDate(0, 0, 1),
 		})
-		assert.NoError(t, err)
-		assert.Equal(t, len(slots), 1)
+		assert.ErrorIs(t, err, schedule.ErrOutOfHorizon)
 	})
 
-	t.Run("to cancel the middle slot", func(t *testing.T) {
+	t.Run("unable to register a lot without id", func(t *testing.T) {
 		slot := timeslot
-		slot.StartAt = timeslot.StartAt.Add(5 * time.Hour)
-		slot.EndAt = timeslot.EndAt.Add(-5 * time.Hour)
+		slot.LotID = 0
 
-		err = scheduler.Cancel(ctx, slot)
-		assert.NoError(t, err)
+		err := scheduler.RegisterLot(ctx, slot)
+		assert.ErrorIs(t, err, schedule.ErrInvalidSlot)
+	})
 
-		slots, err = scheduler.Search(ctx, schedule.Query{
-			NodeID: slot.NodeID,
-			Region: slot.Region,
-			From:   slot.StartAt,
-			To:     slot.EndAt,
-		})
-		assert.NoError(t, err)
-		assert.Equal(t, len(slots), 1)
+	t.Run("unable to book a booked slot", func(t *testing.T) {
+		err := scheduler.RegisterLot(ctx, timeslot)
+		require.NoError(t, err)
+
+		_, err = scheduler.Book(ctx, timeslot, newGuest())
+		require.NoError(t, err)
+
+		_, err = scheduler.Book(ctx, timeslot, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrUnavailable)
 	})
 }
 
+// newScheduler makes a scheduler over a temporary database with tables
+// of the node.
+func newScheduler(
+	t *testing.T,
+	node schedule.CodeID,
+) (*schedule.Scheduler, time.Time, func() error) {
+	t.Helper()
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		err := helper.CreateTimeslotTable(ctx, tx, string(node[:]))
+		require.NoError(t, err)
+
+		err = helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	return schedule.New(now, mysqldb.New(curDB)), now, close
+}
+
+func search(
+	ctx context.Context,
+	scheduler *schedule.Scheduler,
+	query schedule.Query,
+) ([]schedule.TimeSlot, error) {
+	result, err := scheduler.Search(ctx, query)
+
+	return result.Slots, err
+}
+
+func newGuest() domain.AccessSubject {
+	return domain.AccessSubject(gofakeit.Number(1, 999_999_999))
+}
+
 func newTimeslot() schedule.TimeSlot {
 	code := schedule.CodeID{}
 	copy(code[:], gofakeit.CountryAbr())
@@ -0,0 +1,168 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+const defaultLimit = 100
+
+// Sort is the order of search results.
+type Sort uint8
+
+const (
+	// SortByLot orders slots by lot, it is the default.
+	SortByLot Sort = iota
+	// SortByEarliest puts free intervals opening earliest first.
+	SortByEarliest
+	// SortByTightest puts the shortest free intervals first, booking
+	// them leaves the least fragments.
+	SortByTightest
+)
+
+func (by Sort) order() (mysqldb.Order, error) {
+	switch by {
+	case SortByLot:
+		return mysqldb.OrderLot, nil
+	case SortByEarliest:
+		return mysqldb.OrderStart, nil
+	case SortByTightest:
+		return mysqldb.OrderDuration, nil
+	}
+
+	return 0, fmt.Errorf("unknown sort %d, %w", by, ErrInvalidQuery)
+}
+
+// key returns the value the record is ordered by first.
+func (by Sort) key(rec mysqldb.Record) uint32 {
+	switch by {
+	case SortByEarliest:
+		return rec.StartAt
+	case SortByTightest:
+		return rec.EndAt - rec.StartAt
+	}
+
+	return 0
+}
+
+type nodePage struct {
+	records []mysqldb.Record
+	err     error
+}
+
+// nodes returns the node if it is set, otherwise the nodes of the region.
+func (unit *Scheduler) nodes(node, region CodeID) []CodeID {
+	if node != (CodeID{}) {
+		return []CodeID{node}
+	}
+
+	return unit.registry.Nodes(region)
+}
+
+// node returns the node if it is set, otherwise the node of the region.
+// A region stored on several nodes requires the node to be set.
+func (unit *Scheduler) node(node, region CodeID) (CodeID, error) {
+	if node != (CodeID{}) || region == (CodeID{}) {
+		return node, nil
+	}
+
+	nodes := unit.registry.Nodes(region)
+	if len(nodes) != 1 {
+		return node, fmt.Errorf(
+			"node is required, region %s is stored on %d nodes, %w",
+			region[:],
+			len(nodes),
+			ErrInvalidSlot,
+		)
+	}
+
+	return nodes[0], nil
+}
+
+// fanOut lists the nodes concurrently, every node is limited
+// by the node timeout. Pages are in the order of nodes.
+func (unit *Scheduler) fanOut(
+	ctx context.Context,
+	nodes []CodeID,
+	qry mysqldb.Query,
+	after func(node CodeID) *mysqldb.Cursor,
+) []nodePage {
+	pages := make([]nodePage, len(nodes))
+
+	var wg sync.WaitGroup
+
+	for idx, node := range nodes {
+		wg.Add(1)
+
+		go func(idx int, node CodeID) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, unit.nodeTimeout)
+			defer cancel()
+
+			qry := qry
+			qry.NodeID = mysqldb.CodeID(node)
+			qry.After = after(node)
+
+			pages[idx].records, pages[idx].err = unit.connector.List(ctx, qry)
+		}(idx, node)
+	}
+
+	wg.Wait()
+
+	return pages
+}
+
+// paginate orders records merged from several nodes the same way
+// the cursor does and returns the page.
+func paginate(
+	records []mysqldb.Record,
+	by Sort,
+	offset uint64,
+	limit uint64,
+) []mysqldb.Record {
+	sort.SliceStable(records, func(i, j int) bool {
+		if a, b := by.key(records[i]), by.key(records[j]); a != b {
+			return a < b
+		}
+
+		if records[i].LotID != records[j].LotID {
+			return records[i].LotID < records[j].LotID
+		}
+
+		if records[i].NodeID != records[j].NodeID {
+			return nodeLess(CodeID(records[i].NodeID), CodeID(records[j].NodeID))
+		}
+
+		return records[i].ID < records[j].ID
+	})
+
+	if offset >= uint64(len(records)) {
+		return []mysqldb.Record{}
+	}
+
+	records = records[offset:]
+	if limit < uint64(len(records)) {
+		records = records[:limit]
+	}
+
+	return records
+}
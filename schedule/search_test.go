@@ -0,0 +1,377 @@
+package schedule_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/findbed/app/schedule/mysqldb"
+	"github.com/findbed/app/tests/helper"
+	"github.com/imega/testhelpers/db"
+	"github.com/imega/txwrapper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Search_fan_out(t *testing.T) {
+	var (
+		region  = schedule.CodeID{'x', 'x'}
+		first   = schedule.CodeID{'n', '1'}
+		second  = schedule.CodeID{'n', '2'}
+		missing = schedule.CodeID{'n', '3'}
+	)
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		for _, node := range []schedule.CodeID{first, second} {
+			err := helper.CreateTimeslotTable(ctx, tx, string(node[:]))
+			require.NoError(t, err)
+		}
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	defer close()
+
+	// Days are aligned to midnight, so the booked day is whole.
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	registry := schedule.NewRegistry()
+	scheduler := schedule.New(
+		now,
+		mysqldb.New(curDB),
+		schedule.WithRegistry(registry),
+	)
+
+	ctx := context.Background()
+
+	for lot, node := range map[schedule.LongID]schedule.CodeID{
+		1: second,
+		2: first,
+		3: second,
+	} {
+		err := scheduler.RegisterLot(ctx, schedule.TimeSlot{
+			NodeID: node,
+			Region: region,
+			LotID:  lot,
+		})
+		require.NoError(t, err)
+	}
+
+	query := schedule.Query{
+		Region: region,
+		From:   now.AddDate(0, 0, 1),
+		To:     now.AddDate(0, 0, 2),
+	}
+
+	t.Run("slots of all nodes are merged", func(t *testing.T) {
+		registry.Set(region, first, second)
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+		assert.False(t, result.Partial)
+
+		require.Len(t, result.Slots, 3)
+		assert.Equal(t, second, result.Slots[0].NodeID)
+		assert.Equal(t, first, result.Slots[1].NodeID)
+		assert.Equal(t, schedule.LongID(3), result.Slots[2].LotID)
+	})
+
+	t.Run("merged slots are paginated", func(t *testing.T) {
+		registry.Set(region, first, second)
+
+		query := query
+		query.Offset = 1
+		query.Limit = 1
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		require.Len(t, result.Slots, 1)
+		assert.Equal(t, schedule.LongID(2), result.Slots[0].LotID)
+	})
+
+	t.Run("failed node is flagged", func(t *testing.T) {
+		registry.Set(region, first, missing)
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+		assert.True(t, result.Partial)
+		assert.Equal(t, []schedule.CodeID{missing}, result.FailedNodes)
+
+		require.Len(t, result.Slots, 1)
+		assert.Equal(t, schedule.LongID(2), result.Slots[0].LotID)
+	})
+
+	t.Run("search fails if all nodes fail", func(t *testing.T) {
+		registry.Set(region, missing)
+
+		_, err := scheduler.Search(ctx, query)
+		assert.Error(t, err)
+	})
+
+	t.Run("node of the query is searched only", func(t *testing.T) {
+		registry.Set(region, first, second)
+
+		query := query
+		query.NodeID = first
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		require.Len(t, result.Slots, 1)
+		assert.Equal(t, schedule.LongID(2), result.Slots[0].LotID)
+	})
+
+	t.Run("pages are chained by the cursor", func(t *testing.T) {
+		registry.Set(region, first, second)
+
+		err := scheduler.RegisterLot(ctx, schedule.TimeSlot{
+			NodeID: second,
+			Region: region,
+			LotID:  2,
+		})
+		require.NoError(t, err)
+
+		type key struct {
+			lotID schedule.LongID
+			node  schedule.CodeID
+		}
+
+		query := query
+		query.Limit = 1
+
+		actual := []key{}
+
+		for page := 0; page < 10; page++ {
+			result, err := scheduler.Search(ctx, query)
+			require.NoError(t, err)
+
+			for _, slot := range result.Slots {
+				actual = append(actual, key{slot.LotID, slot.NodeID})
+			}
+
+			if result.NextCursor == "" {
+				break
+			}
+
+			query.Cursor = result.NextCursor
+		}
+
+		expected := []key{{1, second}, {2, first}, {2, second}, {3, second}}
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		query := query
+		query.Cursor = "garbage"
+
+		_, err := scheduler.Search(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidCursor)
+	})
+}
+
+func Test_node_of_region(t *testing.T) {
+	var (
+		region = schedule.CodeID{'r', 'u'}
+		first  = schedule.CodeID{'r', '1'}
+		second = schedule.CodeID{'r', '2'}
+	)
+
+	txs := func(ctx context.Context, tx *sql.Tx) error {
+		for _, node := range []schedule.CodeID{first, second} {
+			err := helper.CreateTimeslotTable(ctx, tx, string(node[:]))
+			require.NoError(t, err)
+		}
+
+		err := helper.CreateBookingTable(ctx, tx)
+		require.NoError(t, err)
+
+		return nil
+	}
+
+	curDB, close, err := db.Create("", txwrapper.TxFunc(txs))
+	require.NoError(t, err)
+
+	defer close()
+
+	// Days are aligned to midnight, so the booked day is whole.
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	registry := schedule.NewRegistry()
+	registry.Set(region, first)
+
+	scheduler := schedule.New(
+		now,
+		mysqldb.New(curDB),
+		schedule.WithRegistry(registry),
+	)
+
+	ctx := context.Background()
+	slot := schedule.TimeSlot{Region: region, HousingID: 1, LotID: 10}
+
+	t.Run("node is found by the region", func(t *testing.T) {
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+
+		booked := slot
+		booked.StartAt = now.AddDate(0, 0, 1)
+		booked.EndAt = now.AddDate(0, 0, 2)
+
+		booking, err := scheduler.Book(ctx, booked, newGuest())
+		require.NoError(t, err)
+		assert.Equal(t, first, booking.Slot.NodeID)
+
+		calendar, err := scheduler.Calendar(ctx, schedule.Query{
+			Region: region,
+			LotID:  slot.LotID,
+			From:   booked.StartAt,
+			To:     booked.EndAt,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, calendar.Days, schedule.DayStatusBooked)
+	})
+
+	t.Run("node is required for a region of several nodes", func(t *testing.T) {
+		registry.Set(region, first, second)
+		defer registry.Set(region, first)
+
+		err := scheduler.RegisterLot(ctx, slot)
+		assert.ErrorIs(t, err, schedule.ErrInvalidSlot)
+
+		booked := slot
+		booked.StartAt = now.AddDate(0, 0, 4)
+		booked.EndAt = now.AddDate(0, 0, 5)
+
+		_, err = scheduler.Book(ctx, booked, newGuest())
+		assert.ErrorIs(t, err, schedule.ErrInvalidSlot)
+
+		booked.NodeID = first
+
+		_, err = scheduler.Book(ctx, booked, newGuest())
+		assert.NoError(t, err)
+	})
+}
+
+func Test_Registry_Load(t *testing.T) {
+	registry := schedule.NewRegistry()
+
+	err := registry.Load("ru:r1, ru:r2,fi:fi")
+	require.NoError(t, err)
+
+	expected := []schedule.CodeID{{'r', '1'}, {'r', '2'}}
+	assert.Equal(t, expected, registry.Nodes(schedule.CodeID{'r', 'u'}))
+
+	expected = []schedule.CodeID{{'s', 'e'}}
+	assert.Equal(t, expected, registry.Nodes(schedule.CodeID{'s', 'e'}))
+
+	expected = []schedule.CodeID{{'f', 'i'}, {'r', '1'}, {'r', '2'}}
+	assert.Equal(t, expected, registry.All())
+
+	err = registry.Load("ru=r1")
+	assert.ErrorIs(t, err, schedule.ErrInvalidRegistry)
+}
+
+func Test_Search_sort(t *testing.T) {
+	node := schedule.CodeID{'s', 's'}
+
+	scheduler, now, close := newScheduler(t, node)
+	defer close()
+
+	ctx := context.Background()
+
+	for lot, booked := range map[schedule.LongID][2]time.Duration{
+		1: {2 * time.Hour, 5 * time.Hour},
+		2: {time.Hour, 3 * time.Hour},
+		3: {20 * 24 * time.Hour, 21 * 24 * time.Hour},
+	} {
+		slot := schedule.TimeSlot{NodeID: node, Region: node, LotID: lot}
+
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+
+		slot.StartAt = now.Add(booked[0])
+		slot.EndAt = now.Add(booked[1])
+
+		_, err = scheduler.Book(ctx, slot, newGuest())
+		require.NoError(t, err)
+	}
+
+	query := schedule.Query{
+		NodeID: node,
+		Region: node,
+		From:   now.AddDate(0, 0, 1),
+		To:     now.AddDate(0, 0, 2),
+	}
+
+	lots := func(slots []schedule.TimeSlot) []schedule.LongID {
+		result := []schedule.LongID{}
+		for _, slot := range slots {
+			result = append(result, slot.LotID)
+		}
+
+		return result
+	}
+
+	for name, tc := range map[string]struct {
+		by       schedule.Sort
+		expected []schedule.LongID
+	}{
+		"by lot":      {schedule.SortByLot, []schedule.LongID{1, 2, 3}},
+		"by earliest": {schedule.SortByEarliest, []schedule.LongID{3, 2, 1}},
+		"by tightest": {schedule.SortByTightest, []schedule.LongID{3, 1, 2}},
+	} {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			query := query
+			query.Sort = tc.by
+
+			result, err := scheduler.Search(ctx, query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, lots(result.Slots))
+
+			query.Limit = 1
+			actual := []schedule.LongID{}
+
+			for page := 0; page < 10; page++ {
+				result, err := scheduler.Search(ctx, query)
+				require.NoError(t, err)
+
+				actual = append(actual, lots(result.Slots)...)
+
+				if result.NextCursor == "" {
+					break
+				}
+
+				query.Cursor = result.NextCursor
+			}
+
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+
+	t.Run("cursor of another sort", func(t *testing.T) {
+		query := query
+		query.Limit = 1
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		query.Sort = schedule.SortByTightest
+		query.Cursor = result.NextCursor
+
+		_, err = scheduler.Search(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidCursor)
+	})
+
+	t.Run("unknown sort", func(t *testing.T) {
+		query := query
+		query.Sort = 10
+
+		_, err := scheduler.Search(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidQuery)
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import "sort"
+
+// span is an interval [startAt, endAt) in hours after the first day.
+type span struct {
+	startAt uint32
+	endAt   uint32
+}
+
+// mergeSpans orders the spans and joins overlapping and adjacent ones.
+func mergeSpans(spans []span) []span {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].startAt < spans[j].startAt
+	})
+
+	result := []span{}
+
+	for _, cur := range spans {
+		if cur.startAt >= cur.endAt {
+			continue
+		}
+
+		last := len(result) - 1
+		if last >= 0 && cur.startAt <= result[last].endAt {
+			if cur.endAt > result[last].endAt {
+				result[last].endAt = cur.endAt
+			}
+
+			continue
+		}
+
+		result = append(result, cur)
+	}
+
+	return result
+}
+
+// subtractSpans cuts the spans out of the merged spans.
+func subtractSpans(spans []span, cuts []span) []span {
+	cuts = mergeSpans(cuts)
+	result := []span{}
+
+	for _, cur := range spans {
+		for _, cut := range cuts {
+			if cut.endAt <= cur.startAt || cut.startAt >= cur.endAt {
+				continue
+			}
+
+			if cut.startAt > cur.startAt {
+				result = append(result, span{startAt: cur.startAt, endAt: cut.startAt})
+			}
+
+			cur.startAt = cut.endAt
+			if cur.startAt >= cur.endAt {
+				break
+			}
+		}
+
+		if cur.startAt < cur.endAt {
+			result = append(result, cur)
+		}
+	}
+
+	return result
+}
+
+// intersectSpans returns the hours of the merged spans the others cover.
+func intersectSpans(spans []span, others []span) []span {
+	return subtractSpans(spans, subtractSpans(spans, others))
+}
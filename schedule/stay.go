@@ -0,0 +1,64 @@
+// Copyright © 2022 Dmitry Stoletov <info@imega.ru>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/findbed/app/schedule/mysqldb"
+)
+
+// stayHours returns the length of the stay of the query in hours. The stay
+// must fit into the window [from, to) of the query.
+func stayHours(stay time.Duration, from, to uint32) (uint32, error) {
+	if stay < time.Hour {
+		return 0, fmt.Errorf("stay is shorter than an hour, %w", ErrInvalidQuery)
+	}
+
+	hours := uint32(stay / time.Hour)
+	if from+hours > to {
+		return 0, fmt.Errorf("stay is longer than the window, %w", ErrInvalidQuery)
+	}
+
+	return hours, nil
+}
+
+// whereStayFits makes the query find free intervals a stay of the given
+// length fits into somewhere in the window [From, To). Such an interval
+// starts before the stay ending at To starts and ends after the stay
+// starting at From ends.
+func whereStayFits(qry mysqldb.Query, stay uint32) mysqldb.Query {
+	qry.From, qry.To = qry.To-stay, qry.From+stay
+	qry.MinDuration = stay
+
+	return qry
+}
+
+// earliestStay returns the earliest stay of the given length in the free
+// interval that starts in the window starting at from.
+func (unit *Scheduler) earliestStay(
+	rec mysqldb.Record,
+	from uint32,
+	stay uint32,
+) TimeSlot {
+	if rec.StartAt < from {
+		rec.StartAt = from
+	}
+
+	rec.EndAt = rec.StartAt + stay
+
+	return unit.record2timeSlot(rec)
+}
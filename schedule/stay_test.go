@@ -0,0 +1,100 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/findbed/app/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Search_stay(t *testing.T) {
+	node := schedule.CodeID{'s', 't'}
+
+	scheduler, now, close := newScheduler(t, node)
+	defer close()
+
+	ctx := context.Background()
+
+	day := func(num int) time.Time {
+		return now.Truncate(time.Hour).AddDate(0, 0, num)
+	}
+
+	// Lot 1 is free for two days inside the window, lot 2 is free from
+	// the middle of the window, lot 3 is free for the first two days only.
+	for lot, booked := range map[schedule.LongID][][2]int{
+		1: {{0, 10}, {12, 40}},
+		2: {{0, 15}},
+		3: {{12, 40}},
+	} {
+		slot := schedule.TimeSlot{NodeID: node, Region: node, LotID: lot}
+
+		err := scheduler.RegisterLot(ctx, slot)
+		require.NoError(t, err)
+
+		for _, days := range booked {
+			slot.StartAt = day(days[0])
+			slot.EndAt = day(days[1])
+
+			_, err = scheduler.Book(ctx, slot, newGuest())
+			require.NoError(t, err)
+		}
+	}
+
+	query := schedule.Query{
+		NodeID: node,
+		Region: node,
+		From:   day(10),
+		To:     day(20),
+		Sort:   schedule.SortByEarliest,
+	}
+
+	starts := func(slots []schedule.TimeSlot) map[schedule.LongID]time.Time {
+		result := map[schedule.LongID]time.Time{}
+		for _, slot := range slots {
+			result[slot.LotID] = slot.StartAt
+		}
+
+		return result
+	}
+
+	t.Run("stays fitting into the window", func(t *testing.T) {
+		query := query
+		query.Stay = 2 * 24 * time.Hour
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		expected := map[schedule.LongID]time.Time{
+			1: day(10),
+			2: day(15),
+			3: day(10),
+		}
+		assert.Equal(t, expected, starts(result.Slots))
+
+		for _, slot := range result.Slots {
+			assert.Equal(t, query.Stay, slot.EndAt.Sub(slot.StartAt))
+		}
+	})
+
+	t.Run("longer stay", func(t *testing.T) {
+		query := query
+		query.Stay = 3 * 24 * time.Hour
+
+		result, err := scheduler.Search(ctx, query)
+		require.NoError(t, err)
+
+		expected := map[schedule.LongID]time.Time{2: day(15)}
+		assert.Equal(t, expected, starts(result.Slots))
+	})
+
+	t.Run("stay longer than the window", func(t *testing.T) {
+		query := query
+		query.Stay = 11 * 24 * time.Hour
+
+		_, err := scheduler.Search(ctx, query)
+		assert.ErrorIs(t, err, schedule.ErrInvalidQuery)
+	})
+}
@@ -4,31 +4,29 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+
+	"github.com/findbed/app/migration"
 )
 
 func CreateTimeslotTable(ctx context.Context, tx *sql.Tx, node string) error {
-	q := `CREATE TABLE IF NOT EXISTS timeslot_` + node + ` (
-		id          INTEGER    PRIMARY KEY AUTOINCREMENT,
-		region      VARCHAR(2)          NOT NULL,
-    	area        INTEGER    UNSIGNED NOT NULL,
-    	locality    INTEGER    UNSIGNED NOT NULL,
-    	sublocality INTEGER    UNSIGNED NOT NULL,
-    	housing_id  INTEGER    UNSIGNED NOT NULL,
-    	lot_id      INTEGER    UNSIGNED NOT NULL,
-    	start_at    INTEGER    UNSIGNED          DEFAULT 0,
-    	end_at      INTEGER    UNSIGNED          DEFAULT 65535);
+	scope, err := migration.TimeslotScope(node)
+	if err != nil {
+		return fmt.Errorf("failed to get scope, %w", err)
+	}
 
-		CREATE UNIQUE INDEX slot ON timeslot_` + node + `(
-			region, area, locality, sublocality, housing_id, lot_id, start_at
-		);
+	return execAll(ctx, tx, scope.Statements(migration.SQLite))
+}
 
-		CREATE INDEX free_slot ON timeslot_` + node + `(
-			region, start_at, end_at
-		);
-    `
+// CreateBookingTable creates the tables shared by all nodes.
+func CreateBookingTable(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx, migration.GlobalScope().Statements(migration.SQLite))
+}
 
-	if _, err := tx.ExecContext(ctx, q); err != nil {
-		return fmt.Errorf("failed to execute query, %w", err)
+func execAll(ctx context.Context, tx *sql.Tx, stmts []string) error {
+	for _, q := range stmts {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return fmt.Errorf("failed to execute query, %w", err)
+		}
 	}
 
 	return nil
@@ -29,9 +29,164 @@ CREATE TABLE timeslot_0001 (
     sublocality smallint(6) UNSIGNED NOT NULL,
     housing_id bigint(20) UNSIGNED NOT NULL,
     lot_id bigint(20) UNSIGNED NOT NULL,
-    start_at smallint(6) UNSIGNED DEFAULT 0,
-    end_at smallint(6) UNSIGNED DEFAULT 65535,
+    -- Hours after the first day of the scheduler.
+    start_at int(10) UNSIGNED DEFAULT 0,
+    end_at int(10) UNSIGNED DEFAULT 876000,
+    -- Length of the free interval in hours.
+    duration int(11) AS (CAST(end_at AS SIGNED) - CAST(start_at AS SIGNED)) STORED,
     PRIMARY KEY (`id`),
     UNIQUE KEY slot (region, area, locality, sublocality, housing_id, lot_id, start_at),
-    KEY free_slot (region, start_at, end_at)
+    KEY free_slot (region, start_at, end_at),
+    KEY lot (region, lot_id, id),
+    KEY start (region, start_at, lot_id, id),
+    KEY duration (region, duration, lot_id, id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE bookings (
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    -- Node of the timeslot table the lot is stored in.
+    node char(2) NOT NULL,
+    region char(2) NOT NULL,
+    area smallint(6) UNSIGNED NOT NULL,
+    locality smallint(6) UNSIGNED NOT NULL,
+    sublocality smallint(6) UNSIGNED NOT NULL,
+    housing_id bigint(20) UNSIGNED NOT NULL,
+    lot_id bigint(20) UNSIGNED NOT NULL,
+    -- Hours after the first day of the scheduler.
+    start_at int(10) UNSIGNED NOT NULL,
+    end_at int(10) UNSIGNED NOT NULL,
+    guest bigint(20) UNSIGNED NOT NULL,
+    -- 1 confirmed, 2 cancelled, 3 held, 4 expired.
+    status tinyint(3) UNSIGNED NOT NULL,
+    -- Token and expiry of a hold, a confirmed hold keeps them.
+    token varchar(32) NOT NULL DEFAULT '',
+    expires_at bigint(20) UNSIGNED NOT NULL DEFAULT 0,
+    -- Unix time.
+    created_at bigint(20) UNSIGNED NOT NULL,
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY booking_lot (node, lot_id, start_at),
+    KEY booking_token (token),
+    KEY booking_expiry (status, expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE casbin_rules (
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    -- Type of the rule, a policy or a grouping.
+    ptype tinyint(3) UNSIGNED NOT NULL,
+    v0 bigint(20) UNSIGNED NOT NULL,
+    v1 bigint(20) UNSIGNED NOT NULL,
+    v2 bigint(20) UNSIGNED NOT NULL DEFAULT 0,
+    v3 bigint(20) UNSIGNED NOT NULL DEFAULT 0,
+    -- Removed rules are kept.
+    deleted tinyint(1) UNSIGNED NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY rule (ptype, v0, v1, v2, v3)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE blocks (
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    -- Node of the timeslot table the lot is stored in.
+    node char(2) NOT NULL,
+    region char(2) NOT NULL,
+    area smallint(6) UNSIGNED NOT NULL,
+    locality smallint(6) UNSIGNED NOT NULL,
+    sublocality smallint(6) UNSIGNED NOT NULL,
+    housing_id bigint(20) UNSIGNED NOT NULL,
+    lot_id bigint(20) UNSIGNED NOT NULL,
+    -- Hours after the first day of the scheduler.
+    start_at int(10) UNSIGNED NOT NULL,
+    end_at int(10) UNSIGNED NOT NULL,
+    -- Owner who closed the lot.
+    author bigint(20) UNSIGNED NOT NULL,
+    reason varchar(255) NOT NULL DEFAULT '',
+    -- 1 active, 2 removed.
+    status tinyint(3) UNSIGNED NOT NULL,
+    -- Unix time.
+    created_at bigint(20) UNSIGNED NOT NULL,
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (`id`),
+    KEY block_lot (node, lot_id, start_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE availability_rules (
+    id bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+    node char(2) NOT NULL,
+    region char(2) NOT NULL,
+    area smallint(6) UNSIGNED NOT NULL,
+    locality smallint(6) UNSIGNED NOT NULL,
+    sublocality smallint(6) UNSIGNED NOT NULL,
+    housing_id bigint(20) UNSIGNED NOT NULL,
+    lot_id bigint(20) UNSIGNED NOT NULL,
+    -- JSON of schedule.AvailabilityRules.
+    rules text NOT NULL,
+    -- Unix time.
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY availability_lot (node, lot_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE rates (
+    lot_id bigint(20) UNSIGNED NOT NULL,
+    -- ISO 4217 code all amounts of the rates are in.
+    currency char(3) NOT NULL,
+    -- JSON of pricing.Rates.
+    rates text NOT NULL,
+    -- Unix time.
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (lot_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE exchange_rates (
+    currency char(3) NOT NULL,
+    -- Currency the rate is given for one unit of.
+    base char(3) NOT NULL,
+    -- Decimal number of units of the currency.
+    rate varchar(32) NOT NULL,
+    -- Unix time.
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (currency)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE charges (
+    region char(2) NOT NULL,
+    -- Zero is the whole region.
+    area smallint(6) UNSIGNED NOT NULL,
+    -- Zero is the whole area.
+    locality smallint(6) UNSIGNED NOT NULL,
+    -- JSON of taxes and fees.
+    rules text NOT NULL,
+    -- Unix time.
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (region, area, locality)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE promotions (
+    code varchar(32) NOT NULL,
+    -- percent or amount.
+    kind varchar(16) NOT NULL,
+    -- Decimal percent or amount off.
+    value varchar(32) NOT NULL,
+    -- Currency of the amount, empty for percent.
+    currency char(3) NOT NULL,
+    -- Empty for every region.
+    region char(2) NOT NULL,
+    min_nights smallint(6) UNSIGNED NOT NULL,
+    -- Unix time, zero is unlimited.
+    starts_at bigint(20) UNSIGNED NOT NULL,
+    ends_at bigint(20) UNSIGNED NOT NULL,
+    -- Zero is unlimited.
+    max_redemptions int(11) UNSIGNED NOT NULL,
+    redemptions int(11) UNSIGNED NOT NULL,
+    -- Unix time.
+    updated_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (code)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
+
+CREATE TABLE redemptions (
+    code varchar(32) NOT NULL,
+    booking_id bigint(20) UNSIGNED NOT NULL,
+    -- Unix time.
+    created_at bigint(20) UNSIGNED NOT NULL,
+    PRIMARY KEY (code, booking_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8 COLLATE=utf8_unicode_ci;
@@ -1,3 +1,10 @@
 countryRegion=Country %s
 text=текст
 text1=Привет!
+subtotal=Subtotal
+total=Total
+vat=VAT
+tourist_tax=Tourist tax
+city_levy=City levy
+cleaning_fee=Cleaning fee
+service_fee=Service fee
@@ -1,3 +1,10 @@
 countryRegion=Страна
 text=текст
 text1=Привет!
+subtotal=Стоимость проживания
+total=Итого
+vat=НДС
+tourist_tax=Туристический налог
+city_levy=Городской сбор
+cleaning_fee=Уборка
+service_fee=Сервисный сбор
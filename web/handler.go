@@ -1,46 +1,82 @@
 package web
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/bojanz/currency"
+	"github.com/findbed/app/l10n"
 	"github.com/foolin/goview"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
-func RootHandler(ctx *gin.Context) {
+func (h *handler) root(ctx *gin.Context) {
 	err := goview.Render(ctx.Writer, http.StatusOK, "index.tmpl", goview.M{
 		"title": "Main website",
 		"l10n":  extractL10N(ctx),
-		"money": func(amount, currencyCode string) string {
-			val, err := currency.NewAmount(amount, currencyCode)
-			if err != nil {
-				return ""
-			}
-
-			return moneyFormat(ctx).Format(val)
-		},
+		"money": h.money(ctx),
 	})
 	if err != nil {
 		log.Printf("======== %s", err.Error())
 	}
 }
 
+// money formats an amount in the display currency followed by
+// the original one, or only in the original if it can't be converted.
+func (h *handler) money(ctx *gin.Context) func(string, string) string {
+	formatter := moneyFormat(ctx)
+	display := ctx.GetString("cur")
+
+	return func(amount, currencyCode string) string {
+		val, err := currency.NewAmount(amount, currencyCode)
+		if err != nil {
+			return ""
+		}
+
+		original := formatter.Format(val)
+
+		if h.converter == nil || display == "" || display == val.CurrencyCode() {
+			return original
+		}
+
+		converted, err := h.converter.Convert(val, display)
+		if err != nil {
+			return original
+		}
+
+		return fmt.Sprintf("%s (%s)", formatter.Format(converted), original)
+	}
+}
+
 func extractL10N(ctx *gin.Context) interface{} {
+	return extractPrinter(ctx).Sprintf
+}
+
+// extractLabel translates labels which aren't formats, e.g. names of
+// charges set by owners.
+func extractLabel(ctx *gin.Context) func(string) string {
+	printer := extractPrinter(ctx)
+
+	return func(key string) string {
+		return l10n.Label(printer, key)
+	}
+}
+
+func extractPrinter(ctx *gin.Context) *message.Printer {
 	val, isExist := ctx.Get("prt")
 	if !isExist {
-		return message.NewPrinter(language.English).Sprintf
+		return message.NewPrinter(language.English)
 	}
 
 	printer, ok := val.(*message.Printer)
 	if !ok {
-		return message.NewPrinter(language.English).Sprintf
+		return message.NewPrinter(language.English)
 	}
 
-	return printer.Sprintf
+	return printer
 }
 
 func moneyFormat(ctx *gin.Context) *currency.Formatter {
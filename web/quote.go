@@ -0,0 +1,109 @@
+package web
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/schedule"
+	"github.com/foolin/goview"
+	"github.com/gin-gonic/gin"
+)
+
+const dateLayout = "2006-01-02"
+
+// quote renders the price of a stay itemised by nights, taxes and fees.
+func (h *handler) quote(ctx *gin.Context) {
+	lot, err := strconv.ParseUint(ctx.Query("lot_id"), 10, 64)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "lot_id must be a number")
+
+		return
+	}
+
+	from, err := time.Parse(dateLayout, ctx.Query("from"))
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "from must be a date")
+
+		return
+	}
+
+	to, err := time.Parse(dateLayout, ctx.Query("to"))
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "to must be a date")
+
+		return
+	}
+
+	guests, err := strconv.ParseUint(ctx.DefaultQuery("guests", "1"), 10, 8)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, "guests must be a number")
+
+		return
+	}
+
+	location, err := parseLocation(ctx)
+	if err != nil {
+		ctx.String(http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	quote, err := h.pricer.Quote(
+		ctx.Request.Context(),
+		schedule.LongID(lot),
+		location,
+		from,
+		to,
+		uint8(guests),
+	)
+	if err != nil {
+		ctx.String(http.StatusUnprocessableEntity, err.Error())
+
+		return
+	}
+
+	err = goview.Render(ctx.Writer, http.StatusOK, "quote.tmpl", goview.M{
+		"title": "Quote",
+		"l10n":  extractL10N(ctx),
+		"label": extractLabel(ctx),
+		"money": h.money(ctx),
+		"quote": quote,
+	})
+	if err != nil {
+		log.Printf("failed to render a quote, %s", err)
+	}
+}
+
+func parseLocation(ctx *gin.Context) (pricing.Location, error) {
+	var location pricing.Location
+
+	region := ctx.Query("region")
+	if region == "" {
+		return location, nil
+	}
+
+	if len(region) != len(location.Region) {
+		return location, errors.New("region must be two characters")
+	}
+
+	copy(location.Region[:], region)
+
+	area, err := strconv.ParseUint(ctx.DefaultQuery("area", "0"), 10, 16)
+	if err != nil {
+		return location, errors.New("area must be a number")
+	}
+
+	locality, err := strconv.ParseUint(ctx.DefaultQuery("locality", "0"), 10, 16)
+	if err != nil {
+		return location, errors.New("locality must be a number")
+	}
+
+	location.Area = schedule.ID(area)
+	location.Locality = schedule.ID(locality)
+
+	return location, nil
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -11,16 +12,62 @@ import (
 	"time"
 
 	rice "github.com/GeertJohan/go.rice"
+	"github.com/bojanz/currency"
 	"github.com/findbed/app/l10n"
+	"github.com/findbed/app/pricing"
+	"github.com/findbed/app/schedule"
 	"github.com/foolin/goview"
 	"github.com/foolin/goview/supports/ginview"
 	"github.com/foolin/goview/supports/gorice"
 	"github.com/gin-gonic/gin"
+	xcurrency "golang.org/x/text/currency"
 	"golang.org/x/text/language"
 	"golang.org/x/text/message"
 )
 
-func WebRouter(engine *gin.Engine) {
+// Converter converts prices to the display currency.
+type Converter interface {
+	Convert(currency.Amount, string) (currency.Amount, error)
+}
+
+// Pricer quotes stays of lots.
+type Pricer interface {
+	Quote(
+		context.Context,
+		schedule.LongID,
+		pricing.Location,
+		time.Time,
+		time.Time,
+		uint8,
+	) (pricing.Quote, error)
+}
+
+type handler struct {
+	converter Converter
+	pricer    Pricer
+}
+
+type Option func(*handler)
+
+func WithConverter(converter Converter) Option {
+	return func(h *handler) {
+		h.converter = converter
+	}
+}
+
+func WithPricer(pricer Pricer) Option {
+	return func(h *handler) {
+		h.pricer = pricer
+	}
+}
+
+func WebRouter(engine *gin.Engine, opts ...Option) {
+	h := &handler{}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
 	conf := rice.Config{
 		LocateOrder: []rice.LocateMethod{rice.LocateWorkingDirectory},
 	}
@@ -113,15 +160,17 @@ func WebRouter(engine *gin.Engine) {
 
 	engine.HTMLRender = ginview.Wrap(basic)
 
-	engine.GET("/", setLocale(localization), RootHandler)
+	engine.GET("/", setLocale(localization), h.root)
+
+	if h.pricer != nil {
+		engine.GET("/quote", setLocale(localization), h.quote)
+	}
 
 	engine.StaticFS("/assets", assets.HTTPBox())
 }
 
 func setLocale(locale *l10n.L10N) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		currency := ctx.Query("cur")
-
 		var lngTag language.Tag
 
 		lang := ctx.Query("lng")
@@ -143,7 +192,25 @@ func setLocale(locale *l10n.L10N) gin.HandlerFunc {
 		}
 
 		ctx.Set("lng", lngTag.String())
-		ctx.Set("cur", currency)
+		ctx.Set("cur", displayCurrency(ctx.Query("cur"), lngTag))
 		ctx.Set("prt", message.NewPrinter(lngTag))
 	}
 }
+
+// displayCurrency returns the requested currency if it is valid,
+// otherwise the currency of the region of the language.
+func displayCurrency(code string, lngTag language.Tag) string {
+	code = strings.ToUpper(code)
+	if code != "" && currency.IsValid(code) {
+		return code
+	}
+
+	region, _ := lngTag.Region()
+
+	unit, ok := xcurrency.FromRegion(region)
+	if !ok {
+		return ""
+	}
+
+	return unit.String()
+}